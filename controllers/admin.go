@@ -0,0 +1,359 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/pulsejet/go-cerium/models"
+	"github.com/pulsejet/go-cerium/store"
+	u "github.com/pulsejet/go-cerium/utils"
+)
+
+// Admins : roll numbers of site administrators from the comma separated
+// ADMINS, besides the users whose profile makes them one
+var Admins = parseList(os.Getenv("ADMINS"))
+
+// Limits on the number of forms found by a search
+const (
+	defaultSearchLimit = 50
+	maxSearchLimit     = 500
+)
+
+// adminOf : whether the user with the profile, which may be nil, is a site administrator
+func adminOf(rno string, profile *models.Profile) bool {
+	if rno == "" {
+		return false
+	}
+	for _, admin := range Admins {
+		if admin == rno {
+			return true
+		}
+	}
+	return profile != nil && profile.Admin
+}
+
+// isAdmin : whether the user is a site administrator
+func (h *Handler) isAdmin(ctx context.Context, rno string) bool {
+	user, err := h.users.FindUser(ctx, rno)
+	if err != nil {
+		user = nil
+	}
+	return adminOf(rno, user)
+}
+
+// admin : get the logged in user if they are a site administrator, for
+// handlers behind RequireAuth
+func (h *Handler) admin(w http.ResponseWriter, r *http.Request) string {
+	if !CurrentUser(r).HasRole(SiteRoleAdmin) {
+		u.Respond(w, u.Message(false, "Forbidden: administrators only"), 403)
+		return ""
+	}
+	return rollNo(r)
+}
+
+// adminForm : get the form in the request for a site administrator
+func (h *Handler) adminForm(w http.ResponseWriter, r *http.Request) (*models.Form, string) {
+	rno := h.admin(w, r)
+	if rno == "" {
+		return nil, ""
+	}
+	form, err := h.forms.FindForm(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		u.Respond(w, u.Message(false, "Not Found"), 404)
+		return nil, ""
+	}
+	return form, rno
+}
+
+// adminReason : the reason an administrator gave for an action, if any
+func adminReason(r *http.Request) map[string]string {
+	body := &struct {
+		Reason string `json:"reason"`
+	}{}
+	json.NewDecoder(r.Body).Decode(body)
+	if body.Reason == "" {
+		return nil
+	}
+	return map[string]string{"reason": body.Reason}
+}
+
+// recordAdmin : record an action of an administrator on a form in its audit
+// trail, and in the site trail with the form as the target, where it is still
+// found once the form is deleted
+func (h *Handler) recordAdmin(ctx context.Context, form *models.Form, rno string, action string,
+	details map[string]string) {
+	h.record(ctx, &models.AuditEntry{FormID: form.ID, Actor: rno, Action: action, Details: details})
+	h.record(ctx, &models.AuditEntry{Actor: rno, Action: action, Target: form.ID, Details: details})
+}
+
+// SearchForms : API handler for an administrator listing all forms, or those
+// whose id or creator is the q parameter or whose name contains it
+func (h *Handler) SearchForms(w http.ResponseWriter, r *http.Request) {
+	rno := h.admin(w, r)
+	if rno == "" {
+		return
+	}
+
+	query := r.URL.Query().Get("q")
+	limit := defaultSearchLimit
+	if s := r.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxSearchLimit {
+			u.Respond(w, u.Message(false, "Bad limit"), 400)
+			return
+		}
+		limit = n
+	}
+
+	forms, err := h.forms.SearchForms(r.Context(), query, limit)
+	if err != nil {
+		u.Respond(w, u.Message(false, err.Error()), 500)
+		return
+	}
+	h.record(r.Context(), &models.AuditEntry{Actor: rno, Action: models.AuditAdminSearched,
+		Details: map[string]string{"query": query}})
+
+	type formSummary struct {
+		ID            string    `json:"id"`
+		Name          string    `json:"name"`
+		Creator       string    `json:"creator"`
+		Timestamp     time.Time `json:"timestamp"`
+		Status        string    `json:"status"`
+		Suspended     bool      `json:"suspended"`
+		Collaborators int       `json:"collaborators"`
+	}
+	summaries := make([]formSummary, 0, len(forms))
+	for _, form := range forms {
+		status := models.StatusPublished
+		if !form.IsPublished() {
+			status = models.StatusDraft
+		}
+		summaries = append(summaries, formSummary{ID: form.ID, Name: form.Name, Creator: form.Creator,
+			Timestamp: form.Timestamp, Status: status, Suspended: form.Suspended,
+			Collaborators: len(form.Collaborators)})
+	}
+	u.Respond(w, summaries, 200)
+}
+
+// AdminGetForm : API handler for an administrator reading a form as its owners
+// see it, with its draft, collaborators and availability
+func (h *Handler) AdminGetForm(w http.ResponseWriter, r *http.Request) {
+	form, rno := h.adminForm(w, r)
+	if form == nil {
+		return
+	}
+	h.recordAdmin(r.Context(), form, rno, models.AuditAdminViewed, nil)
+
+	form.CanEdit = false
+	form.HasDraft = form.Draft != nil
+	form.Availability = h.availability(r.Context(), form)
+	u.Respond(w, form, 200)
+}
+
+// suspendForm : close the form to respondents until an administrator reopens it, or reopen it
+func (h *Handler) suspendForm(w http.ResponseWriter, r *http.Request, suspended bool, action string) {
+	form, rno := h.adminForm(w, r)
+	if form == nil {
+		return
+	}
+	details := adminReason(r)
+
+	if form.Suspended != suspended {
+		changed := *form
+		changed.Suspended = suspended
+		err := h.replaceForm(r.Context(), rno, form, form.Version, &changed)
+		if err == store.ErrNotFound {
+			u.Respond(w, u.Message(false, "Not Found"), 404)
+			return
+		}
+		if err == store.ErrConflict {
+			respondConflict(w, r, h.forms, form.ID)
+			return
+		}
+		if err != nil {
+			u.Respond(w, u.Message(false, err.Error()), 500)
+			return
+		}
+		form = &changed
+	}
+	h.recordAdmin(r.Context(), form, rno, action, details)
+
+	log.Println(rno, ":", action, "form", form.ID)
+	setETag(w, form.Version)
+	u.Respond(w, map[string]interface{}{"id": form.ID, "version": form.Version, "suspended": form.Suspended}, 200)
+}
+
+// AdminCloseForm : API handler for an administrator closing a form, which
+// its owners cannot reopen
+func (h *Handler) AdminCloseForm(w http.ResponseWriter, r *http.Request) {
+	h.suspendForm(w, r, true, models.AuditAdminClosed)
+}
+
+// AdminReopenForm : API handler for an administrator reopening a form they closed
+func (h *Handler) AdminReopenForm(w http.ResponseWriter, r *http.Request) {
+	h.suspendForm(w, r, false, models.AuditAdminReopened)
+}
+
+// AdminDeleteForm : API handler for an administrator deleting a form with its
+// responses, keeping its audit trail
+func (h *Handler) AdminDeleteForm(w http.ResponseWriter, r *http.Request) {
+	form, rno := h.adminForm(w, r)
+	if form == nil {
+		return
+	}
+
+	details := adminReason(r)
+	if details == nil {
+		details = map[string]string{}
+	}
+	details["name"] = form.Name
+	details["creator"] = form.Creator
+	h.deleteForm(r.Context(), form.ID)
+	h.recordAdmin(r.Context(), form, rno, models.AuditAdminDeleted, details)
+
+	log.Println(rno, ": deleted form", form.ID, "as administrator")
+	u.Respond(w, u.Message(true, "Form deleted"), 200)
+}
+
+// AdminRecountForm : API handler for an administrator setting the counters of
+// a form from its responses, returning places lost to interrupted submissions
+func (h *Handler) AdminRecountForm(w http.ResponseWriter, r *http.Request) {
+	form, rno := h.adminForm(w, r)
+	if form == nil {
+		return
+	}
+
+	before, err := h.responses.FindCounts(r.Context(), form.ID)
+	if err != nil {
+		u.Respond(w, u.Message(false, err.Error()), 500)
+		return
+	}
+	counts, err := h.recount(r.Context(), form)
+	if err != nil {
+		u.Respond(w, u.Message(false, err.Error()), 500)
+		return
+	}
+	details := map[string]string{}
+	for key, n := range counts {
+		if before[key] != n {
+			details[key] = strconv.Itoa(before[key]) + " -> " + strconv.Itoa(n)
+		}
+	}
+	h.recordAdmin(r.Context(), form, rno, models.AuditAdminRecounted, details)
+
+	log.Println(rno, ": recounted form", form.ID)
+	u.Respond(w, counts, 200)
+}
+
+// userStats : how much a user uses the site
+type userStats struct {
+	RollNumber string `json:"rno"`
+	Registered bool   `json:"registered"`
+	Admin      bool   `json:"admin"`
+	Forms      int    `json:"forms"`
+	Published  int    `json:"published"`
+	Suspended  int    `json:"suspended"`
+	Shared     int    `json:"shared"`
+
+	// Accepted responses to their forms, as counted for the response limits
+	Responses int `json:"responses"`
+}
+
+// AdminUserStats : API handler for an administrator getting the usage of a user
+func (h *Handler) AdminUserStats(w http.ResponseWriter, r *http.Request) {
+	rno := h.admin(w, r)
+	if rno == "" {
+		return
+	}
+
+	target := mux.Vars(r)["rno"]
+	stats := &userStats{RollNumber: target, Admin: h.isAdmin(r.Context(), target)}
+	_, err := h.users.FindUser(r.Context(), target)
+	stats.Registered = err == nil
+
+	forms, err := h.forms.FindFormsByCreator(r.Context(), target)
+	if err != nil {
+		u.Respond(w, u.Message(false, err.Error()), 500)
+		return
+	}
+	shared, err := h.shares.FindSharedForms(r.Context(), target)
+	if err != nil {
+		u.Respond(w, u.Message(false, err.Error()), 500)
+		return
+	}
+
+	stats.Forms = len(forms)
+	stats.Shared = len(shared)
+	for _, form := range forms {
+		if form.IsPublished() {
+			stats.Published++
+		}
+		if form.Suspended {
+			stats.Suspended++
+		}
+		counts, err := h.counts(r.Context(), form)
+		if err != nil {
+			u.Respond(w, u.Message(false, err.Error()), 500)
+			return
+		}
+		stats.Responses += counts[models.ResponsesCounter]
+	}
+	h.record(r.Context(), &models.AuditEntry{Actor: rno, Action: models.AuditAdminStats, Target: target})
+
+	u.Respond(w, stats, 200)
+}
+
+// SetAdmin : API handler for an administrator making a registered user one, or not
+func (h *Handler) SetAdmin(w http.ResponseWriter, r *http.Request) {
+	rno := h.admin(w, r)
+	if rno == "" {
+		return
+	}
+
+	body := &struct {
+		Admin bool `json:"admin"`
+	}{}
+	err := json.NewDecoder(r.Body).Decode(body)
+	if err != nil {
+		u.Respond(w, u.Message(false, err.Error()), 400)
+		return
+	}
+
+	target := mux.Vars(r)["rno"]
+	err = h.users.SetAdmin(r.Context(), target, body.Admin)
+	if err == store.ErrNotFound {
+		u.Respond(w, u.Message(false, "Not Found"), 404)
+		return
+	}
+	if err != nil {
+		u.Respond(w, u.Message(false, err.Error()), 500)
+		return
+	}
+	h.record(r.Context(), &models.AuditEntry{Actor: rno, Action: models.AuditAdminSet, Target: target,
+		Details: map[string]string{"admin": strconv.FormatBool(body.Admin)}})
+
+	log.Println(rno, ": set administrator", target, body.Admin)
+	u.Respond(w, u.Message(true, "Administrator updated"), 200)
+}
+
+// GetSiteAudit : API handler for an administrator getting the actions taken
+// on the site, and those of administrators on forms
+func (h *Handler) GetSiteAudit(w http.ResponseWriter, r *http.Request) {
+	if h.admin(w, r) == "" {
+		return
+	}
+
+	entries, err := h.audit.FindAudit(r.Context(), "")
+	if err != nil {
+		u.Respond(w, u.Message(false, err.Error()), 500)
+		return
+	}
+	u.Respond(w, entries, 200)
+}
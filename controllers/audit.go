@@ -0,0 +1,34 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/pulsejet/go-cerium/models"
+	u "github.com/pulsejet/go-cerium/utils"
+)
+
+// record : add an entry to the audit trail of a form, at the current time
+func (h *Handler) record(ctx context.Context, entry *models.AuditEntry) {
+	entry.Time = time.Now()
+	if err := h.audit.InsertAudit(ctx, entry); err != nil {
+		log.Println("could not record", entry.Action, "of form", entry.FormID, ":", err)
+	}
+}
+
+// GetAudit : API handler for the owners getting the audit trail of a form
+func (h *Handler) GetAudit(w http.ResponseWriter, r *http.Request) {
+	form, _ := h.sharedForm(w, r, models.RoleOwner)
+	if form == nil {
+		return
+	}
+
+	entries, err := h.audit.FindAudit(r.Context(), form.ID)
+	if err != nil {
+		u.Respond(w, u.Message(false, err.Error()), 500)
+		return
+	}
+	u.Respond(w, entries, 200)
+}
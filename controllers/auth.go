@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/dgrijalva/jwt-go"
+
+	"github.com/pulsejet/go-cerium/models"
+	"github.com/pulsejet/go-cerium/store"
+	u "github.com/pulsejet/go-cerium/utils"
+)
+
+// SiteRoleAdmin : role of site administrators, who may act on any form
+const SiteRoleAdmin = "admin"
+
+// Principal : the logged in user making a request
+type Principal struct {
+	RollNumber string
+
+	// Roles on the site, as opposed to the roles on forms they are shared with
+	Roles []string
+
+	// Profile saved when the user last logged in with SSO, nil if they never did
+	Profile *models.Profile
+}
+
+// HasRole : true if the principal has the site role, never for anonymous requests
+func (p *Principal) HasRole(role string) bool {
+	if p == nil {
+		return false
+	}
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// authKey : context key of the authentication of a request
+type authKey struct{}
+
+// authentication : the principal of a request, or why its session was refused
+type authentication struct {
+	principal *Principal
+	err       string
+}
+
+// parseSession : get the roll number from the JWT in the token cookie,
+// returning an empty roll number and why if it is invalid
+func parseSession(r *http.Request) (string, string) {
+	c, err := r.Cookie("token")
+	if err != nil {
+		return "", ""
+	}
+
+	claims := &Claims{}
+	tkn, err := jwt.ParseWithClaims(c.Value, claims, func(token *jwt.Token) (interface{}, error) {
+		return jwtKey, nil
+	})
+	if err != nil || tkn == nil || !tkn.Valid || claims.RollNumber == "" {
+		return "", "Unauthorized: Session expired or invalid, please login again"
+	}
+	return claims.RollNumber, ""
+}
+
+// authenticate : the request with its principal in the context, if that
+// was not already done for it
+func (h *Handler) authenticate(r *http.Request) *http.Request {
+	if _, ok := r.Context().Value(authKey{}).(*authentication); ok {
+		return r
+	}
+
+	auth := &authentication{}
+	rno, reason := parseSession(r)
+	auth.err = reason
+	if rno != "" {
+		auth.principal = &Principal{RollNumber: rno, Roles: []string{}}
+		profile, err := h.users.FindUser(r.Context(), rno)
+		if err != nil && err != store.ErrNotFound {
+			log.Println("could not load profile of", rno, ":", err)
+		}
+		if err == nil {
+			auth.principal.Profile = profile
+		}
+		if adminOf(rno, auth.principal.Profile) {
+			auth.principal.Roles = append(auth.principal.Roles, SiteRoleAdmin)
+		}
+	}
+	return r.WithContext(context.WithValue(r.Context(), authKey{}, auth))
+}
+
+// Authenticate : middleware reading the session of every request once, for
+// RequireAuth and OptionalAuth to find
+func (h *Handler) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, h.authenticate(r))
+	})
+}
+
+// RequireAuth : let only logged in users through to the handler
+func (h *Handler) RequireAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r = h.authenticate(r)
+		if CurrentUser(r) == nil {
+			respondUnauthorized(w, r)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// OptionalAuth : let anyone through to the handler, with the principal of
+// those logged in. Invalid sessions are treated as anonymous
+func (h *Handler) OptionalAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		next(w, h.authenticate(r))
+	}
+}
+
+// CurrentUser : the principal of the request, nil if it is anonymous
+func CurrentUser(r *http.Request) *Principal {
+	if auth, ok := r.Context().Value(authKey{}).(*authentication); ok {
+		return auth.principal
+	}
+	return nil
+}
+
+// rollNo : roll number of the principal of the request, empty if it is anonymous
+func rollNo(r *http.Request) string {
+	if p := CurrentUser(r); p != nil {
+		return p.RollNumber
+	}
+	return ""
+}
+
+// respondUnauthorized : tell the client to login, or to login again if
+// their session was refused
+func respondUnauthorized(w http.ResponseWriter, r *http.Request) {
+	text := "Unauthorized: Please login to continue"
+	if auth, ok := r.Context().Value(authKey{}).(*authentication); ok && auth.err != "" {
+		text = auth.err
+	}
+	u.Respond(w, u.Message(false, text), 401)
+}
@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/pulsejet/go-cerium/models"
+	"github.com/pulsejet/go-cerium/store"
+	u "github.com/pulsejet/go-cerium/utils"
+	"github.com/pulsejet/go-cerium/validate"
+)
+
+// decodeCollaborator : read the collaborator in the request, responding
+// and returning nil if it is not one that can be given to the form
+func decodeCollaborator(w http.ResponseWriter, r *http.Request, form *models.Form) *models.Collaborator {
+	collaborator := &models.Collaborator{}
+	err := json.NewDecoder(r.Body).Decode(collaborator)
+	if err != nil {
+		u.Respond(w, u.Message(false, err.Error()), 400)
+		return nil
+	}
+	if rno, ok := mux.Vars(r)["rno"]; ok {
+		collaborator.RollNumber = rno
+	}
+
+	errs := validate.Errors{}
+	if collaborator.RollNumber == "" {
+		errs["rno"] = "must not be empty"
+	} else if collaborator.RollNumber == form.Creator {
+		errs["rno"] = "is the creator of the form"
+	}
+	if !models.ValidRole(collaborator.Role) {
+		errs["role"] = "must be owner, editor or viewer"
+	}
+	if len(errs) > 0 {
+		msg := u.Message(false, "Invalid collaborator")
+		msg["errors"] = errs
+		u.Respond(w, msg, 422)
+		return nil
+	}
+	return collaborator
+}
+
+// setCollaborator : save the collaborator and note it in the audit trail
+func (h *Handler) setCollaborator(w http.ResponseWriter, r *http.Request, form *models.Form, rno string,
+	collaborator *models.Collaborator) {
+	err := h.shares.SetCollaborator(r.Context(), form.ID, collaborator)
+	if err != nil {
+		u.Respond(w, u.Message(false, err.Error()), 500)
+		return
+	}
+	h.record(r.Context(), &models.AuditEntry{FormID: form.ID, Actor: rno, Action: models.AuditCollaboratorSet,
+		Target: collaborator.RollNumber, Details: map[string]string{"role": collaborator.Role}})
+
+	log.Println(rno, ": made", collaborator.RollNumber, collaborator.Role, "of form", form.ID)
+	u.Respond(w, collaborator, 200)
+}
+
+// InviteCollaborator : API handler for an owner sharing the form with a user
+func (h *Handler) InviteCollaborator(w http.ResponseWriter, r *http.Request) {
+	form, rno := h.sharedForm(w, r, models.RoleOwner)
+	if form == nil {
+		return
+	}
+	collaborator := decodeCollaborator(w, r, form)
+	if collaborator == nil {
+		return
+	}
+	if form.RoleOf(collaborator.RollNumber) != "" {
+		u.Respond(w, u.Message(false, "User is already a collaborator"), 409)
+		return
+	}
+	h.setCollaborator(w, r, form, rno, collaborator)
+}
+
+// ChangeCollaborator : API handler for an owner changing the role of a collaborator
+func (h *Handler) ChangeCollaborator(w http.ResponseWriter, r *http.Request) {
+	form, rno := h.sharedForm(w, r, models.RoleOwner)
+	if form == nil {
+		return
+	}
+	collaborator := decodeCollaborator(w, r, form)
+	if collaborator == nil {
+		return
+	}
+	if form.RoleOf(collaborator.RollNumber) == "" {
+		u.Respond(w, u.Message(false, "Not Found"), 404)
+		return
+	}
+	h.setCollaborator(w, r, form, rno, collaborator)
+}
+
+// RemoveCollaborator : API handler for an owner removing a collaborator,
+// or for a collaborator leaving the form
+func (h *Handler) RemoveCollaborator(w http.ResponseWriter, r *http.Request) {
+	target := mux.Vars(r)["rno"]
+	role := models.RoleOwner
+	if target == rollNo(r) {
+		role = models.RoleViewer
+	}
+	form, rno := h.sharedForm(w, r, role)
+	if form == nil {
+		return
+	}
+
+	err := h.shares.DeleteCollaborator(r.Context(), form.ID, target)
+	if err == store.ErrNotFound {
+		u.Respond(w, u.Message(false, "Not Found"), 404)
+		return
+	}
+	if err != nil {
+		u.Respond(w, u.Message(false, err.Error()), 500)
+		return
+	}
+	h.record(r.Context(), &models.AuditEntry{FormID: form.ID, Actor: rno, Action: models.AuditCollaboratorRemoved,
+		Target: target})
+
+	log.Println(rno, ": removed", target, "from form", form.ID)
+	u.Respond(w, u.Message(true, "Collaborator removed"), 200)
+}
@@ -3,59 +3,45 @@ package controllers_test
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	c "github.com/pulsejet/go-cerium/controllers"
 	"github.com/pulsejet/go-cerium/models"
-	u "github.com/pulsejet/go-cerium/utils"
+	"github.com/pulsejet/go-cerium/store"
 
 	"github.com/gorilla/mux"
-	"github.com/joho/godotenv"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-var rno string
+const rno = "123456789"
 
-type ProfileResponse struct {
-	Id             int    `json:"id"`
-	FirstName      string `json:"first_name"`
-	LastName       string `json:"last_name"`
-	RollNumber     string `json:"roll_number"`
-	ProfilePicture string `json:"profile_picture"`
-	Email          string `json:"email"`
-}
+var db *store.Memory
+var h *c.Handler
 
 func setup() {
-	err := godotenv.Load("../.env")
-	rno = os.Getenv("TEST_ROLL")
-	if err != nil {
-		panic(fmt.Errorf("Error loading .env file"))
-	}
+	// Use a fresh in-memory database
+	db = store.NewMemory()
+	h = c.New(db)
 
 	// Create dummy profile
-	profile := ProfileResponse{}
-	profile.Id = 1234
+	profile := &models.Profile{}
+	profile.ID = 1234
 	profile.FirstName = "Test"
 	profile.LastName = "Subject"
 	profile.RollNumber = rno
 	profile.ProfilePicture = ""
 	profile.Email = "test@gmail.com"
 
-	rno := profile.RollNumber
-	collection := u.Collection(context.Background(), "users")
-	var ropts options.ReplaceOptions
-	ropts.SetUpsert(true)
-
 	// Insert dummy profile into database
-	_, err = collection.ReplaceOne(
-		context.Background(), bson.M{"rollnumber": rno}, profile, &ropts)
+	err := db.UpsertUser(context.Background(), profile)
 
 	if err != nil {
 		fmt.Println("Could not complete setup")
@@ -63,35 +49,14 @@ func setup() {
 	}
 }
 
-func shutdown() {
-	// Remove the dummy profile created
-	collection := u.Collection(context.Background(), "users")
-	_, err := collection.DeleteOne(context.Background(), bson.M{"rollnumber": rno})
-	if err != nil {
-		fmt.Printf("remove fail %v\n", err)
-	}
-
-	// Cleanup any form or response created by test subject
-	collection = u.Collection(context.Background(), "forms")
-	_, err = collection.DeleteMany(context.Background(), bson.M{"creator": rno})
-	if err != nil {
-		fmt.Printf("remove fail %v\n", err)
-	}
-}
-
 func TestMain(m *testing.M) {
 	setup()
-	code := m.Run()
-	shutdown()
-	os.Exit(code)
+	os.Exit(m.Run())
 }
 
 // Tests that the setup() has created db entry
 func TestProfile(t *testing.T) {
-	user := &ProfileResponse{}
-
-	collection := u.Collection(context.Background(), "users")
-	err := collection.FindOne(context.Background(), bson.M{"rollnumber": rno}).Decode(&user)
+	_, err := db.FindUser(context.Background(), rno)
 	checkError(err, t)
 }
 
@@ -100,7 +65,7 @@ func TestNewFormCreate(t *testing.T) {
 	// Create dummy form
 	form := createDummyForm()
 
-	handler := http.HandlerFunc(c.CreateForm)
+	handler := h.RequireAuth(h.CreateForm)
 
 	formJson, _ := json.Marshal(form)
 
@@ -115,10 +80,9 @@ func TestNewFormCreate(t *testing.T) {
 		t.Errorf("Status code differs. Expected %d .\n Got %d instead", http.StatusOK, status)
 	}
 
-	dbForm := &models.Form{}
-	err := u.Collection(context.Background(), "forms").FindOne(context.Background(), bson.M{"creator": rno}).Decode(&dbForm)
+	dbForms, err := db.FindFormsByCreator(context.Background(), rno)
 	checkError(err, t)
-	if dbForm.Name != "Test Form" {
+	if len(dbForms) == 0 || dbForms[0].Name != "Test Form" {
 		t.Errorf("Form in db different from one created in test")
 	}
 }
@@ -128,7 +92,7 @@ func TestEmptyForm(t *testing.T) {
 	// Create dummy form
 	form := createDummyForm()
 
-	handler := http.HandlerFunc(c.CreateForm)
+	handler := h.RequireAuth(h.CreateForm)
 
 	// Empty the pages and create request
 	form.Pages = []models.Page{}
@@ -145,6 +109,33 @@ func TestEmptyForm(t *testing.T) {
 	}
 }
 
+// Tests that structurally invalid forms are rejected before being stored
+func TestInvalidForm(t *testing.T) {
+	form := createDummyForm()
+	form.Pages[0].Title = "Invalid Form"
+	form.Pages[0].Widgets = append(form.Pages[0].Widgets, form.Pages[0].Widgets[0])
+	formJson, _ := json.Marshal(form)
+
+	recorder := httptest.NewRecorder()
+	h.RequireAuth(h.CreateForm).ServeHTTP(recorder, requestAPI("POST", "/api/form", formJson))
+	if status := recorder.Code; status != http.StatusUnprocessableEntity {
+		t.Errorf("Status code differs. Expected %d Got %d instead", http.StatusUnprocessableEntity, status)
+	}
+
+	var res struct{ Errors map[string]string }
+	json.NewDecoder(recorder.Body).Decode(&res)
+	if res.Errors["/pages/0/widgets/1/uid"] == "" {
+		t.Errorf("Unexpected errors %v", res.Errors)
+	}
+
+	forms, _ := db.FindFormsByCreator(context.Background(), rno)
+	for _, f := range forms {
+		if f.Name == "Invalid Form" {
+			t.Errorf("Invalid form was stored")
+		}
+	}
+}
+
 // Tests for editing form
 func TestEditForm(t *testing.T) {
 	// Create dummy form
@@ -152,17 +143,17 @@ func TestEditForm(t *testing.T) {
 	form.Pages[0].Title = "Edit Form"
 	form.Name = "Edit Form"
 	form.Creator = rno
+	form.Status = models.StatusDraft
 
-	res, _ := u.Collection(context.Background(), "forms").InsertOne(context.Background(), form)
-	id := res.InsertedID.(primitive.ObjectID)
+	id, _ := db.InsertForm(context.Background(), &form)
 
 	r := mux.NewRouter()
-	r.HandleFunc("/api/form/{id}", c.CreateForm)
+	r.HandleFunc("/api/form/{id}", h.RequireAuth(h.CreateForm))
 
 	// Empty the pages and create request
 	form.Pages[0].Title = "Post Edit Form"
 	formJson, _ := json.Marshal(form)
-	request := requestAPI("PUT", "/api/form/"+id.Hex(), formJson)
+	request := requestAPI("PUT", "/api/form/"+id, formJson)
 
 	recorder := httptest.NewRecorder()
 
@@ -174,18 +165,1492 @@ func TestEditForm(t *testing.T) {
 	}
 
 	// Make sure that form has been edited
-	dbForm := &models.Form{}
-	err := u.Collection(context.Background(), "forms").FindOne(context.Background(),
-		bson.M{"$and": bson.A{bson.M{"_id": id}, bson.M{"creator": rno}}}).Decode(&dbForm)
+	dbForm, err := db.FindForm(context.Background(), id)
 	checkError(err, t)
 	if dbForm.Name != "Post Edit Form" {
 		t.Errorf("Form in db different from one edited in test")
 	}
 }
 
+// Tests that responses are stored for the form
+func TestCreateResponse(t *testing.T) {
+	form := createDummyForm()
+	form.RequireLogin = false
+	form.SingleResponse = false
+	id, _ := db.InsertForm(context.Background(), &form)
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/response/{formid}", h.OptionalAuth(h.CreateResponse))
+
+	// Fill the form twice
+	for i := 0; i < 2; i++ {
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, requestAPI("POST", "/api/response/"+id, createDummyResponse(form)))
+		if status := recorder.Code; status != http.StatusOK {
+			t.Errorf("Status code differs. Expected %d Got %d instead", http.StatusOK, status)
+		}
+	}
+
+	// Make sure both responses were stored
+	responses, err := db.FindResponses(context.Background(), id)
+	checkError(err, t)
+	if len(responses) != 2 {
+		t.Errorf("Expected 2 responses in db, got %d", len(responses))
+	}
+}
+
+// Tests that a single-response form cannot be filled twice
+func TestSingleResponse(t *testing.T) {
+	form := createDummyForm()
+	id, _ := db.InsertForm(context.Background(), &form)
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/response/{formid}", h.OptionalAuth(h.CreateResponse))
+
+	// First response goes through, second is rejected
+	expected := []int{http.StatusOK, http.StatusForbidden}
+	for _, code := range expected {
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, requestAPI("POST", "/api/response/"+id, createDummyResponse(form)))
+		if status := recorder.Code; status != code {
+			t.Errorf("Status code differs. Expected %d Got %d instead", code, status)
+		}
+	}
+}
+
+// Tests that concurrent submissions to a single-response form save one response,
+// also when the form does not require login
+func TestConcurrentSingleResponse(t *testing.T) {
+	form := createDummyForm()
+	form.RequireLogin = false
+	id, _ := db.InsertForm(context.Background(), &form)
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/response/{formid}", h.OptionalAuth(h.CreateResponse))
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	codes := map[int]int{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			recorder := httptest.NewRecorder()
+			r.ServeHTTP(recorder, requestAPI("POST", "/api/response/"+id, createDummyResponse(form)))
+
+			mu.Lock()
+			defer mu.Unlock()
+			codes[recorder.Code]++
+		}()
+	}
+	wg.Wait()
+
+	responses, _ := db.FindResponses(context.Background(), id)
+	if codes[http.StatusOK] != 1 || codes[http.StatusConflict]+codes[http.StatusForbidden] != 9 || len(responses) != 1 {
+		t.Errorf("Expected one response, got status codes %v and %d responses", codes, len(responses))
+	}
+}
+
+// Tests that anonymous respondents fill a single-response form once per browser
+func TestAnonymousSingleResponse(t *testing.T) {
+	form := createDummyForm()
+	form.RequireLogin = false
+	id, _ := db.InsertForm(context.Background(), &form)
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/form/{id}", h.OptionalAuth(h.GetForm))
+	r.HandleFunc("/api/response/{formid}", h.OptionalAuth(h.CreateResponse))
+
+	anon := func(method string, api string, body []byte, agent string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, api, bytes.NewBuffer(body))
+		request.Header.Set("User-Agent", agent)
+		for _, cookie := range cookies {
+			request.AddCookie(cookie)
+		}
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	// Responses need the cookie from opening the form
+	if recorder := anon("POST", "/api/response/"+id, createDummyResponse(form), "", nil); recorder.Code != http.StatusForbidden {
+		t.Errorf("Expected %d without cookie, got %d", http.StatusForbidden, recorder.Code)
+	}
+	recorder := anon("GET", "/api/form/"+id, nil, "", nil)
+	cookies := recorder.Result().Cookies()
+	if recorder.Code != http.StatusOK || len(cookies) != 1 || cookies[0].Name != "respondent" {
+		t.Fatalf("Expected respondent cookie, got %d %v", recorder.Code, cookies)
+	}
+
+	// One response per cookie
+	for _, code := range []int{http.StatusOK, http.StatusForbidden} {
+		recorder := anon("POST", "/api/response/"+id, createDummyResponse(form), "", cookies)
+		if recorder.Code != code {
+			t.Errorf("Status code differs. Expected %d Got %d instead", code, recorder.Code)
+		}
+	}
+	if recorder := anon("GET", "/api/form/"+id, nil, "", cookies); recorder.Code != http.StatusForbidden {
+		t.Errorf("Expected filled form to be refused, got %d", recorder.Code)
+	}
+
+	// With a fingerprint, clearing cookies does not allow another response
+	c.Fingerprint = []string{"User-Agent"}
+	defer func() { c.Fingerprint = nil }()
+	for _, browser := range []struct {
+		agent string
+		code  int
+	}{{"A", http.StatusOK}, {"B", http.StatusOK}, {"A", http.StatusForbidden}} {
+		cookies := anon("GET", "/api/form/"+id, nil, browser.agent, nil).Result().Cookies()
+		recorder := anon("POST", "/api/response/"+id, createDummyResponse(form), browser.agent, cookies)
+		if recorder.Code != browser.code {
+			t.Errorf("Expected %d for browser %s, got %d", browser.code, browser.agent, recorder.Code)
+		}
+	}
+}
+
+// Tests that invalid answers are rejected with errors per question
+func TestInvalidResponse(t *testing.T) {
+	form := createDummyForm()
+	form.RequireLogin = false
+	form.Pages[0].Widgets[0].Props["required"] = true
+	id, _ := db.InsertForm(context.Background(), &form)
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/response/{formid}", h.OptionalAuth(h.CreateResponse))
+
+	recorder := httptest.NewRecorder()
+	body := []byte(`{"responses": {"q1": "", "bogus": "x"}}`)
+	r.ServeHTTP(recorder, requestAPI("POST", "/api/response/"+id, body))
+	if status := recorder.Code; status != http.StatusUnprocessableEntity {
+		t.Errorf("Status code differs. Expected %d Got %d instead", http.StatusUnprocessableEntity, status)
+	}
+
+	var res struct{ Errors map[string]string }
+	json.NewDecoder(recorder.Body).Decode(&res)
+	if res.Errors["q1"] != "required" || res.Errors["bogus"] == "" {
+		t.Errorf("Unexpected errors %v", res.Errors)
+	}
+
+	if responses, _ := db.FindResponses(context.Background(), id); len(responses) != 0 {
+		t.Errorf("Invalid response was stored")
+	}
+}
+
+// Tests that hidden questions are neither required nor stored
+func TestConditionalResponse(t *testing.T) {
+	form := createDummyForm()
+	form.RequireLogin = false
+	form.SingleResponse = false
+	form.Pages[0].Widgets = append(form.Pages[0].Widgets, models.Widget{
+		Type:   "short_answer",
+		UID:    "q2",
+		ShowIf: "q1 == 'Other'",
+		Props:  map[string]interface{}{"question": "Please specify", "required": true},
+	})
+	id, _ := db.InsertForm(context.Background(), &form)
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/response/{formid}", h.OptionalAuth(h.CreateResponse))
+	r.HandleFunc("/api/form/{id}/visibility", h.OptionalAuth(h.GetVisibility))
+
+	// Hidden and answered
+	recorder := httptest.NewRecorder()
+	body := []byte(`{"responses": {"q1": "Answer", "q2": "ignored"}}`)
+	r.ServeHTTP(recorder, requestAPI("POST", "/api/response/"+id, body))
+	if status := recorder.Code; status != http.StatusOK {
+		t.Errorf("Status code differs. Expected %d Got %d instead", http.StatusOK, status)
+	}
+	responses, _ := db.FindResponses(context.Background(), id)
+	if len(responses) != 1 || responses[0].Responses["q2"] != nil {
+		t.Errorf("Hidden answer was stored")
+	}
+
+	// Visible and required
+	recorder = httptest.NewRecorder()
+	body = []byte(`{"responses": {"q1": "Other"}}`)
+	r.ServeHTTP(recorder, requestAPI("POST", "/api/response/"+id, body))
+	if status := recorder.Code; status != http.StatusUnprocessableEntity {
+		t.Errorf("Status code differs. Expected %d Got %d instead", http.StatusUnprocessableEntity, status)
+	}
+
+	// Client asks what is visible
+	recorder = httptest.NewRecorder()
+	r.ServeHTTP(recorder, requestAPI("POST", "/api/form/"+id+"/visibility", body))
+	var v struct{ Widgets map[string]bool }
+	json.NewDecoder(recorder.Body).Decode(&v)
+	if !v.Widgets["q1"] || !v.Widgets["q2"] {
+		t.Errorf("Unexpected visibility %v", v)
+	}
+}
+
+// Tests that responses can be fetched by collaborators
+func TestGetResponses(t *testing.T) {
+	form := createDummyForm()
+	form.Creator = rno
+
+	// Headers without questions are not exported
+	form.Pages[0].Widgets = append(form.Pages[0].Widgets, models.Widget{Type: "section", UID: "s1"})
+	id, _ := db.InsertForm(context.Background(), &form)
+
+	response := &models.FormResponse{FormID: id, Responses: map[string]interface{}{"q1": "Answer"}}
+	db.InsertResponse(context.Background(), response)
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/responses/{formid}", h.OptionalAuth(h.ResultsAccess(h.GetResponses)))
+
+	// Response tokens in the id are no longer accepted
+	recorder := httptest.NewRecorder()
+	r.ServeHTTP(recorder, requestAPI("POST", "/api/responses/"+id+"-token", []byte("{}")))
+	if status := recorder.Code; status != http.StatusNotFound {
+		t.Errorf("Status code differs. Expected %d Got %d instead", http.StatusNotFound, status)
+	}
+
+	// Array post processing
+	recorder = httptest.NewRecorder()
+	r.ServeHTTP(recorder, requestAPI("POST", "/api/responses/"+id, []byte(`{"type":"array"}`)))
+	if status := recorder.Code; status != http.StatusOK {
+		t.Errorf("Status code differs. Expected %d Got %d instead", http.StatusOK, status)
+	}
+
+	var rows [][]string
+	json.NewDecoder(recorder.Body).Decode(&rows)
+	if len(rows) != 2 || len(rows[0]) != 2 || rows[1][1] != "Answer" {
+		t.Errorf("Unexpected array response %v", rows)
+	}
+}
+
+// Tests that only the creator can delete a form along with its responses
+func TestDeleteForm(t *testing.T) {
+	form := createDummyForm()
+	form.Creator = "someone else"
+	id, _ := db.InsertForm(context.Background(), &form)
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/form/{id}", h.RequireAuth(h.DeleteForm))
+
+	recorder := httptest.NewRecorder()
+	r.ServeHTTP(recorder, requestAPI("DELETE", "/api/form/"+id, nil))
+	if status := recorder.Code; status != http.StatusForbidden {
+		t.Errorf("Status code differs. Expected %d Got %d instead", http.StatusForbidden, status)
+	}
+
+	// Delete own form
+	form.Creator = rno
+	id, _ = db.InsertForm(context.Background(), &form)
+	db.InsertResponse(context.Background(), &models.FormResponse{FormID: id})
+
+	recorder = httptest.NewRecorder()
+	r.ServeHTTP(recorder, requestAPI("DELETE", "/api/form/"+id, nil))
+	if status := recorder.Code; status != http.StatusOK {
+		t.Errorf("Status code differs. Expected %d Got %d instead", http.StatusOK, status)
+	}
+
+	if _, err := db.FindForm(context.Background(), id); err != store.ErrNotFound {
+		t.Errorf("Form still present after delete")
+	}
+	if responses, _ := db.FindResponses(context.Background(), id); len(responses) != 0 {
+		t.Errorf("Responses still present after delete")
+	}
+}
+
+// Tests that stale edits are rejected with the current version
+func TestEditConflict(t *testing.T) {
+	form := createDummyForm()
+	form.Creator = rno
+	id, _ := db.InsertForm(context.Background(), &form)
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/form/{id}", h.RequireAuth(h.CreateForm)).Methods("PUT")
+	r.HandleFunc("/api/form/{id}", h.OptionalAuth(h.GetForm)).Methods("GET")
+
+	// Get the current version
+	recorder := httptest.NewRecorder()
+	r.ServeHTTP(recorder, requestAPI("GET", "/api/form/"+id, nil))
+	etag := recorder.Header().Get("ETag")
+	if etag != `"0"` {
+		t.Errorf("Unexpected ETag %s", etag)
+	}
+
+	// First organiser saves
+	formJson, _ := json.Marshal(form)
+	request := requestAPI("PUT", "/api/form/"+id, formJson)
+	request.Header.Set("If-Match", etag)
+	recorder = httptest.NewRecorder()
+	r.ServeHTTP(recorder, request)
+	if status := recorder.Code; status != http.StatusOK {
+		t.Errorf("Status code differs. Expected %d Got %d instead", http.StatusOK, status)
+	}
+	if etag := recorder.Header().Get("ETag"); etag != `"1"` {
+		t.Errorf("Unexpected ETag %s", etag)
+	}
+
+	// Second organiser saves the same version
+	request = requestAPI("PUT", "/api/form/"+id, formJson)
+	request.Header.Set("If-Match", etag)
+	recorder = httptest.NewRecorder()
+	r.ServeHTTP(recorder, request)
+	if status := recorder.Code; status != http.StatusConflict {
+		t.Errorf("Status code differs. Expected %d Got %d instead", http.StatusConflict, status)
+	}
+	var res struct{ Version int }
+	json.NewDecoder(recorder.Body).Decode(&res)
+	if res.Version != 1 {
+		t.Errorf("Expected current version 1, got %d", res.Version)
+	}
+}
+
+// Tests that edits keep history which can be compared and restored
+func TestFormHistory(t *testing.T) {
+	form := createDummyForm()
+	form.Creator = rno
+	form.Name = "History Form"
+	form.Version = 1
+	form.Status = models.StatusDraft
+	id, _ := db.InsertForm(context.Background(), &form)
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/form/{id}", h.RequireAuth(h.CreateForm)).Methods("PUT")
+	r.HandleFunc("/api/form/{id}/revisions", h.RequireAuth(h.GetRevisions)).Methods("GET")
+	r.HandleFunc("/api/form/{id}/revisions/{version}/restore", h.RequireAuth(h.RestoreRevision)).Methods("POST")
+	r.HandleFunc("/api/form/{id}/diff", h.RequireAuth(h.GetDiff)).Methods("GET")
+
+	// Add a question
+	form.Pages[0].Widgets = append(form.Pages[0].Widgets, models.Widget{
+		Type: "short_answer", UID: "q2", Props: map[string]interface{}{"question": "Question second"}})
+	formJson, _ := json.Marshal(form)
+	recorder := httptest.NewRecorder()
+	r.ServeHTTP(recorder, requestAPI("PUT", "/api/form/"+id, formJson))
+	if status := recorder.Code; status != http.StatusOK {
+		t.Fatalf("Status code differs. Expected %d Got %d instead", http.StatusOK, status)
+	}
+
+	// Both versions are listed
+	recorder = httptest.NewRecorder()
+	r.ServeHTTP(recorder, requestAPI("GET", "/api/form/"+id+"/revisions", nil))
+	var revisions []struct {
+		Version int
+		Current bool
+	}
+	json.NewDecoder(recorder.Body).Decode(&revisions)
+	if len(revisions) != 2 || revisions[0].Version != 1 || !revisions[1].Current {
+		t.Errorf("Unexpected revisions %v", revisions)
+	}
+
+	// The diff shows the new question
+	recorder = httptest.NewRecorder()
+	r.ServeHTTP(recorder, requestAPI("GET", "/api/form/"+id+"/diff?from=1&to=2", nil))
+	var diff struct {
+		Widgets []struct{ UID, Change string }
+	}
+	json.NewDecoder(recorder.Body).Decode(&diff)
+	if len(diff.Widgets) != 1 || diff.Widgets[0].UID != "q2" || diff.Widgets[0].Change != "added" {
+		t.Errorf("Unexpected diff %v", diff)
+	}
+
+	// Restoring saves the old content as a new version
+	recorder = httptest.NewRecorder()
+	r.ServeHTTP(recorder, requestAPI("POST", "/api/form/"+id+"/revisions/1/restore", nil))
+	if status := recorder.Code; status != http.StatusOK {
+		t.Errorf("Status code differs. Expected %d Got %d instead", http.StatusOK, status)
+	}
+	dbForm, _ := db.FindForm(context.Background(), id)
+	if dbForm.Version != 3 || len(dbForm.Pages[0].Widgets) != 1 {
+		t.Errorf("Form not restored: %+v", dbForm)
+	}
+	if revisions, _ := db.FindRevisions(context.Background(), id); len(revisions) != 2 {
+		t.Errorf("Expected 2 revisions, got %d", len(revisions))
+	}
+}
+
+// Tests that exports keep answers to removed and reworded questions
+func TestMixedRevisionExport(t *testing.T) {
+	form := createDummyForm()
+	form.Creator = rno
+	form.RequireLogin = false
+	form.SingleResponse = false
+	form.Version = 1
+	form.Pages[0].Widgets = append(form.Pages[0].Widgets, models.Widget{
+		Type: "short_answer", UID: "q2", Props: map[string]interface{}{"question": "Question second"}})
+	id, _ := db.InsertForm(context.Background(), &form)
+	db.InsertResponse(context.Background(), &models.FormResponse{
+		FormID: id, Version: 1, Responses: map[string]interface{}{"q1": "A", "q2": "B"}})
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/form/{id}", h.RequireAuth(h.CreateForm)).Methods("PUT")
+	r.HandleFunc("/api/form/{id}/publish", h.RequireAuth(h.PublishForm)).Methods("POST")
+	r.HandleFunc("/api/response/{formid}", h.OptionalAuth(h.CreateResponse))
+	r.HandleFunc("/api/responses/{formid}", h.OptionalAuth(h.ResultsAccess(h.GetResponses)))
+
+	// Reword the first question and replace the second
+	form.Pages[0].Widgets[0].Props["question"] = "Renamed"
+	form.Pages[0].Widgets[1] = models.Widget{
+		Type: "short_answer", UID: "q3", Props: map[string]interface{}{"question": "Question third"}}
+	formJson, _ := json.Marshal(form)
+	recorder := httptest.NewRecorder()
+	r.ServeHTTP(recorder, requestAPI("PUT", "/api/form/"+id, formJson))
+	if status := recorder.Code; status != http.StatusOK {
+		t.Fatalf("Status code differs. Expected %d Got %d instead", http.StatusOK, status)
+	}
+	recorder = httptest.NewRecorder()
+	r.ServeHTTP(recorder, requestAPI("POST", "/api/form/"+id+"/publish", nil))
+	if status := recorder.Code; status != http.StatusOK {
+		t.Fatalf("Status code differs. Expected %d Got %d instead", http.StatusOK, status)
+	}
+
+	// New responses are bound to the published version
+	recorder = httptest.NewRecorder()
+	r.ServeHTTP(recorder, requestAPI("POST", "/api/response/"+id, []byte(`{"responses": {"q1": "C", "q3": "D"}}`)))
+	if status := recorder.Code; status != http.StatusOK {
+		t.Errorf("Status code differs. Expected %d Got %d instead", http.StatusOK, status)
+	}
+	responses, _ := db.FindResponses(context.Background(), id)
+	if len(responses) != 2 || responses[1].Version != 3 {
+		t.Fatalf("Response not bound to version 3: %+v", responses)
+	}
+
+	recorder = httptest.NewRecorder()
+	r.ServeHTTP(recorder, requestAPI("POST", "/api/responses/"+id, []byte(`{"type":"array"}`)))
+	var rows [][]string
+	json.NewDecoder(recorder.Body).Decode(&rows)
+
+	expected := [][]string{
+		{"Timestamp", `Renamed (previously "Question first")`, "Question third", "Question second (removed)",
+			"Form Version", "Reworded Questions"},
+		{"", "A", "", "B", "1", `Renamed: asked as "Question first"`},
+		{"", "C", "D", "", "3", ""},
+	}
+	if len(rows) != len(expected) {
+		t.Fatalf("Unexpected array response %v", rows)
+	}
+	for i := range expected {
+		for j := range expected[i] {
+			// Timestamps vary
+			if j > 0 && rows[i][j] != expected[i][j] {
+				t.Errorf("Cell %d,%d differs. Expected %q Got %q", i, j, expected[i][j], rows[i][j])
+			}
+		}
+	}
+}
+
+// Tests that respondents only see forms once published and edits stay in the draft
+func TestDraftPublish(t *testing.T) {
+	form := createDummyForm()
+	form.RequireLogin = false
+	form.SingleResponse = false
+	form.Pages[0].Title = "Draft Form"
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/form", h.RequireAuth(h.CreateForm)).Methods("POST")
+	r.HandleFunc("/api/form/{id}", h.RequireAuth(h.CreateForm)).Methods("PUT")
+	r.HandleFunc("/api/form/{id}", h.OptionalAuth(h.GetForm)).Methods("GET")
+	r.HandleFunc("/api/form/{id}/publish", h.RequireAuth(h.PublishForm)).Methods("POST")
+	r.HandleFunc("/api/response/{formid}", h.OptionalAuth(h.CreateResponse))
+
+	name := func(request *http.Request) (string, bool) {
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, request)
+		var res struct {
+			Name     string
+			HasDraft bool `json:"has_draft"`
+		}
+		json.NewDecoder(recorder.Body).Decode(&res)
+		return res.Name, res.HasDraft
+	}
+
+	// New forms are drafts
+	formJson, _ := json.Marshal(form)
+	recorder := httptest.NewRecorder()
+	r.ServeHTTP(recorder, requestAPI("POST", "/api/form", formJson))
+	var created struct {
+		ID     string
+		Status string
+	}
+	json.NewDecoder(recorder.Body).Decode(&created)
+	if created.Status != models.StatusDraft {
+		t.Errorf("Expected draft, got %q", created.Status)
+	}
+	id := created.ID
+	if code := serve(r, "", "GET", "/api/form/"+id, "").Code; code != http.StatusNotFound {
+		t.Errorf("Status code differs. Expected %d Got %d instead", http.StatusNotFound, code)
+	}
+	if code := serve(r, "", "POST", "/api/response/"+id, string(createDummyResponse(form))).Code; code != http.StatusForbidden {
+		t.Errorf("Status code differs. Expected %d Got %d instead", http.StatusForbidden, code)
+	}
+
+	// Publish
+	recorder = httptest.NewRecorder()
+	r.ServeHTTP(recorder, requestAPI("POST", "/api/form/"+id+"/publish", nil))
+	if status := recorder.Code; status != http.StatusOK {
+		t.Errorf("Status code differs. Expected %d Got %d instead", http.StatusOK, status)
+	}
+	if code := serve(r, "", "POST", "/api/response/"+id, string(createDummyResponse(form))).Code; code != http.StatusOK {
+		t.Errorf("Status code differs. Expected %d Got %d instead", http.StatusOK, code)
+	}
+
+	// Edits go to the draft
+	form.Version = 2
+	form.Pages[0].Title = "Edited Form"
+	formJson, _ = json.Marshal(form)
+	recorder = httptest.NewRecorder()
+	r.ServeHTTP(recorder, requestAPI("PUT", "/api/form/"+id, formJson))
+	if status := recorder.Code; status != http.StatusOK {
+		t.Errorf("Status code differs. Expected %d Got %d instead", http.StatusOK, status)
+	}
+	anon, _ := http.NewRequest("GET", "/api/form/"+id, nil)
+	if n, _ := name(anon); n != "Draft Form" {
+		t.Errorf("Respondent sees %q", n)
+	}
+	if n, draft := name(requestAPI("GET", "/api/form/"+id, nil)); n != "Edited Form" || !draft {
+		t.Errorf("Creator sees %q with draft %v", n, draft)
+	}
+	if n, _ := name(requestAPI("GET", "/api/form/"+id+"?view=published", nil)); n != "Draft Form" {
+		t.Errorf("Creator preview of published form shows %q", n)
+	}
+
+	// Publishing the draft makes it live
+	recorder = httptest.NewRecorder()
+	r.ServeHTTP(recorder, requestAPI("POST", "/api/form/"+id+"/publish", nil))
+	anon, _ = http.NewRequest("GET", "/api/form/"+id, nil)
+	if n, draft := name(anon); n != "Edited Form" || draft {
+		t.Errorf("Respondent sees %q with draft %v", n, draft)
+	}
+}
+
+// Tests that edits to the draft of a published form are diffed and restored
+func TestDraftHistory(t *testing.T) {
+	form := createDummyForm()
+	form.Pages[0].Title = "Published"
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/form", h.RequireAuth(h.CreateForm)).Methods("POST")
+	r.HandleFunc("/api/form/{id}", h.RequireAuth(h.CreateForm)).Methods("PUT")
+	r.HandleFunc("/api/form/{id}", h.OptionalAuth(h.GetForm)).Methods("GET")
+	r.HandleFunc("/api/form/{id}/publish", h.RequireAuth(h.PublishForm)).Methods("POST")
+	r.HandleFunc("/api/form/{id}/diff", h.RequireAuth(h.GetDiff)).Methods("GET")
+	r.HandleFunc("/api/form/{id}/revisions/{version}/restore", h.RequireAuth(h.RestoreRevision)).Methods("POST")
+
+	save := func(title string, version int) {
+		form.Pages[0].Title = title
+		form.Version = version
+		formJson, _ := json.Marshal(form)
+		if recorder := serve(r, rno, "PUT", "/api/form/"+form.ID, string(formJson)); recorder.Code != http.StatusOK {
+			t.Fatalf("Expected save of %q, got %d", title, recorder.Code)
+		}
+	}
+
+	formJson, _ := json.Marshal(form)
+	var created struct{ ID string }
+	json.NewDecoder(serve(r, rno, "POST", "/api/form", string(formJson)).Body).Decode(&created)
+	form.ID = created.ID
+	serve(r, rno, "POST", "/api/form/"+form.ID+"/publish", "")
+
+	// Versions 3 and 4 are edits to the draft
+	save("First edit", 2)
+	save("Second edit", 3)
+	recorder := serve(r, rno, "GET", "/api/form/"+form.ID+"/diff", "")
+	var d struct {
+		Pages []struct {
+			Fields []struct{ From, To interface{} }
+		}
+	}
+	json.NewDecoder(recorder.Body).Decode(&d)
+	if len(d.Pages) != 1 || d.Pages[0].Fields[0].From != "First edit" || d.Pages[0].Fields[0].To != "Second edit" {
+		t.Errorf("Unexpected diff of draft edits %+v", d)
+	}
+
+	// Restoring brings back the draft saved then, not the published content
+	if recorder := serve(r, rno, "POST", "/api/form/"+form.ID+"/revisions/3/restore", ""); recorder.Code != http.StatusOK {
+		t.Fatalf("Expected restore, got %d", recorder.Code)
+	}
+	var restored struct {
+		Pages    []models.Page
+		HasDraft bool `json:"has_draft"`
+	}
+	json.NewDecoder(serve(r, rno, "GET", "/api/form/"+form.ID, "").Body).Decode(&restored)
+	if !restored.HasDraft || restored.Pages[0].Title != "First edit" {
+		t.Errorf("Unexpected restored draft %+v", restored)
+	}
+	json.NewDecoder(serve(r, rno, "GET", "/api/form/"+form.ID+"?view=published", "").Body).Decode(&restored)
+	if restored.Pages[0].Title != "Published" {
+		t.Errorf("Restore changed the published form %+v", restored)
+	}
+}
+
+// Tests that responses are only accepted while the form is open
+func TestFormSchedule(t *testing.T) {
+	form := createDummyForm()
+	form.RequireLogin = false
+	form.SingleResponse = false
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/form/{id}", h.OptionalAuth(h.GetForm))
+	r.HandleFunc("/api/response/{formid}", h.OptionalAuth(h.CreateResponse))
+
+	tests := []struct {
+		open, close models.NullTime
+		closed      bool
+		reason      string
+	}{
+		{reason: ""},
+		{open: models.At(time.Now().Add(time.Hour)), reason: models.NotYetOpen},
+		{close: models.At(time.Now().Add(-time.Hour)), reason: models.ClosedBySchedule},
+		{open: models.At(time.Now().Add(-time.Hour)), close: models.At(time.Now().Add(time.Hour)), reason: ""},
+		{closed: true, reason: models.ClosedManually},
+	}
+	for _, test := range tests {
+		form.OpenOn, form.CloseOn, form.IsClosed = test.open, test.close, test.closed
+		id, _ := db.InsertForm(context.Background(), &form)
+
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, requestAPI("GET", "/api/form/"+id, nil))
+		var res models.Form
+		json.NewDecoder(recorder.Body).Decode(&res)
+		if res.Availability == nil || res.Availability.Reason != test.reason || res.Availability.Open != (test.reason == "") {
+			t.Errorf("Unexpected availability %+v, expected %q", res.Availability, test.reason)
+		}
+
+		expected := http.StatusOK
+		if test.reason != "" {
+			expected = http.StatusNotFound
+		}
+		recorder = httptest.NewRecorder()
+		r.ServeHTTP(recorder, requestAPI("POST", "/api/response/"+id, createDummyResponse(form)))
+		if status := recorder.Code; status != expected {
+			t.Errorf("Status code differs. Expected %d Got %d instead", expected, status)
+		}
+		var msg struct{ Reason string }
+		json.NewDecoder(recorder.Body).Decode(&msg)
+		if msg.Reason != test.reason {
+			t.Errorf("Expected reason %q, got %q", test.reason, msg.Reason)
+		}
+	}
+}
+
+// Tests that response limits and option capacities are enforced and reported
+func TestResponseQuota(t *testing.T) {
+	form := createDummyForm()
+	form.RequireLogin = false
+	form.SingleResponse = false
+	form.ResponseLimit = 2
+	form.Pages[0].Widgets = []models.Widget{{Type: "multiple_choice", UID: "workshop", Props: map[string]interface{}{
+		"question": "Workshop", "options": []interface{}{"A", "B"}, "capacity": map[string]interface{}{"A": 1.0}}}}
+	id, _ := db.InsertForm(context.Background(), &form)
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/form/{id}", h.OptionalAuth(h.GetForm))
+	r.HandleFunc("/api/response/{formid}", h.OptionalAuth(h.CreateResponse))
+
+	respond := func(option string, expected int) {
+		recorder := httptest.NewRecorder()
+		body := []byte(`{"responses": {"workshop": "` + option + `"}}`)
+		r.ServeHTTP(recorder, requestAPI("POST", "/api/response/"+id, body))
+		if status := recorder.Code; status != expected {
+			t.Errorf("Status code differs. Expected %d Got %d instead", expected, status)
+		}
+	}
+	respond("A", http.StatusOK)
+	respond("A", http.StatusConflict)
+
+	// Places left are shown
+	recorder := httptest.NewRecorder()
+	r.ServeHTTP(recorder, requestAPI("GET", "/api/form/"+id, nil))
+	var res models.Form
+	json.NewDecoder(recorder.Body).Decode(&res)
+	if a := res.Availability; a == nil || *a.Remaining != 1 || a.RemainingChoices["workshop"]["A"] != 0 {
+		t.Errorf("Unexpected availability %+v", a)
+	}
+
+	// The limit closes the form
+	respond("B", http.StatusOK)
+	respond("B", http.StatusNotFound)
+	recorder = httptest.NewRecorder()
+	r.ServeHTTP(recorder, requestAPI("GET", "/api/form/"+id, nil))
+	json.NewDecoder(recorder.Body).Decode(&res)
+	if res.Availability.Reason != models.QuotaReached {
+		t.Errorf("Unexpected availability %+v", res.Availability)
+	}
+}
+
+// Tests that limits added to forms with responses from before counters were
+// kept count those responses, and that administrators can recount lost places
+func TestLegacyQuota(t *testing.T) {
+	c.Admins = []string{"admin"}
+	defer func() { c.Admins = nil }()
+
+	form := createDummyForm()
+	form.RequireLogin = false
+	form.SingleResponse = false
+	form.Pages[0].Widgets = []models.Widget{{Type: "multiple_choice", UID: "workshop", Props: map[string]interface{}{
+		"question": "Workshop", "options": []interface{}{"A", "B"}}}}
+	id, _ := db.InsertForm(context.Background(), &form)
+	for _, option := range []string{"A", "B"} {
+		db.InsertResponse(context.Background(), &models.FormResponse{FormID: id,
+			Responses: map[string]interface{}{"workshop": option}})
+	}
+
+	// The limits are added later
+	form.ResponseLimit = 3
+	form.Pages[0].Widgets[0].Props["capacity"] = map[string]interface{}{"A": 1.0}
+	db.ReplaceForm(context.Background(), id, form.Creator, form.Version, &form)
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/response/{formid}", h.OptionalAuth(h.CreateResponse))
+	r.HandleFunc("/api/admin/forms/{id}/recount", h.RequireAuth(h.AdminRecountForm))
+
+	respond := func(option string, expected int) {
+		recorder := httptest.NewRecorder()
+		body := []byte(`{"responses": {"workshop": "` + option + `"}}`)
+		r.ServeHTTP(recorder, requestAPI("POST", "/api/response/"+id, body))
+		if status := recorder.Code; status != expected {
+			t.Errorf("Status code differs. Expected %d Got %d instead", expected, status)
+		}
+	}
+	respond("A", http.StatusConflict)
+	respond("B", http.StatusOK)
+	respond("B", http.StatusNotFound)
+
+	// A place lost by an interrupted submission is found again
+	db.SetCounts(context.Background(), id, map[string]int{models.ResponsesCounter: 4,
+		models.ChoiceCounter("workshop", "A"): 1, models.ChoiceCounter("workshop", "B"): 2}, nil)
+	responses, _ := db.FindResponses(context.Background(), id)
+	db.DeleteResponse(context.Background(), id, responses[2].ID)
+	recorder := serve(r, "admin", "POST", "/api/admin/forms/"+id+"/recount", "")
+	var counts map[string]int
+	json.NewDecoder(recorder.Body).Decode(&counts)
+	if recorder.Code != http.StatusOK || counts[models.ResponsesCounter] != 2 {
+		t.Errorf("Unexpected recount %d %v", recorder.Code, counts)
+	}
+	respond("B", http.StatusOK)
+}
+
+// Tests that responses over the limit wait for a place
+func TestWaitlist(t *testing.T) {
+	form := createDummyForm()
+	form.Creator = rno
+	form.RequireLogin = false
+	form.SingleResponse = false
+	form.ResponseLimit = 1
+	form.Waitlist = true
+	id, _ := db.InsertForm(context.Background(), &form)
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/response/{formid}", h.OptionalAuth(h.CreateResponse))
+	r.HandleFunc("/api/responses/{formid}", h.OptionalAuth(h.ResultsAccess(h.GetResponses)))
+	r.HandleFunc("/api/form/{id}/responses/{rid}", h.RequireAuth(h.DeleteResponse)).Methods("DELETE")
+
+	// Second response is waitlisted
+	ids := []string{}
+	for _, expected := range []string{models.ResponseAccepted, models.ResponseWaitlisted} {
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, requestAPI("POST", "/api/response/"+id, createDummyResponse(form)))
+		var res struct{ ID, Status string }
+		json.NewDecoder(recorder.Body).Decode(&res)
+		if recorder.Code != http.StatusOK || res.Status != expected {
+			t.Errorf("Expected %s response, got %d %q", expected, recorder.Code, res.Status)
+		}
+		ids = append(ids, res.ID)
+	}
+
+	// Status is exported
+	recorder := httptest.NewRecorder()
+	r.ServeHTTP(recorder, requestAPI("POST", "/api/responses/"+id, []byte(`{"type":"array"}`)))
+	var rows [][]string
+	json.NewDecoder(recorder.Body).Decode(&rows)
+	if len(rows) != 3 || rows[0][2] != "Status" || rows[1][2] != "accepted" || rows[2][2] != "waitlisted" {
+		t.Errorf("Unexpected array response %v", rows)
+	}
+
+	// Deleting the accepted response promotes the waitlisted one
+	recorder = httptest.NewRecorder()
+	r.ServeHTTP(recorder, requestAPI("DELETE", "/api/form/"+id+"/responses/"+ids[0], nil))
+	if status := recorder.Code; status != http.StatusOK {
+		t.Errorf("Status code differs. Expected %d Got %d instead", http.StatusOK, status)
+	}
+	responses, _ := db.FindResponses(context.Background(), id)
+	if len(responses) != 1 || responses[0].ID != ids[1] || responses[0].Status != models.ResponseAccepted {
+		t.Errorf("Waitlisted response not promoted: %+v", responses)
+	}
+}
+
+func TestSlotBooking(t *testing.T) {
+	form := createDummyForm()
+	form.Creator = rno
+	form.RequireLogin = false
+	form.SingleResponse = false
+	form.Pages[0].Widgets = append(form.Pages[0].Widgets, models.Widget{Type: "slot", UID: "viva",
+		Props: map[string]interface{}{"question": "Viva", "slots": []interface{}{
+			map[string]interface{}{"id": "a", "start": "2030-01-07T10:00:00Z", "end": "2030-01-07T10:30:00Z", "capacity": 3},
+			map[string]interface{}{"id": "b", "start": "2030-01-07T10:30:00Z", "end": "2030-01-07T11:00:00Z", "capacity": 1},
+		}}})
+	id, _ := db.InsertForm(context.Background(), &form)
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/response/{formid}", h.OptionalAuth(h.CreateResponse))
+	r.HandleFunc("/api/form/{id}/schedule", h.RequireAuth(h.GetSchedule))
+	r.HandleFunc("/api/form/{id}/responses/{rid}/slot", h.RequireAuth(h.MoveBooking))
+
+	// Concurrent bookings never overfill a slot
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	ids := []string{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			recorder := httptest.NewRecorder()
+			r.ServeHTTP(recorder, requestAPI("POST", "/api/response/"+id, []byte(`{"responses":{"viva":"a"}}`)))
+			var res struct{ ID string }
+			json.NewDecoder(recorder.Body).Decode(&res)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if recorder.Code == http.StatusOK {
+				ids = append(ids, res.ID)
+			} else if recorder.Code != http.StatusConflict {
+				t.Errorf("Unexpected status %d", recorder.Code)
+			}
+		}()
+	}
+	wg.Wait()
+	if len(ids) != 3 {
+		t.Fatalf("Expected 3 bookings, got %d", len(ids))
+	}
+
+	// Move a booking to the other slot, which is then full
+	for i, expected := range []int{http.StatusOK, http.StatusConflict} {
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, requestAPI("POST", "/api/form/"+id+"/responses/"+ids[i]+"/slot",
+			[]byte(`{"uid":"viva","slot":"b"}`)))
+		if recorder.Code != expected {
+			t.Errorf("Expected move status %d, got %d", expected, recorder.Code)
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	r.ServeHTTP(recorder, requestAPI("GET", "/api/form/"+id+"/schedule", nil))
+	var schedule []struct {
+		UID   string
+		Slots []struct {
+			ID        string
+			Booked    int
+			Remaining int
+			Bookings  []struct{ ID string }
+		}
+	}
+	json.NewDecoder(recorder.Body).Decode(&schedule)
+	if len(schedule) != 1 || len(schedule[0].Slots) != 2 {
+		t.Fatalf("Unexpected schedule %+v", schedule)
+	}
+	a, b := schedule[0].Slots[0], schedule[0].Slots[1]
+	if a.Booked != 2 || a.Remaining != 1 || len(a.Bookings) != 2 ||
+		b.Booked != 1 || b.Remaining != 0 || len(b.Bookings) != 1 || b.Bookings[0].ID != ids[0] {
+		t.Errorf("Unexpected schedule %+v", schedule)
+	}
+
+	// Withdrawn bookings cannot be moved back into a slot
+	_, err := db.WithdrawResponse(context.Background(), id, ids[1])
+	checkError(err, t)
+	recorder = httptest.NewRecorder()
+	r.ServeHTTP(recorder, requestAPI("POST", "/api/form/"+id+"/responses/"+ids[1]+"/slot",
+		[]byte(`{"uid":"viva","slot":"a"}`)))
+	if recorder.Code != http.StatusGone {
+		t.Errorf("Expected withdrawn booking to stay withdrawn, got %d", recorder.Code)
+	}
+	if counts, _ := db.FindCounts(context.Background(), id); counts[models.ChoiceCounter("viva", "a")] != 1 {
+		t.Errorf("Withdrawn booking counted again %v", counts)
+	}
+}
+
+// Tests that respondents see and edit their own response by link or login
+func TestEditOwnResponse(t *testing.T) {
+	form := createDummyForm()
+	form.RequireLogin = false
+	form.SingleResponse = false
+	form.AllowEdit = true
+	id, _ := db.InsertForm(context.Background(), &form)
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/response/{formid}", h.OptionalAuth(h.CreateResponse)).Methods("POST")
+	r.HandleFunc("/api/response/{formid}/{rid}", h.OptionalAuth(h.GetOwnResponse)).Methods("GET")
+	r.HandleFunc("/api/response/{formid}/{rid}", h.OptionalAuth(h.EditOwnResponse)).Methods("PUT")
+
+	recorder := httptest.NewRecorder()
+	r.ServeHTTP(recorder, requestAPI("POST", "/api/response/"+id, createDummyResponse(form)))
+	var created struct {
+		ID        string
+		EditToken string `json:"edit_token"`
+	}
+	json.NewDecoder(recorder.Body).Decode(&created)
+	if recorder.Code != http.StatusOK || created.EditToken == "" {
+		t.Fatalf("Expected edit token, got %d %+v", recorder.Code, created)
+	}
+
+	// The link works without login, for its own response only
+	link := "/api/response/" + id + "/" + created.ID + "?token=" + created.EditToken
+	if recorder := serve(r, "", "GET", link, ""); recorder.Code != http.StatusOK {
+		t.Errorf("Expected own response, got %d", recorder.Code)
+	}
+	if recorder := serve(r, "", "GET", "/api/response/"+id+"/other?token="+created.EditToken, ""); recorder.Code != http.StatusNotFound {
+		t.Errorf("Expected token to be refused for another response, got %d", recorder.Code)
+	}
+
+	// Edits keep the earlier answers
+	recorder = serve(r, "", "PUT", link, `{"responses":{"q1":"Changed"}}`)
+	var edited models.FormResponse
+	json.NewDecoder(recorder.Body).Decode(&edited)
+	if recorder.Code != http.StatusOK || edited.Responses["q1"] != "Changed" ||
+		len(edited.Edits) != 1 || edited.Edits[0].Responses["q1"] != "Answer" {
+		t.Errorf("Unexpected edit %d %+v", recorder.Code, edited)
+	}
+	if recorder := serve(r, "", "PUT", link, `{"responses":{"q9":"Unknown"}}`); recorder.Code != 422 {
+		t.Errorf("Expected invalid edit to be refused, got %d", recorder.Code)
+	}
+
+	// Logged in respondents find their latest response
+	recorder = httptest.NewRecorder()
+	r.ServeHTTP(recorder, requestAPI("GET", "/api/response/"+id+"/mine", nil))
+	var mine models.FormResponse
+	json.NewDecoder(recorder.Body).Decode(&mine)
+	if recorder.Code != http.StatusOK || mine.ID != created.ID || mine.Responses["q1"] != "Changed" {
+		t.Errorf("Unexpected own response %d %+v", recorder.Code, mine)
+	}
+
+	// Closed forms and forms without editing refuse edits
+	form.ID = id
+	form.CloseOn = models.At(time.Now().Add(-time.Hour))
+	checkError(db.ReplaceForm(context.Background(), id, form.Creator, 0, &form), t)
+	if recorder := serve(r, "", "PUT", link, `{"responses":{"q1":"Late"}}`); recorder.Code != http.StatusNotFound {
+		t.Errorf("Expected closed form to refuse edit, got %d", recorder.Code)
+	}
+	form.CloseOn = models.NullTime{}
+	form.AllowEdit = false
+	checkError(db.ReplaceForm(context.Background(), id, form.Creator, form.Version, &form), t)
+	if recorder := serve(r, "", "PUT", link, `{"responses":{"q1":"Late"}}`); recorder.Code != http.StatusForbidden {
+		t.Errorf("Expected edit to be refused, got %d", recorder.Code)
+	}
+}
+
+func TestWithdrawResponse(t *testing.T) {
+	form := createDummyForm()
+	form.Creator = rno
+	form.ResponseLimit = 1
+	form.Waitlist = true
+	form.AllowWithdraw = true
+	id, _ := db.InsertForm(context.Background(), &form)
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/response/{formid}", h.OptionalAuth(h.CreateResponse)).Methods("POST")
+	r.HandleFunc("/api/response/{formid}/{rid}", h.OptionalAuth(h.WithdrawResponse)).Methods("DELETE")
+	r.HandleFunc("/api/form/{id}/audit", h.RequireAuth(h.GetAudit)).Methods("GET")
+
+	recorder := httptest.NewRecorder()
+	r.ServeHTTP(recorder, requestAPI("POST", "/api/response/"+id, createDummyResponse(form)))
+	var created struct {
+		ID            string
+		WithdrawToken string `json:"withdraw_token"`
+	}
+	json.NewDecoder(recorder.Body).Decode(&created)
+	if recorder.Code != http.StatusOK || created.WithdrawToken == "" {
+		t.Fatalf("Expected withdraw token, got %d %+v", recorder.Code, created)
+	}
+
+	// Someone else waits for the only place
+	waiting := &models.FormResponse{FormID: id, Timestamp: time.Now(), Status: models.ResponseWaitlisted,
+		Responses: map[string]interface{}{"q1": "Waiting"}}
+	_, err := db.InsertCountedResponse(context.Background(), waiting, nil, nil)
+	checkError(err, t)
+
+	// The link withdraws without login, freeing the place and the filler
+	link := "/api/response/" + id + "/" + created.ID + "?token=" + created.WithdrawToken
+	request, _ := http.NewRequest("DELETE", link, nil)
+	recorder = httptest.NewRecorder()
+	r.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected withdrawal, got %d", recorder.Code)
+	}
+	responses, _ := db.FindResponses(context.Background(), id)
+	if len(responses) != 1 || responses[0].Status != models.ResponseAccepted {
+		t.Errorf("Waitlisted response not promoted: %+v", responses)
+	}
+	if filled, _ := db.HasFilled(context.Background(), id, rno); filled {
+		t.Errorf("Filler kept after withdrawal")
+	}
+
+	// Tombstones are kept without answers, and only withdrawn once
+	form.ID = id
+	form.KeepWithdrawn = true
+	checkError(db.ReplaceForm(context.Background(), id, form.Creator, 0, &form), t)
+	recorder = httptest.NewRecorder()
+	r.ServeHTTP(recorder, requestAPI("POST", "/api/response/"+id, createDummyResponse(form)))
+	json.NewDecoder(recorder.Body).Decode(&created)
+	for _, expected := range []int{http.StatusOK, http.StatusGone} {
+		recorder = httptest.NewRecorder()
+		r.ServeHTTP(recorder, requestAPI("DELETE", "/api/response/"+id+"/mine", nil))
+		if recorder.Code != expected {
+			t.Errorf("Expected %d withdrawing by login, got %d", expected, recorder.Code)
+		}
+	}
+	kept, err := db.FindResponse(context.Background(), id, created.ID)
+	if err != nil || kept.Status != models.ResponseWithdrawn || len(kept.Responses) != 0 {
+		t.Errorf("Unexpected tombstone %v %+v", err, kept)
+	}
+
+	// The creator sees both withdrawals
+	recorder = httptest.NewRecorder()
+	r.ServeHTTP(recorder, requestAPI("GET", "/api/form/"+id+"/audit", nil))
+	var entries []models.AuditEntry
+	json.NewDecoder(recorder.Body).Decode(&entries)
+	if len(entries) != 2 || entries[0].Action != models.AuditWithdrawn || entries[1].Target != created.ID {
+		t.Errorf("Unexpected audit trail %+v", entries)
+	}
+}
+
+func TestCollaborators(t *testing.T) {
+	form := createDummyForm()
+	form.Creator = rno
+	id, _ := db.InsertForm(context.Background(), &form)
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/forms", h.RequireAuth(h.GetAllForms)).Methods("GET")
+	r.HandleFunc("/api/form/{id}", h.RequireAuth(h.CreateForm)).Methods("PUT")
+	r.HandleFunc("/api/form/{id}", h.OptionalAuth(h.GetForm)).Methods("GET")
+	r.HandleFunc("/api/form/{id}", h.RequireAuth(h.DeleteForm)).Methods("DELETE")
+	r.HandleFunc("/api/form/{id}/collaborators", h.RequireAuth(h.InviteCollaborator)).Methods("POST")
+	r.HandleFunc("/api/form/{id}/collaborators/{rno}", h.RequireAuth(h.ChangeCollaborator)).Methods("PUT")
+	r.HandleFunc("/api/form/{id}/collaborators/{rno}", h.RequireAuth(h.RemoveCollaborator)).Methods("DELETE")
+	r.HandleFunc("/api/responses/{formid}", h.OptionalAuth(h.ResultsAccess(h.GetResponses)))
+
+	collaborators := "/api/form/" + id + "/collaborators"
+	formJSON, _ := json.Marshal(form)
+
+	// Only valid invites of new collaborators by owners are taken
+	invites := []struct {
+		user, body string
+		code       int
+	}{
+		{rno, `{"rno":"editor","role":"editor"}`, http.StatusOK},
+		{rno, `{"rno":"viewer","role":"viewer"}`, http.StatusOK},
+		{rno, `{"rno":"editor","role":"viewer"}`, http.StatusConflict},
+		{rno, `{"rno":"other","role":"admin"}`, 422},
+		{rno, `{"rno":"` + rno + `","role":"editor"}`, 422},
+		{"editor", `{"rno":"other","role":"viewer"}`, http.StatusForbidden},
+		{"other", `{"rno":"other","role":"viewer"}`, http.StatusNotFound},
+	}
+	for _, invite := range invites {
+		if recorder := serve(r, invite.user, "POST", collaborators, invite.body); recorder.Code != invite.code {
+			t.Errorf("Expected %d inviting %s as %s, got %d", invite.code, invite.body, invite.user, recorder.Code)
+		}
+	}
+
+	// Editors edit but do not delete, viewers only see responses
+	checks := []struct {
+		user, method, api string
+		code              int
+	}{
+		{"editor", "PUT", "/api/form/" + id, http.StatusOK},
+		{"editor", "DELETE", "/api/form/" + id, http.StatusForbidden},
+		{"viewer", "PUT", "/api/form/" + id, http.StatusForbidden},
+		{"viewer", "POST", "/api/responses/" + id, http.StatusOK},
+		{"other", "POST", "/api/responses/" + id, http.StatusForbidden},
+		{"other", "PUT", "/api/form/" + id, http.StatusNotFound},
+	}
+	for _, check := range checks {
+		body := "{}"
+		if check.method == "PUT" {
+			body = string(formJSON)
+		}
+		if recorder := serve(r, check.user, check.method, check.api, body); recorder.Code != check.code {
+			t.Errorf("Expected %d for %s %s as %s, got %d", check.code, check.method, check.api,
+				check.user, recorder.Code)
+		}
+	}
+
+	for user, canEdit := range map[string]bool{"editor": true, "viewer": false} {
+		var got models.Form
+		json.NewDecoder(serve(r, user, "GET", "/api/form/"+id, "").Body).Decode(&got)
+		if got.CanEdit != canEdit || len(got.Collaborators) != 2 {
+			t.Errorf("Unexpected form for %s: can edit %v, collaborators %+v", user, got.CanEdit, got.Collaborators)
+		}
+	}
+
+	// Shared forms are listed with the role of the user
+	var forms []struct{ ID, Role string }
+	json.NewDecoder(serve(r, "viewer", "GET", "/api/forms", "").Body).Decode(&forms)
+	if len(forms) != 1 || forms[0].ID != id || forms[0].Role != models.RoleViewer {
+		t.Errorf("Unexpected shared forms %+v", forms)
+	}
+
+	// Owners change roles and remove collaborators, who may also leave
+	if recorder := serve(r, rno, "PUT", collaborators+"/viewer", `{"role":"owner"}`); recorder.Code != http.StatusOK {
+		t.Errorf("Expected role change, got %d", recorder.Code)
+	}
+	if recorder := serve(r, "viewer", "DELETE", collaborators+"/editor", ""); recorder.Code != http.StatusOK {
+		t.Errorf("Expected new owner to remove editor, got %d", recorder.Code)
+	}
+	if recorder := serve(r, "viewer", "DELETE", collaborators+"/viewer", ""); recorder.Code != http.StatusOK {
+		t.Errorf("Expected collaborator to leave, got %d", recorder.Code)
+	}
+	if recorder := serve(r, "editor", "PUT", "/api/form/"+id, string(formJSON)); recorder.Code != http.StatusNotFound {
+		t.Errorf("Expected removed editor to be refused, got %d", recorder.Code)
+	}
+
+	entries, _ := db.FindAudit(context.Background(), id)
+	if len(entries) != 5 || entries[2].Action != models.AuditCollaboratorSet || entries[2].Details["role"] != models.RoleOwner ||
+		entries[4].Action != models.AuditCollaboratorRemoved || entries[4].Actor != "viewer" {
+		t.Errorf("Unexpected audit trail %+v", entries)
+	}
+}
+
+func TestTransferForm(t *testing.T) {
+	form := createDummyForm()
+	form.Creator = rno
+	id, _ := db.InsertForm(context.Background(), &form)
+	checkError(db.UpsertUser(context.Background(), &models.Profile{RollNumber: "successor"}), t)
+	checkError(db.SetCollaborator(context.Background(), id,
+		&models.Collaborator{RollNumber: "successor", Role: models.RoleEditor}), t)
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/transfers", h.RequireAuth(h.GetTransfers)).Methods("GET")
+	r.HandleFunc("/api/form/{id}/transfer", h.RequireAuth(h.OfferTransfer)).Methods("POST")
+	r.HandleFunc("/api/form/{id}/transfer", h.RequireAuth(h.CancelTransfer)).Methods("DELETE")
+	r.HandleFunc("/api/form/{id}/transfer/accept", h.RequireAuth(h.AcceptTransfer)).Methods("POST")
+
+	transfer := "/api/form/" + id + "/transfer"
+
+	// Forms go to registered users only
+	if recorder := serve(r, rno, "POST", transfer, `{"rno":"unknown"}`); recorder.Code != 422 {
+		t.Errorf("Expected unregistered user to be refused, got %d", recorder.Code)
+	}
+	if recorder := serve(r, rno, "POST", transfer, `{"rno":"successor","keep_role":"viewer"}`); recorder.Code != http.StatusOK {
+		t.Fatalf("Expected offer, got %d", recorder.Code)
+	}
+	var pending []models.Transfer
+	json.NewDecoder(serve(r, "successor", "GET", "/api/transfers", "").Body).Decode(&pending)
+	if len(pending) != 1 || pending[0].FormID != id || pending[0].From != rno {
+		t.Errorf("Unexpected pending transfers %+v", pending)
+	}
+
+	// Only the user offered the form accepts it
+	if recorder := serve(r, "other", "POST", transfer+"/accept", ""); recorder.Code != http.StatusNotFound {
+		t.Errorf("Expected other user to be refused, got %d", recorder.Code)
+	}
+	if recorder := serve(r, rno, "POST", transfer+"/accept", ""); recorder.Code != http.StatusForbidden {
+		t.Errorf("Expected owner to be refused, got %d", recorder.Code)
+	}
+	if recorder := serve(r, "successor", "POST", transfer+"/accept", ""); recorder.Code != http.StatusOK {
+		t.Fatalf("Expected acceptance, got %d", recorder.Code)
+	}
+	got, _ := db.FindForm(context.Background(), id)
+	if got.Creator != "successor" || got.RoleOf(rno) != models.RoleViewer || len(got.Collaborators) != 1 {
+		t.Errorf("Unexpected form after transfer: creator %s, collaborators %+v", got.Creator, got.Collaborators)
+	}
+	if _, err := db.FindTransfer(context.Background(), id); err != store.ErrNotFound {
+		t.Errorf("Transfer still pending after acceptance")
+	}
+	if recorder := serve(r, rno, "POST", transfer, `{"rno":"successor"}`); recorder.Code != http.StatusForbidden {
+		t.Errorf("Expected previous creator to be refused, got %d", recorder.Code)
+	}
+
+	// Offers can be declined
+	serve(r, "successor", "POST", transfer, `{"rno":"`+rno+`"}`)
+	if recorder := serve(r, rno, "DELETE", transfer, ""); recorder.Code != http.StatusOK {
+		t.Errorf("Expected decline, got %d", recorder.Code)
+	}
+
+	entries, _ := db.FindAudit(context.Background(), id)
+	expected := []string{models.AuditTransferOffered, models.AuditTransferred, models.AuditTransferOffered,
+		models.AuditTransferCancelled}
+	if fmt.Sprint(auditActions(id)) != fmt.Sprint(expected) || entries[1].Target != rno {
+		t.Errorf("Unexpected audit trail %+v", entries)
+	}
+}
+
+func TestAdmin(t *testing.T) {
+	c.Admins = []string{"admin"}
+	defer func() { c.Admins = nil }()
+
+	// Other tests may have audited the site before
+	before, _ := db.FindAudit(context.Background(), "")
+
+	form := createDummyForm()
+	form.Creator = "abuser"
+	form.Name = "Spam Form"
+	form.RequireLogin = false
+	form.SingleResponse = false
+	id, _ := db.InsertForm(context.Background(), &form)
+	db.InsertCountedResponse(context.Background(), &models.FormResponse{FormID: id},
+		[]store.Quota{{Key: models.ResponsesCounter}}, nil)
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/form/{id}", h.OptionalAuth(h.GetForm)).Methods("GET")
+	r.HandleFunc("/api/form/{id}", h.RequireAuth(h.CreateForm)).Methods("PUT")
+	r.HandleFunc("/api/response/{formid}", h.OptionalAuth(h.CreateResponse)).Methods("POST")
+	r.HandleFunc("/api/admin/forms", h.RequireAuth(h.SearchForms)).Methods("GET")
+	r.HandleFunc("/api/admin/forms/{id}", h.RequireAuth(h.AdminGetForm)).Methods("GET")
+	r.HandleFunc("/api/admin/forms/{id}", h.RequireAuth(h.AdminDeleteForm)).Methods("DELETE")
+	r.HandleFunc("/api/admin/forms/{id}/close", h.RequireAuth(h.AdminCloseForm)).Methods("POST")
+	r.HandleFunc("/api/admin/forms/{id}/reopen", h.RequireAuth(h.AdminReopenForm)).Methods("POST")
+	r.HandleFunc("/api/admin/users/{rno}/stats", h.RequireAuth(h.AdminUserStats)).Methods("GET")
+	r.HandleFunc("/api/admin/users/{rno}/admin", h.RequireAuth(h.SetAdmin)).Methods("PUT")
+	r.HandleFunc("/api/admin/audit", h.RequireAuth(h.GetSiteAudit)).Methods("GET")
+
+	if recorder := serve(r, rno, "GET", "/api/admin/forms", ""); recorder.Code != http.StatusForbidden {
+		t.Errorf("Expected non administrator to be refused, got %d", recorder.Code)
+	}
+	var found []struct{ ID, Creator string }
+	json.NewDecoder(serve(r, "admin", "GET", "/api/admin/forms?q=spam", "").Body).Decode(&found)
+	if len(found) != 1 || found[0].ID != id || found[0].Creator != "abuser" {
+		t.Errorf("Unexpected search result %+v", found)
+	}
+	if recorder := serve(r, "admin", "GET", "/api/admin/forms/"+id, ""); recorder.Code != http.StatusOK {
+		t.Errorf("Expected administrator to read form, got %d", recorder.Code)
+	}
+
+	// Closed forms are taken down until an administrator reopens them
+	if recorder := serve(r, "admin", "POST", "/api/admin/forms/"+id+"/close", `{"reason":"spam"}`); recorder.Code != http.StatusOK {
+		t.Fatalf("Expected form to be closed, got %d", recorder.Code)
+	}
+	if recorder := serve(r, "someone", "GET", "/api/form/"+id, ""); recorder.Code != http.StatusNotFound {
+		t.Errorf("Expected closed form to be hidden, got %d", recorder.Code)
+	}
+	if recorder := serve(r, "someone", "POST", "/api/response/"+id, string(createDummyResponse(form))); recorder.Code != http.StatusNotFound {
+		t.Errorf("Expected closed form to refuse responses, got %d", recorder.Code)
+	}
+	current, _ := db.FindForm(context.Background(), id)
+	current.Suspended = false
+	formJSON, _ := json.Marshal(current)
+	serve(r, "abuser", "PUT", "/api/form/"+id, string(formJSON))
+	if current, _ = db.FindForm(context.Background(), id); !current.Suspended {
+		t.Errorf("Owner reopened a form closed by an administrator")
+	}
+	serve(r, "admin", "POST", "/api/admin/forms/"+id+"/reopen", "")
+	if current, _ = db.FindForm(context.Background(), id); current.Suspended {
+		t.Errorf("Form not reopened")
+	}
+
+	var stats struct{ Forms, Responses int }
+	json.NewDecoder(serve(r, "admin", "GET", "/api/admin/users/abuser/stats", "").Body).Decode(&stats)
+	if stats.Forms != 1 || stats.Responses != 1 {
+		t.Errorf("Unexpected usage %+v", stats)
+	}
+
+	// Administrators can be made from registered users
+	if recorder := serve(r, "admin", "PUT", "/api/admin/users/"+rno+"/admin", `{"admin":true}`); recorder.Code != http.StatusOK {
+		t.Errorf("Expected administrator to be made, got %d", recorder.Code)
+	}
+	if recorder := serve(r, rno, "DELETE", "/api/admin/forms/"+id, `{"reason":"spam"}`); recorder.Code != http.StatusOK {
+		t.Errorf("Expected new administrator to delete form, got %d", recorder.Code)
+	}
+	serve(r, rno, "PUT", "/api/admin/users/"+rno+"/admin", `{"admin":false}`)
+	if _, err := db.FindForm(context.Background(), id); err != store.ErrNotFound {
+		t.Errorf("Form still present after delete")
+	}
+
+	// Every action is audited, on the form or the site
+	entries, _ := db.FindAudit(context.Background(), id)
+	expected := []string{models.AuditAdminViewed, models.AuditAdminClosed, models.AuditAdminReopened,
+		models.AuditAdminDeleted}
+	if fmt.Sprint(auditActions(id)) != fmt.Sprint(expected) || entries[1].Details["reason"] != "spam" {
+		t.Errorf("Unexpected form audit trail %+v", entries)
+	}
+	var site []models.AuditEntry
+	json.NewDecoder(serve(r, "admin", "GET", "/api/admin/audit", "").Body).Decode(&site)
+	expected = []string{models.AuditAdminSearched, models.AuditAdminViewed, models.AuditAdminClosed,
+		models.AuditAdminReopened, models.AuditAdminStats, models.AuditAdminSet, models.AuditAdminDeleted,
+		models.AuditAdminSet}
+	if actions := auditActions(""); len(site) != len(actions) ||
+		fmt.Sprint(actions[len(before):]) != fmt.Sprint(expected) {
+		t.Errorf("Unexpected site audit trail %+v", site)
+	}
+	site = site[len(before):]
+
+	// Deleted forms are still found in the site audit trail
+	deleted := site[6]
+	if deleted.Target != id || deleted.Actor != rno || deleted.Details["reason"] != "spam" ||
+		deleted.Details["creator"] != "abuser" {
+		t.Errorf("Unexpected deletion audit %+v", deleted)
+	}
+}
+
+// Tests that share links give access to the scopes of the results they were made for
+func TestShareLinks(t *testing.T) {
+	form := createDummyForm()
+	form.Creator = rno
+	form.Pages[0].Widgets = append(form.Pages[0].Widgets, models.Widget{Type: "multiple_choice", UID: "q2",
+		Props: map[string]interface{}{"question": "Pick", "options": []interface{}{"A", "B"}}})
+	id, _ := db.InsertForm(context.Background(), &form)
+	db.InsertResponse(context.Background(), &models.FormResponse{FormID: id,
+		Responses: map[string]interface{}{"q1": "Answer", "q2": "A"}})
+	checkError(db.SetCollaborator(context.Background(), id,
+		&models.Collaborator{RollNumber: "viewer", Role: models.RoleViewer}), t)
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/form/{id}/links", h.RequireAuth(h.CreateShareLink)).Methods("POST")
+	r.HandleFunc("/api/form/{id}/links", h.RequireAuth(h.GetShareLinks)).Methods("GET")
+	r.HandleFunc("/api/form/{id}/links/{lid}", h.RequireAuth(h.RevokeShareLink)).Methods("DELETE")
+	r.HandleFunc("/api/responses/{formid}", h.OptionalAuth(h.ResultsAccess(h.GetResponses)))
+	r.HandleFunc("/api/responses/{formid}/summary", h.OptionalAuth(h.ResultsAccess(h.GetResponseSummary)))
+
+	links := "/api/form/" + id + "/links"
+	results := "/api/responses/" + id
+
+	// Only owners share the results
+	if recorder := serve(r, "viewer", "POST", links, `{"name":"Board","scopes":["summary"]}`); recorder.Code != http.StatusForbidden {
+		t.Errorf("Expected viewer to be refused, got %d", recorder.Code)
+	}
+	if recorder := serve(r, rno, "POST", links, `{"name":"Board","scopes":["everything"]}`); recorder.Code != 422 {
+		t.Errorf("Expected unknown scope to be refused, got %d", recorder.Code)
+	}
+	var summaryLink, rawLink struct {
+		ID    string `json:"id"`
+		Token string `json:"token"`
+	}
+	json.NewDecoder(serve(r, rno, "POST", links, `{"name":"Board","scopes":["summary"]}`).Body).Decode(&summaryLink)
+	json.NewDecoder(serve(r, rno, "POST", links, `{"name":"Analyst","scopes":["raw","export"]}`).Body).Decode(&rawLink)
+	if summaryLink.Token == "" || rawLink.Token == "" {
+		t.Fatalf("Share links not created")
+	}
+
+	// Links give access to their scopes only
+	recorder := serve(r, "", "GET", results+"/summary?token="+summaryLink.Token, "")
+	var summary struct {
+		Accepted int                       `json:"accepted"`
+		Choices  map[string]map[string]int `json:"choices"`
+	}
+	json.NewDecoder(recorder.Body).Decode(&summary)
+	if recorder.Code != http.StatusOK || summary.Accepted != 1 || summary.Choices["q2"]["A"] != 1 {
+		t.Errorf("Unexpected summary %d %+v", recorder.Code, summary)
+	}
+	if recorder := serve(r, "", "GET", results+"?token="+summaryLink.Token, ""); recorder.Code != http.StatusForbidden {
+		t.Errorf("Expected summary link to be refused raw responses, got %d", recorder.Code)
+	}
+	recorder = serve(r, "", "GET", results+"?type=array&token="+rawLink.Token, "")
+	var rows [][]string
+	json.NewDecoder(recorder.Body).Decode(&rows)
+	if recorder.Code != http.StatusOK || len(rows) != 2 || rows[1][1] != "Answer" {
+		t.Errorf("Unexpected export %d %v", recorder.Code, rows)
+	}
+	if recorder := serve(r, "", "GET", results+"?token=wrong", ""); recorder.Code != http.StatusUnauthorized {
+		t.Errorf("Expected unknown token to be refused, got %d", recorder.Code)
+	}
+	if recorder := serve(r, "", "GET", "/api/responses/other?token="+rawLink.Token, ""); recorder.Code != http.StatusUnauthorized {
+		t.Errorf("Expected token of another form to be refused, got %d", recorder.Code)
+	}
+
+	// Collaborators need no token, nor the response token after the id
+	if recorder := serve(r, "viewer", "GET", results, ""); recorder.Code != http.StatusOK {
+		t.Errorf("Expected collaborator to see responses, got %d", recorder.Code)
+	}
+	if recorder := serve(r, "", "GET", results, ""); recorder.Code != http.StatusUnauthorized {
+		t.Errorf("Expected anonymous user to be refused, got %d", recorder.Code)
+	}
+
+	// Revoked and expired links stop working
+	if recorder := serve(r, rno, "DELETE", links+"/"+summaryLink.ID, ""); recorder.Code != http.StatusOK {
+		t.Errorf("Expected revocation, got %d", recorder.Code)
+	}
+	if recorder := serve(r, "", "GET", results+"/summary?token="+summaryLink.Token, ""); recorder.Code != http.StatusUnauthorized {
+		t.Errorf("Expected revoked link to be refused, got %d", recorder.Code)
+	}
+	db.InsertShareLink(context.Background(), &models.ShareLink{FormID: id, Name: "Old", Scopes: []string{models.ScopeRaw},
+		Created: time.Now().Add(-time.Hour), Expires: models.At(time.Now().Add(-time.Minute)), TokenHash: fmt.Sprintf("%x", sha256.Sum256([]byte("old")))})
+	if recorder := serve(r, "", "GET", results+"?token=old", ""); recorder.Code != http.StatusUnauthorized {
+		t.Errorf("Expected expired link to be refused, got %d", recorder.Code)
+	}
+
+	// Owners see when links were used, but never their tokens
+	var listed []map[string]interface{}
+	json.NewDecoder(serve(r, rno, "GET", links, "").Body).Decode(&listed)
+	if len(listed) != 3 || listed[0]["token"] != nil || listed[1]["last_used"] == nil || listed[1]["revoked"] == nil {
+		t.Errorf("Unexpected share links %+v", listed)
+	}
+}
+
+// Tests that sessions are read once into the principal, and refused with JSON errors
+func TestAuth(t *testing.T) {
+	c.Admins = []string{rno}
+	defer func() { c.Admins = nil }()
+
+	var seen *c.Principal
+	whoami := func(w http.ResponseWriter, r *http.Request) {
+		seen = c.CurrentUser(r)
+		w.WriteHeader(http.StatusNoContent)
+	}
+	r := mux.NewRouter()
+	r.Use(h.Authenticate)
+	r.HandleFunc("/required", h.RequireAuth(whoami))
+	r.HandleFunc("/optional", h.OptionalAuth(whoami))
+	r.HandleFunc("/api/login", h.OptionalAuth(h.Login)).Methods("GET")
+	r.HandleFunc("/api/form/{id}/visibility", h.OptionalAuth(h.GetVisibility)).Methods("POST")
+
+	invalid := func(api string) *http.Request {
+		request, _ := http.NewRequest("GET", api, nil)
+		request.AddCookie(&http.Cookie{Name: "token", Value: "invalid"})
+		return request
+	}
+	anonymous, _ := http.NewRequest("GET", "/required", nil)
+
+	// Anonymous and invalid sessions are refused alike
+	for _, request := range []*http.Request{anonymous, invalid("/required")} {
+		seen = nil
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, request)
+		var msg map[string]interface{}
+		json.NewDecoder(recorder.Body).Decode(&msg)
+		if recorder.Code != http.StatusUnauthorized || msg["status"] != false || msg["message"] == "" || seen != nil {
+			t.Errorf("Expected JSON refusal, got %d %v", recorder.Code, msg)
+		}
+	}
+
+	// Handlers needing a login explain why the session was refused
+	form := createDummyForm()
+	id, _ := db.InsertForm(context.Background(), &form)
+	request := invalid("/api/form/" + id + "/visibility")
+	request.Method = "POST"
+	recorder := httptest.NewRecorder()
+	r.ServeHTTP(recorder, request)
+	var msg map[string]interface{}
+	json.NewDecoder(recorder.Body).Decode(&msg)
+	if recorder.Code != http.StatusUnauthorized || !strings.Contains(fmt.Sprint(msg["message"]), "expired") {
+		t.Errorf("Expected expired session, got %d %v", recorder.Code, msg)
+	}
+
+	// Optional routes treat invalid sessions as anonymous
+	recorder = httptest.NewRecorder()
+	r.ServeHTTP(recorder, invalid("/optional"))
+	if recorder.Code != http.StatusNoContent || seen != nil {
+		t.Errorf("Expected anonymous request, got %d %+v", recorder.Code, seen)
+	}
+
+	// Logged in users come with their profile and site roles
+	recorder = httptest.NewRecorder()
+	r.ServeHTTP(recorder, requestAPI("GET", "/required", nil))
+	if recorder.Code != http.StatusNoContent || seen == nil || seen.RollNumber != rno ||
+		seen.Profile == nil || seen.Profile.Email != "test@gmail.com" || !seen.HasRole(c.SiteRoleAdmin) {
+		t.Errorf("Unexpected principal %d %+v", recorder.Code, seen)
+	}
+	recorder = httptest.NewRecorder()
+	r.ServeHTTP(recorder, requestAs("unregistered", "GET", "/optional", nil))
+	if seen == nil || seen.RollNumber != "unregistered" || seen.Profile != nil || seen.HasRole(c.SiteRoleAdmin) {
+		t.Errorf("Unexpected principal %+v", seen)
+	}
+
+	recorder = httptest.NewRecorder()
+	r.ServeHTTP(recorder, requestAPI("GET", "/api/login", nil))
+	var profile models.Profile
+	json.NewDecoder(recorder.Body).Decode(&profile)
+	if recorder.Code != http.StatusOK || profile.RollNumber != rno || !profile.Admin {
+		t.Errorf("Unexpected profile %d %+v", recorder.Code, profile)
+	}
+}
+
 func requestAPI(Method string, API string, formString []byte) *http.Request {
+	return requestAs(rno, Method, API, formString)
+}
+
+func requestAs(user string, Method string, API string, formString []byte) *http.Request {
 	tempR := httptest.NewRecorder()
-	c.SetCookie(tempR, rno)
+	c.SetCookie(tempR, user)
 
 	request, _ := http.NewRequest(Method, API, bytes.NewBuffer(formString))
 	request.Header.Add("Cookie", tempR.HeaderMap["Set-Cookie"][0])
@@ -194,6 +1659,27 @@ func requestAPI(Method string, API string, formString []byte) *http.Request {
 	return request
 }
 
+// serve : serve a request of the user, or an anonymous one if the user is empty
+func serve(r http.Handler, user string, method string, api string, body string) *httptest.ResponseRecorder {
+	request := requestAs(user, method, api, []byte(body))
+	if user == "" {
+		request, _ = http.NewRequest(method, api, bytes.NewBufferString(body))
+	}
+	recorder := httptest.NewRecorder()
+	r.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// auditActions : the actions in the audit trail of the form, or of the site
+func auditActions(formid string) []string {
+	entries, _ := db.FindAudit(context.Background(), formid)
+	actions := []string{}
+	for _, entry := range entries {
+		actions = append(actions, entry.Action)
+	}
+	return actions
+}
+
 func checkError(err error, t *testing.T) {
 	if err != nil {
 		t.Errorf("An error occurred. %v", err)
@@ -203,6 +1689,7 @@ func checkError(err error, t *testing.T) {
 func createDummyForm() models.Form {
 	widget := &models.Widget{
 		Type:  "short_answer",
+		UID:   "q1",
 		Props: map[string]interface{}{"question": "Question first", "validators": "{required : false}"},
 	}
 	page := &models.Page{
@@ -219,3 +1706,14 @@ func createDummyForm() models.Form {
 	}
 	return *form
 }
+
+func createDummyResponse(form models.Form) []byte {
+	response := &models.FormResponse{Responses: map[string]interface{}{}}
+	for _, page := range form.Pages {
+		for _, widget := range page.Widgets {
+			response.Responses[widget.UID] = "Answer"
+		}
+	}
+	responseJson, _ := json.Marshal(response)
+	return responseJson
+}
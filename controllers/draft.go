@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/pulsejet/go-cerium/models"
+	"github.com/pulsejet/go-cerium/store"
+	u "github.com/pulsejet/go-cerium/utils"
+)
+
+// copyContent : copy the fields a creator edits from one form to another
+func copyContent(dst *models.Form, src *models.Form) {
+	dst.Name = src.Name
+	dst.Pages = src.Pages
+	dst.RequireLogin = src.RequireLogin
+	dst.CollectEmail = src.CollectEmail
+	dst.SingleResponse = src.SingleResponse
+	dst.IsClosed = src.IsClosed
+	dst.OpenOn = src.OpenOn
+	dst.CloseOn = src.CloseOn
+	dst.ResponseLimit = src.ResponseLimit
+	dst.Waitlist = src.Waitlist
+	dst.AllowEdit = src.AllowEdit
+	dst.AllowWithdraw = src.AllowWithdraw
+	dst.KeepWithdrawn = src.KeepWithdrawn
+}
+
+// draftOf : a draft holding only the content of the form
+func draftOf(form *models.Form) *models.Form {
+	draft := &models.Form{}
+	copyContent(draft, form)
+	return draft
+}
+
+// formView : the form as seen by the user, which is the draft for its editors
+// unless ?view=published is asked for, or nil if the user may not see it
+func formView(r *http.Request, form *models.Form, rno string) *models.Form {
+	view := *form
+	view.Draft = nil
+	view.HasDraft = form.Draft != nil
+
+	if form.Can(rno, models.RoleEditor) {
+		if form.Draft != nil && r.URL.Query().Get("view") != "published" {
+			copyContent(&view, form.Draft)
+		}
+		return &view
+	}
+
+	// Respondents only see published forms that were not taken down
+	if !form.IsPublished() || form.Suspended {
+		return nil
+	}
+	view.HasDraft = false
+	return &view
+}
+
+// PublishForm : API handler for making the draft of a form live
+func (h *Handler) PublishForm(w http.ResponseWriter, r *http.Request) {
+	form, rno := h.sharedForm(w, r, models.RoleEditor)
+	if form == nil {
+		return
+	}
+
+	// Nothing to do for forms without changes
+	if form.IsPublished() && form.Draft == nil {
+		setETag(w, form.Version)
+		u.Respond(w, map[string]interface{}{"id": form.ID, "version": form.Version, "status": form.Status}, 200)
+		return
+	}
+
+	published := *form
+	if form.Draft != nil {
+		copyContent(&published, form.Draft)
+	}
+	published.Draft = nil
+	published.Status = models.StatusPublished
+
+	// Publish exactly what the client last saw
+	version := form.Version
+	if match, ok := ifMatch(r); ok {
+		version = match
+	}
+
+	err := h.replaceForm(r.Context(), rno, form, version, &published)
+	if err == store.ErrNotFound {
+		u.Respond(w, u.Message(false, "Not Found"), 404)
+		return
+	}
+	if err == store.ErrConflict {
+		respondConflict(w, r, h.forms, form.ID)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		u.Respond(w, u.Message(false, err.Error()), 400)
+		return
+	}
+
+	log.Println(rno, ": published form", form.ID)
+
+	setETag(w, published.Version)
+	u.Respond(w, map[string]interface{}{"id": form.ID, "version": published.Version, "status": published.Status}, 200)
+}
@@ -5,26 +5,21 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"sort"
 	"time"
 
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
-
 	"github.com/gorilla/mux"
 
 	"github.com/pulsejet/go-cerium/models"
+	"github.com/pulsejet/go-cerium/rules"
+	"github.com/pulsejet/go-cerium/store"
 	u "github.com/pulsejet/go-cerium/utils"
+	"github.com/pulsejet/go-cerium/validate"
 )
 
 // CreateForm : API handler for POST-ing new forms
-var CreateForm = func(w http.ResponseWriter, r *http.Request) {
-	// Check authentication
-	rno := GetRollNo(w, r, true)
-	if rno == "" {
-		return
-	}
+func (h *Handler) CreateForm(w http.ResponseWriter, r *http.Request) {
+	rno := rollNo(r)
 
 	// Decode the JSON form
 	form := &models.Form{}
@@ -44,33 +39,70 @@ var CreateForm = func(w http.ResponseWriter, r *http.Request) {
 	// Setup fields
 	assignUids(form)
 	form.Name = form.Pages[0].Title
-	responseToken := u.RandSeq(50)
-	form.ResponseToken = responseToken
-	collection := u.Collection(r.Context(), "forms")
+
+	// Check the whole structure before writing anything
+	if errs := validate.Form(form); errs != nil {
+		msg := u.Message(false, "Invalid form")
+		msg["errors"] = errs
+		u.Respond(w, msg, 422)
+		return
+	}
 
 	// Update or create new
-	var id interface{}
+	var id string
 	if r.Method == "PUT" {
-		cid := mux.Vars(r)["id"]
-		objID, _ := primitive.ObjectIDFromHex(cid)
-		filt := bson.M{"$and": bson.A{
-			bson.M{"_id": objID},
-			bson.M{"creator": rno}}}
+		id = mux.Vars(r)["id"]
 
-		var res *mongo.UpdateResult
-		res, err = collection.ReplaceOne(r.Context(), filt, form)
-		id = cid
+		// Keep fields that are not edited by the client
+		var old *models.Form
+		old, err = h.forms.FindForm(r.Context(), id)
+		if err != nil || old.RoleOf(rno) == "" {
+			u.Respond(w, u.Message(false, "Not Found"), 404)
+			return
+		}
+		if !old.Can(rno, models.RoleEditor) {
+			u.Respond(w, u.Message(false, "Only form editors can edit form. Unauthorized access"), 403)
+			return
+		}
+		form.Creator = old.Creator
+		form.Timestamp = old.Timestamp
+		form.Status = old.Status
+		form.Suspended = old.Suspended
+		form.Draft = nil
+
+		// Published forms keep serving respondents until the draft is published
+		if old.IsPublished() {
+			live := *old
+			live.Draft = draftOf(form)
+			live.Version = form.Version
+			form = &live
+		}
 
-		if res.MatchedCount == 0 {
+		// The client must have edited the latest version
+		version := form.Version
+		if match, ok := ifMatch(r); ok {
+			version = match
+		} else if r.Header.Get("If-Match") == "*" {
+			version = old.Version
+		}
+
+		err = h.replaceForm(r.Context(), rno, old, version, form)
+		if err == store.ErrNotFound {
 			u.Respond(w, u.Message(false, "Not Found"), 404)
 			return
 		}
+		if err == store.ErrConflict {
+			respondConflict(w, r, h.forms, id)
+			return
+		}
 	} else {
 		form.Creator = rno
 		form.Timestamp = time.Now()
-		var res *mongo.InsertOneResult
-		res, err = collection.InsertOne(r.Context(), form)
-		id = res.InsertedID
+		form.Version = 1
+		form.Status = models.StatusDraft
+		form.Suspended = false
+		form.Draft = nil
+		id, err = h.forms.InsertForm(r.Context(), form)
 	}
 
 	// Check for errors and return form id
@@ -83,7 +115,8 @@ var CreateForm = func(w http.ResponseWriter, r *http.Request) {
 	// Log to console
 	log.Println(rno, ": new form", id)
 
-	u.Respond(w, map[string]interface{}{"id": id, "token": responseToken}, 200)
+	setETag(w, form.Version)
+	u.Respond(w, map[string]interface{}{"id": id, "version": form.Version, "status": form.Status}, 200)
 }
 
 /** Set random UID for each widget */
@@ -99,136 +132,173 @@ func assignUids(form *models.Form) {
 }
 
 // GetForm : API handler for getting one form
-var GetForm = func(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) GetForm(w http.ResponseWriter, r *http.Request) {
 	id := mux.Vars(r)["id"]
 
-	form := &models.Form{}
-
 	// Get the form
-	collection := u.Collection(r.Context(), "forms")
-	objID, _ := primitive.ObjectIDFromHex(id)
-	err := collection.FindOne(r.Context(), bson.M{"_id": objID}).Decode(&form)
+	form, err := h.forms.FindForm(r.Context(), id)
 	if err != nil {
 		u.Respond(w, u.Message(false, err.Error()), 400)
 		return
 	}
 
-	// Check if editable
-	rno := GetRollNo(w, r, false)
-	if rno != "" {
-		form.CanEdit = rno == form.Creator
+	// Check if editable, whatever was saved with the form
+	rno := rollNo(r)
+	form.CanEdit = form.Can(rno, models.RoleEditor)
+
+	// Only collaborators see who the form is shared with
+	if form.RoleOf(rno) == "" {
+		form.Collaborators = nil
+	}
+
+	// Creators see their draft and respondents the published form
+	if form = formView(r, form, rno); form == nil {
+		u.Respond(w, u.Message(false, "Not Found"), 404)
+		return
+	}
+
+	// Anonymous respondents of single-response forms are told apart by a cookie
+	if form.SingleResponse && !form.RequireLogin {
+		setRespondent(w, r)
 	}
 
 	// Check if already filled
-	if !form.CanEdit && form.SingleResponse && HasFilledAnon(r.Context(), id, rno) {
+	if !form.CanEdit && form.SingleResponse && h.hasFilled(r.Context(), respondentFillers(r, form, rno)) {
 		u.Respond(w, u.Message(false, "User has already filled this form"), 403)
 		return
 	}
 
 	// Login required
 	if form.RequireLogin && rno == "" {
-		u.Respond(w, u.Message(false, "Unauthorized: Please login to continue"), 401)
+		respondUnauthorized(w, r)
 		return
 	}
 
-	year2000 := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
-	if time.Now().UTC().After(form.CloseOn) && year2000.Before(form.CloseOn) {
+	// Tell the client whether responses are accepted, older clients only know is_closed
+	form.Availability = h.availability(r.Context(), form)
+	if form.Availability.Reason == models.ClosedBySchedule {
 		form.IsClosed = true
 	}
 
+	setETag(w, form.Version)
 	u.Respond(w, form, 200)
 }
 
-// GetAllForms : API handler for getting all forms of the logged in user
-var GetAllForms = func(w http.ResponseWriter, r *http.Request) {
-	// Get roll number
-	rno := GetRollNo(w, r, false)
+// GetVisibility : API handler for getting the pages and widgets shown for some answers
+func (h *Handler) GetVisibility(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
 
-	// To extrach data out of collection.Find()
-	type formDB struct {
-		ID    primitive.ObjectID `bson:"_id"`
-		Name  string             `bson:"name"`
-		Token string             `bson:"responsetoken"`
+	// Get the form
+	form, err := h.forms.FindForm(r.Context(), id)
+	if err != nil {
+		u.Respond(w, u.Message(false, err.Error()), 400)
+		return
 	}
 
-	// To send data to frontend
-	type formDetails struct {
-		ID    string
-		Name  string
-		Token string
+	// Creators preview their draft
+	rno := rollNo(r)
+	if form = formView(r, form, rno); form == nil {
+		u.Respond(w, u.Message(false, "Not Found"), 404)
+		return
 	}
 
-	var forms []formDetails
+	// Login required
+	if form.RequireLogin && rno == "" {
+		respondUnauthorized(w, r)
+		return
+	}
 
-	collection := u.Collection(r.Context(), "forms")
-	count, err := collection.CountDocuments(r.Context(), bson.M{"creator": rno})
-	if count == 0 {
-		u.Respond(w, make([]formDetails, 0), 200)
+	// Decode the answers so far
+	response := &models.FormResponse{}
+	err = json.NewDecoder(r.Body).Decode(response)
+	if err != nil {
+		u.Respond(w, u.Message(false, err.Error()), 400)
 		return
 	}
 
-	// To Set which fields are required in the output
-	type fields struct {
-		ID    int `bson:"_id"`
-		Name  int `bson:"name"`
-		Token int `bson:"responsetoken"`
+	u.Respond(w, rules.Evaluate(form, response.Responses), 200)
+}
+
+// GetAllForms : API handler for getting all forms of the logged in user,
+// including those shared with them
+func (h *Handler) GetAllForms(w http.ResponseWriter, r *http.Request) {
+	rno := rollNo(r)
+
+	// To send data to frontend
+	type formDetails struct {
+		ID       string
+		Name     string
+		Status   string
+		HasDraft bool
+		Role     string
 	}
-	projection := fields{ID: 1, Name: 1, Token: 1}
-	opt := &options.FindOptions{}
-	opt.SetSort(bson.D{{"timestamp", -1}})
-	opt.SetProjection(projection)
 
-	// Get all form ids for this roll number
-	values, err := collection.Find(r.Context(), bson.M{"creator": rno}, opt)
+	// Get all forms for this roll number
+	values, err := h.forms.FindFormsByCreator(r.Context(), rno)
 	if err != nil {
 		u.Respond(w, u.Message(false, err.Error()), 400)
 		return
 	}
-
-	// Iterate and collect responses
-	for values.Next(context.TODO()) {
-		var elem formDB
-		err := values.Decode(&elem)
-		if err != nil {
-			log.Println(err)
+	shared, err := h.shares.FindSharedForms(r.Context(), rno)
+	if err != nil {
+		u.Respond(w, u.Message(false, err.Error()), 400)
+		return
+	}
+	values = append(values, shared...)
+	sort.SliceStable(values, func(i, j int) bool {
+		return values[i].Timestamp.After(values[j].Timestamp)
+	})
+
+	// Iterate and collect details
+	forms := make([]formDetails, 0, len(values))
+	for _, elem := range values {
+		status := models.StatusPublished
+		if !elem.IsPublished() {
+			status = models.StatusDraft
 		}
-		forms = append(forms, formDetails{ID: (&elem).ID.Hex(), Name: (&elem).Name, Token: (&elem).Token})
+		forms = append(forms, formDetails{ID: elem.ID, Name: elem.Name, Status: status,
+			HasDraft: elem.Draft != nil, Role: elem.RoleOf(rno)})
 	}
-	log.Println("all forms created by", rno, "sent")
+	log.Println("all forms of", rno, "sent")
 	u.Respond(w, forms, 200)
 }
 
 // DeleteForm : API handler for deleting a form
-var DeleteForm = func(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) DeleteForm(w http.ResponseWriter, r *http.Request) {
 	cid := mux.Vars(r)["id"]
 
-	// Get roll number
-	rno := GetRollNo(w, r, false)
-
-	form := &models.Form{}
-	collection := u.Collection(r.Context(), "forms")
-	objID, _ := primitive.ObjectIDFromHex(cid)
-	err := collection.FindOne(r.Context(), bson.M{"_id": objID}).Decode(&form)
+	rno := rollNo(r)
+	form, err := h.forms.FindForm(r.Context(), cid)
 	if err != nil {
 		u.Respond(w, u.Message(false, err.Error()), 400)
 		return
 	}
 
-	if rno != form.Creator {
-		u.Respond(w, u.Message(false, "Only form creator can delete form. Unauthorized access"), 403)
+	if !form.Can(rno, models.RoleOwner) {
+		u.Respond(w, u.Message(false, "Only form owners can delete form. Unauthorized access"), 403)
 		return
 	}
 
+	h.deleteForm(r.Context(), cid)
+	u.Respond(w, u.Message(false, "Form deleted"), 200)
+}
+
+// deleteForm : remove a form with its responses and history
+func (h *Handler) deleteForm(ctx context.Context, cid string) {
 	// Delete form
-	_, err = collection.DeleteOne(r.Context(), bson.M{"_id": objID})
+	err := h.forms.DeleteForm(ctx, cid)
 	if err != nil {
 		log.Printf("remove fail %v\n", err)
 	}
 	// Remove responses
-	_, err = u.Collection(r.Context(), "responses").DeleteMany(r.Context(), bson.M{"formid": cid})
+	err = h.responses.DeleteResponses(ctx, cid)
+	if err != nil {
+		log.Printf("remove fail %v\n", err)
+	}
+	// Remove history
+	err = h.history.DeleteRevisions(ctx, cid)
 	if err != nil {
 		log.Printf("remove fail %v\n", err)
 	}
 	log.Println("Form", cid, "and its responses deleted")
-	u.Respond(w, u.Message(false, "Form deleted"), 200)
 }
@@ -0,0 +1,33 @@
+package controllers
+
+import (
+	"github.com/pulsejet/go-cerium/store"
+)
+
+// Handler : API handlers backed by persistent stores
+type Handler struct {
+	forms     store.FormStore
+	shares    store.CollaboratorStore
+	transfers store.TransferStore
+	links     store.ShareLinkStore
+	responses store.ResponseStore
+	fillers   store.FillerStore
+	users     store.UserStore
+	history   store.HistoryStore
+	audit     store.AuditStore
+}
+
+// New : create API handlers using the given store
+func New(s store.Store) *Handler {
+	return &Handler{
+		forms:     s,
+		shares:    s,
+		transfers: s,
+		links:     s,
+		responses: s,
+		fillers:   s,
+		users:     s,
+		history:   s,
+		audit:     s,
+	}
+}
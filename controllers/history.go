@@ -0,0 +1,214 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/pulsejet/go-cerium/history"
+	"github.com/pulsejet/go-cerium/models"
+	"github.com/pulsejet/go-cerium/store"
+	u "github.com/pulsejet/go-cerium/utils"
+)
+
+// replaceForm : save a new version of the form, keeping the old one in history
+func (h *Handler) replaceForm(ctx context.Context, rno string, old *models.Form, version int, form *models.Form) error {
+	err := h.forms.ReplaceForm(ctx, old.ID, old.Creator, version, form)
+	if err != nil {
+		return err
+	}
+
+	// Only one save can replace a version, so each is recorded once
+	err = h.history.InsertRevision(ctx, &models.Revision{
+		FormID:     old.ID,
+		Version:    old.Version,
+		Replaced:   time.Now(),
+		ReplacedBy: rno,
+		Form:       *old,
+	})
+	if err != nil {
+		log.Println("revision not saved:", err)
+	}
+	return nil
+}
+
+// sharedForm : get the form in the request if the user has the role on it,
+// for handlers behind RequireAuth
+func (h *Handler) sharedForm(w http.ResponseWriter, r *http.Request, role string) (*models.Form, string) {
+	// Forms are not found by users they are not shared with
+	form, err := h.forms.FindForm(r.Context(), mux.Vars(r)["id"])
+	rno := rollNo(r)
+	if err != nil || form.RoleOf(rno) == "" {
+		u.Respond(w, u.Message(false, "Not Found"), 404)
+		return nil, ""
+	}
+	if !form.Can(rno, role) {
+		u.Respond(w, u.Message(false, "Forbidden: "+form.RoleOf(rno)+" of this form"), 403)
+		return nil, ""
+	}
+	return form, rno
+}
+
+// formAt : get the form as it was at a version, which may be the current one
+func (h *Handler) formAt(ctx context.Context, form *models.Form, version int) (*models.Form, error) {
+	if version == form.Version {
+		return form, nil
+	}
+	revision, err := h.history.FindRevision(ctx, form.ID, version)
+	if err != nil {
+		return nil, err
+	}
+	revision.Form.Version = revision.Version
+	return &revision.Form, nil
+}
+
+// GetRevisions : API handler for listing the versions of a form
+func (h *Handler) GetRevisions(w http.ResponseWriter, r *http.Request) {
+	form, _ := h.sharedForm(w, r, models.RoleEditor)
+	if form == nil {
+		return
+	}
+
+	revisions, err := h.history.FindRevisions(r.Context(), form.ID)
+	if err != nil {
+		u.Respond(w, u.Message(false, err.Error()), 400)
+		return
+	}
+
+	// To send data to frontend
+	type revisionDetails struct {
+		Version    int        `json:"version"`
+		Name       string     `json:"name"`
+		Replaced   *time.Time `json:"replaced"`
+		ReplacedBy string     `json:"replaced_by,omitempty"`
+		Current    bool       `json:"current"`
+	}
+
+	// Oldest first, ending with the current version
+	details := make([]revisionDetails, 0, len(revisions)+1)
+	for _, rev := range revisions {
+		replaced := rev.Replaced
+		details = append(details, revisionDetails{
+			Version:    rev.Version,
+			Name:       rev.Form.Name,
+			Replaced:   &replaced,
+			ReplacedBy: rev.ReplacedBy,
+		})
+	}
+	details = append(details, revisionDetails{Version: form.Version, Name: form.Name, Current: true})
+
+	setETag(w, form.Version)
+	u.Respond(w, details, 200)
+}
+
+// GetRevision : API handler for getting a form as it was at a version
+func (h *Handler) GetRevision(w http.ResponseWriter, r *http.Request) {
+	form, _ := h.sharedForm(w, r, models.RoleEditor)
+	if form == nil {
+		return
+	}
+
+	version, err := strconv.Atoi(mux.Vars(r)["version"])
+	if err != nil {
+		u.Respond(w, u.Message(false, "Bad version"), 400)
+		return
+	}
+	old, err := h.formAt(r.Context(), form, version)
+	if err != nil {
+		u.Respond(w, u.Message(false, "Not Found"), 404)
+		return
+	}
+	u.Respond(w, old, 200)
+}
+
+// GetDiff : API handler for the changes between two versions of a form,
+// with ?from= and ?to= defaulting to the previous and current versions
+func (h *Handler) GetDiff(w http.ResponseWriter, r *http.Request) {
+	form, _ := h.sharedForm(w, r, models.RoleEditor)
+	if form == nil {
+		return
+	}
+
+	versions := []int{form.Version - 1, form.Version}
+	for i, key := range []string{"from", "to"} {
+		if value := r.URL.Query().Get(key); value != "" {
+			v, err := strconv.Atoi(value)
+			if err != nil {
+				u.Respond(w, u.Message(false, "Bad version "+key), 400)
+				return
+			}
+			versions[i] = v
+		}
+	}
+
+	from, err := h.formAt(r.Context(), form, versions[0])
+	if err != nil {
+		u.Respond(w, u.Message(false, "Version "+strconv.Itoa(versions[0])+" Not Found"), 404)
+		return
+	}
+	to, err := h.formAt(r.Context(), form, versions[1])
+	if err != nil {
+		u.Respond(w, u.Message(false, "Version "+strconv.Itoa(versions[1])+" Not Found"), 404)
+		return
+	}
+
+	u.Respond(w, history.Compare(from, to), 200)
+}
+
+// RestoreRevision : API handler for saving an old version of a form as the newest one
+func (h *Handler) RestoreRevision(w http.ResponseWriter, r *http.Request) {
+	form, rno := h.sharedForm(w, r, models.RoleEditor)
+	if form == nil {
+		return
+	}
+
+	version, err := strconv.Atoi(mux.Vars(r)["version"])
+	if err != nil {
+		u.Respond(w, u.Message(false, "Bad version"), 400)
+		return
+	}
+	revision, err := h.history.FindRevision(r.Context(), form.ID, version)
+	if err != nil {
+		u.Respond(w, u.Message(false, "Not Found"), 404)
+		return
+	}
+
+	// Only the content is restored as it was last edited, into the draft
+	// of published forms
+	restored := *form
+	if form.IsPublished() {
+		restored.Draft = draftOf(history.Content(&revision.Form))
+	} else {
+		copyContent(&restored, history.Content(&revision.Form))
+	}
+
+	// Guard against edits made since the client last looked
+	current := form.Version
+	if match, ok := ifMatch(r); ok {
+		current = match
+	}
+
+	err = h.replaceForm(r.Context(), rno, form, current, &restored)
+	if err == store.ErrNotFound {
+		u.Respond(w, u.Message(false, "Not Found"), 404)
+		return
+	}
+	if err == store.ErrConflict {
+		respondConflict(w, r, h.forms, form.ID)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		u.Respond(w, u.Message(false, err.Error()), 400)
+		return
+	}
+
+	log.Println(rno, ": restored form", form.ID, "to version", version)
+
+	setETag(w, restored.Version)
+	u.Respond(w, map[string]interface{}{"id": form.ID, "version": restored.Version}, 200)
+}
@@ -10,10 +10,9 @@ import (
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
-	"go.mongodb.org/mongo-driver/mongo/options"
 
+	"github.com/pulsejet/go-cerium/models"
 	u "github.com/pulsejet/go-cerium/utils"
-	"go.mongodb.org/mongo-driver/bson"
 )
 
 // AuthCode : code and redirect uri to POST
@@ -32,14 +31,7 @@ type AccessTokenResponse struct {
 }
 
 // ProfileResponse : Profile as received from SSO
-type ProfileResponse struct {
-	ID             int    `json:"id"`
-	FirstName      string `json:"first_name"`
-	LastName       string `json:"last_name"`
-	RollNumber     string `json:"roll_number"`
-	ProfilePicture string `json:"profile_picture"`
-	Email          string `json:"email"`
-}
+type ProfileResponse = models.Profile
 
 // Claims : JWT claims stored on client side
 type Claims struct {
@@ -50,24 +42,22 @@ type Claims struct {
 var jwtKey = []byte(os.Getenv("JWT_KEY"))
 
 // Login : API handler for logging in with SSO auth code
-var Login = func(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 	if r.Method == "GET" {
-		// Get JWT
-		rno := GetRollNo(w, r, true)
-		if rno == "" {
+		// Get the session
+		p := CurrentUser(r)
+		if p == nil {
+			respondUnauthorized(w, r)
 			return
 		}
-
-		// Get profile
-		collection := u.Collection(r.Context(), "users")
-		user := &ProfileResponse{}
-		err := collection.FindOne(r.Context(), bson.M{"rollnumber": rno}).Decode(user)
-		if err != nil {
-			u.Respond(w, u.Message(false, err.Error()), 500)
+		if p.Profile == nil {
+			u.Respond(w, u.Message(false, "Not Found"), 404)
 			return
 		}
 
 		// Return profile
+		user := *p.Profile
+		user.Admin = p.HasRole(SiteRoleAdmin)
 		u.Respond(w, user, 200)
 		return
 	}
@@ -141,77 +131,19 @@ var Login = func(w http.ResponseWriter, r *http.Request) {
 
 	// Save Profile
 	rno := profileResponse.RollNumber
-	collection := u.Collection(r.Context(), "users")
-
-	// Allow creation
-	var ropts options.ReplaceOptions
-	ropts.SetUpsert(true)
-
-	// Upsert profile
-	_, err = collection.ReplaceOne(
-		r.Context(), bson.M{"rollnumber": rno}, profileResponse, &ropts)
+	err = h.users.UpsertUser(r.Context(), profileResponse)
+	if err != nil {
+		log.Println(err)
+	}
 
 	// Set cookie
 	SetCookie(w, rno)
 
 	// Return profile
+	profileResponse.Admin = h.isAdmin(r.Context(), rno)
 	u.Respond(w, profileResponse, 200)
 }
 
-// GetRollNo : helper function to get claimed roll number from JWT
-var GetRollNo = func(w http.ResponseWriter, r *http.Request, throw bool) string {
-	c, err := r.Cookie("token")
-	if err != nil {
-		if err == http.ErrNoCookie {
-			// If the cookie is not set, return an unauthorized status
-			if throw {
-				w.WriteHeader(http.StatusUnauthorized)
-			}
-			return ""
-		}
-		// For any other type of error, return a bad request status
-		if throw {
-			w.WriteHeader(http.StatusBadRequest)
-		}
-		return ""
-	}
-
-	// Get the JWT string from the cookie
-	tknStr := c.Value
-
-	// Initialize a new instance of `Claims`
-	claims := &Claims{}
-
-	// Parse claims
-	tkn, err := jwt.ParseWithClaims(tknStr, claims, func(token *jwt.Token) (interface{}, error) {
-		return jwtKey, nil
-	})
-
-	// Check invalid claims
-	if !tkn.Valid {
-		if throw {
-			w.WriteHeader(http.StatusUnauthorized)
-		}
-		return ""
-	}
-
-	// Check invalid signatures and other errors
-	if err != nil {
-		if err == jwt.ErrSignatureInvalid {
-			if throw {
-				w.WriteHeader(http.StatusUnauthorized)
-			}
-			return ""
-		}
-		if throw {
-			w.WriteHeader(http.StatusBadRequest)
-		}
-		return ""
-	}
-
-	return claims.RollNumber
-}
-
 // Logout : API handler for logging out
 var Logout = func(w http.ResponseWriter, r *http.Request) {
 	// Finally, we set the client cookie for "token" as the JWT we just generated
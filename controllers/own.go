@@ -0,0 +1,188 @@
+package controllers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/pulsejet/go-cerium/models"
+	"github.com/pulsejet/go-cerium/store"
+	u "github.com/pulsejet/go-cerium/utils"
+	"github.com/pulsejet/go-cerium/validate"
+)
+
+// ownResponse : find the response of the respondent by the link signed for
+// the scope, passed as the token parameter, or else by login. The latest
+// response of a logged in respondent is found with "mine" as the id
+func (h *Handler) ownResponse(w http.ResponseWriter, r *http.Request, scope string) (*models.Form, *models.FormResponse) {
+	vars := mux.Vars(r)
+	form, err := h.forms.FindForm(r.Context(), vars["formid"])
+	if err != nil {
+		u.Respond(w, u.Message(false, "Not Found"), 404)
+		return nil, nil
+	}
+
+	rid := vars["rid"]
+	var response *models.FormResponse
+	if token := r.URL.Query().Get("token"); token != "" && rid != "mine" {
+		err = store.ErrNotFound
+		if claims := checkResponseToken(token, form.ID, scope); claims != nil && claims.ResponseID == rid {
+			response, err = h.responses.FindResponse(r.Context(), form.ID, rid)
+		}
+	} else {
+		rno := rollNo(r)
+		if rno == "" {
+			respondUnauthorized(w, r)
+			return nil, nil
+		}
+		if rid == "mine" {
+			response, err = h.responses.FindOwnResponse(r.Context(), form.ID, ownerOf(rno))
+		} else {
+			response, err = h.responses.FindResponse(r.Context(), form.ID, rid)
+			if err == nil && response.Owner != ownerOf(rno) {
+				err = store.ErrNotFound
+			}
+		}
+	}
+
+	if err == store.ErrNotFound {
+		u.Respond(w, u.Message(false, "Not Found"), 404)
+		return nil, nil
+	}
+	if err != nil {
+		u.Respond(w, u.Message(false, err.Error()), 500)
+		return nil, nil
+	}
+	return form, response
+}
+
+// GetOwnResponse : API handler for a respondent getting their response
+func (h *Handler) GetOwnResponse(w http.ResponseWriter, r *http.Request) {
+	_, response := h.ownResponse(w, r, scopeEdit)
+	if response == nil {
+		return
+	}
+	u.Respond(w, response, 200)
+}
+
+// EditOwnResponse : API handler for a respondent changing their answers,
+// keeping the earlier ones in the edit history of the response
+func (h *Handler) EditOwnResponse(w http.ResponseWriter, r *http.Request) {
+	form, response := h.ownResponse(w, r, scopeEdit)
+	if response == nil {
+		return
+	}
+	if !form.AllowEdit {
+		u.Respond(w, u.Message(false, "Editing is not allowed"), 403)
+		return
+	}
+	if response.Status == models.ResponseWithdrawn {
+		u.Respond(w, u.Message(false, "Response Withdrawn"), 410)
+		return
+	}
+
+	// Edits are taken while the form is open, even once it is full
+	if avail := h.availability(r.Context(), form); !avail.Open && avail.Reason != models.QuotaReached {
+		respondUnavailable(w, avail)
+		return
+	}
+
+	// Check the new answers against the published form
+	edit := &models.FormResponse{}
+	err := json.NewDecoder(r.Body).Decode(edit)
+	if err != nil {
+		u.Respond(w, u.Message(false, err.Error()), 400)
+		return
+	}
+	if edit.Responses == nil {
+		edit.Responses = map[string]interface{}{}
+	}
+	if errs := validate.Response(form, edit.Responses); errs != nil {
+		msg := u.Message(false, "Invalid response")
+		msg["errors"] = errs
+		u.Respond(w, msg, 422)
+		return
+	}
+
+	// Keep the fields that are not answers
+	edit.Responses["timestamp"] = response.Timestamp
+	if response.Filler != "" {
+		edit.Responses["filler"] = response.Filler
+	}
+	response.Responses = edit.Responses
+	response.Version = form.Version
+
+	// Options given up free places and new ones must have them
+	quotas, choices := responseQuotas(form, response.Responses)
+	err = h.responses.ReplaceResponse(r.Context(), response, quotas, response.Filler)
+	if err != nil {
+		respondReplaceError(w, err, "Option Full", choices)
+		return
+	}
+	if response.Status != models.ResponseWaitlisted {
+		h.promoteWaitlist(r.Context(), form)
+	}
+
+	log.Println("edited response", response.ID, "of form", form.ID)
+	u.Respond(w, response, 200)
+}
+
+// WithdrawResponse : API handler for a respondent withdrawing their response,
+// which is removed, or kept without answers if the form says so, and noted
+// in the audit trail of the form
+func (h *Handler) WithdrawResponse(w http.ResponseWriter, r *http.Request) {
+	form, response := h.ownResponse(w, r, scopeWithdraw)
+	if response == nil {
+		return
+	}
+	if !form.AllowWithdraw {
+		u.Respond(w, u.Message(false, "Withdrawal is not allowed"), 403)
+		return
+	}
+	if response.Status == models.ResponseWithdrawn {
+		u.Respond(w, u.Message(false, "Response Withdrawn"), 410)
+		return
+	}
+
+	var err error
+	if form.KeepWithdrawn {
+		response, err = h.responses.WithdrawResponse(r.Context(), form.ID, response.ID)
+	} else {
+		response, err = h.responses.DeleteResponse(r.Context(), form.ID, response.ID)
+	}
+	if err == store.ErrNotFound {
+		u.Respond(w, u.Message(false, "Not Found"), 404)
+		return
+	}
+	if err != nil {
+		u.Respond(w, u.Message(false, err.Error()), 500)
+		return
+	}
+
+	// Let the respondent fill the form again, with the fillers in the link
+	// or those of the logged in respondent
+	var fillers []*models.FormAnonResponder
+	if claims := checkResponseToken(r.URL.Query().Get("token"), form.ID, scopeWithdraw); claims != nil {
+		for _, filler := range claims.Fillers {
+			fillers = append(fillers, &models.FormAnonResponder{FormID: form.ID, Filler: filler})
+		}
+	} else {
+		fillers = respondentFillers(r, form, rollNo(r))
+	}
+	if err := h.fillers.DeleteFillers(r.Context(), fillers); err != nil {
+		log.Println(err)
+	}
+
+	if response.Status != models.ResponseWaitlisted {
+		h.promoteWaitlist(r.Context(), form)
+	}
+
+	// Respondents of anonymous forms stay anonymous
+	h.record(r.Context(), &models.AuditEntry{FormID: form.ID, Actor: response.Filler,
+		Action: models.AuditWithdrawn, Target: response.ID})
+
+	log.Println("withdrew response", response.ID, "of form", form.ID)
+	u.Respond(w, u.Message(true, "Response withdrawn"), 200)
+}
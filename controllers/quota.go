@@ -0,0 +1,168 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/pulsejet/go-cerium/models"
+	"github.com/pulsejet/go-cerium/store"
+	"github.com/pulsejet/go-cerium/widgets"
+)
+
+// choiceQuota : an option or slot of a widget that responses count against
+type choiceQuota struct {
+	uid    string
+	option string
+}
+
+// eachCapped : call fn for each choice and slot widget of the form
+func eachCapped(form *models.Form, fn func(w *models.Widget, p widgets.Capped)) {
+	for pi := range form.Pages {
+		for wi := range form.Pages[pi].Widgets {
+			w := &form.Pages[pi].Widgets[wi]
+			_, props, err := widgets.Decode(w)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+			if p, ok := props.(widgets.Capped); ok {
+				fn(w, p)
+			}
+		}
+	}
+}
+
+// responseQuotas : the counters a response increments, all of which are kept
+// so that limits added later start from the right count. Forms with responses
+// from before counters were kept are seeded by counts
+func responseQuotas(form *models.Form, answers map[string]interface{}) ([]store.Quota, map[string]choiceQuota) {
+	quotas := []store.Quota{{Key: models.ResponsesCounter, Max: form.ResponseLimit}}
+	choices := map[string]choiceQuota{}
+
+	eachCapped(form, func(w *models.Widget, p widgets.Capped) {
+		capacities := p.Capacities()
+		picked, ok := widgets.ToSlice(answers[w.UID])
+		if !ok {
+			picked = []interface{}{answers[w.UID]}
+		}
+		for _, item := range picked {
+			option, ok := item.(string)
+			if !ok || option == "" {
+				continue
+			}
+			key := models.ChoiceCounter(w.UID, option)
+			quotas = append(quotas, store.Quota{Key: key, Max: capacities[option]})
+			choices[key] = choiceQuota{uid: w.UID, option: option}
+		}
+	})
+	return quotas, choices
+}
+
+// recount : set the counters of the form from its accepted responses, giving
+// those stored before they were counted the counters they would have now
+func (h *Handler) recount(ctx context.Context, form *models.Form) (map[string]int, error) {
+	responses, err := h.responses.FindResponses(ctx, form.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := map[string]int{models.ResponsesCounter: 0}
+	counters := map[string][]string{}
+	for _, response := range responses {
+		if response.Status == models.ResponseWaitlisted || response.Status == models.ResponseWithdrawn {
+			continue
+		}
+		keys := response.Counters
+		if len(keys) == 0 {
+			quotas, _ := responseQuotas(form, response.Responses)
+			for _, q := range quotas {
+				keys = append(keys, q.Key)
+			}
+			counters[response.ID] = keys
+		}
+		for _, key := range keys {
+			counts[key]++
+		}
+	}
+
+	err = h.responses.SetCounts(ctx, form.ID, counts, counters)
+	if err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// counts : the counters of the form, seeded from its responses if they were
+// never counted
+func (h *Handler) counts(ctx context.Context, form *models.Form) (map[string]int, error) {
+	counts, err := h.responses.FindCounts(ctx, form.ID)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := counts[models.ResponsesCounter]; ok {
+		return counts, nil
+	}
+	log.Println("seeding counters of form", form.ID, "from its responses")
+	return h.recount(ctx, form)
+}
+
+// promoteWaitlist : accept waitlisted responses in order while there are
+// places, returning the ids of the promoted responses
+func (h *Handler) promoteWaitlist(ctx context.Context, form *models.Form) map[string]bool {
+	promoted := map[string]bool{}
+	responses, err := h.responses.FindResponses(ctx, form.ID)
+	if err != nil {
+		log.Println(err)
+		return promoted
+	}
+
+	for _, response := range responses {
+		if response.Status != models.ResponseWaitlisted {
+			continue
+		}
+
+		// Responses for full options keep waiting, later ones may still fit
+		quotas, _ := responseQuotas(form, response.Responses)
+		err := h.responses.PromoteResponse(ctx, form.ID, response.ID, quotas)
+		if qe, ok := err.(*store.QuotaError); ok && qe.Key == models.ResponsesCounter {
+			break
+		}
+		if err != nil {
+			if _, ok := err.(*store.QuotaError); !ok && err != store.ErrConflict {
+				log.Println(err)
+			}
+			continue
+		}
+
+		promoted[response.ID] = true
+		log.Println("promoted response", response.ID, "of form", form.ID, "from the waitlist")
+	}
+	return promoted
+}
+
+// availability : whether the form accepts responses now, with the places left
+func (h *Handler) availability(ctx context.Context, form *models.Form) *models.Availability {
+	counts, err := h.counts(ctx, form)
+	if err != nil {
+		log.Println(err)
+	}
+	avail := form.Available(time.Now(), counts)
+
+	eachCapped(form, func(w *models.Widget, p widgets.Capped) {
+		for option, capacity := range p.Capacities() {
+			remaining := capacity - counts[models.ChoiceCounter(w.UID, option)]
+			if remaining < 0 {
+				remaining = 0
+			}
+			if avail.RemainingChoices == nil {
+				avail.RemainingChoices = map[string]map[string]int{}
+			}
+			if avail.RemainingChoices[w.UID] == nil {
+				avail.RemainingChoices[w.UID] = map[string]int{}
+			}
+			avail.RemainingChoices[w.UID][option] = remaining
+		}
+	})
+	return avail
+}
@@ -0,0 +1,195 @@
+package controllers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+
+	"github.com/pulsejet/go-cerium/models"
+	u "github.com/pulsejet/go-cerium/utils"
+)
+
+// RespondentClaims : JWT claims identifying the browser of an anonymous respondent
+type RespondentClaims struct {
+	Respondent string `json:"respondent"`
+	jwt.StandardClaims
+}
+
+// respondentLifetime : how long a browser keeps its respondent cookie
+const respondentLifetime = 365 * 24 * time.Hour
+
+// Fingerprint : request headers, or "ip" for the client address, that also
+// identify anonymous respondents, from the comma separated FINGERPRINT
+var Fingerprint = parseList(os.Getenv("FINGERPRINT"))
+
+// parseList : the items of a comma separated list, without spaces or empty items
+func parseList(s string) []string {
+	sources := []string{}
+	for _, source := range strings.Split(s, ",") {
+		if source = strings.TrimSpace(source); source != "" {
+			sources = append(sources, source)
+		}
+	}
+	return sources
+}
+
+// getRespondent : get the respondent id from a validly signed cookie
+func getRespondent(r *http.Request) string {
+	c, err := r.Cookie("respondent")
+	if err != nil {
+		return ""
+	}
+
+	claims := &RespondentClaims{}
+	tkn, err := jwt.ParseWithClaims(c.Value, claims, func(token *jwt.Token) (interface{}, error) {
+		return jwtKey, nil
+	})
+	if err != nil || !tkn.Valid {
+		return ""
+	}
+	return claims.Respondent
+}
+
+// setRespondent : issue a respondent cookie unless the browser has one
+func setRespondent(w http.ResponseWriter, r *http.Request) {
+	if getRespondent(r) != "" {
+		return
+	}
+
+	expirationTime := time.Now().Add(respondentLifetime)
+	claims := &RespondentClaims{
+		Respondent: u.RandomID(),
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: expirationTime.Unix(),
+		},
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	tokenString, err := token.SignedString(jwtKey)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	// Sent with responses too, which are posted to another path
+	http.SetCookie(w, &http.Cookie{
+		Name:     "respondent",
+		Value:    tokenString,
+		Path:     "/",
+		Expires:  expirationTime,
+		HttpOnly: true,
+	})
+}
+
+// fingerprint : hash of the configured properties of the request, if any
+func fingerprint(r *http.Request) string {
+	if len(Fingerprint) == 0 {
+		return ""
+	}
+
+	hash := sha256.New()
+	for _, source := range Fingerprint {
+		value := r.Header.Get(source)
+		if strings.EqualFold(source, "ip") {
+			value = r.RemoteAddr
+			if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+				value = host
+			}
+		}
+		hash.Write([]byte(value + "\n"))
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// respondentFillers : the records identifying who fills a single-response form,
+// any of which having filled it stops another response. Forms without login
+// identify browsers by their respondent cookie and fingerprint
+func respondentFillers(r *http.Request, form *models.Form, rno string) []*models.FormAnonResponder {
+	fillers := []*models.FormAnonResponder{}
+	if rno != "" {
+		fillers = append(fillers, &models.FormAnonResponder{FormID: form.ID, Filler: rno})
+	}
+	if form.RequireLogin {
+		return fillers
+	}
+	if id := getRespondent(r); id != "" {
+		fillers = append(fillers, &models.FormAnonResponder{FormID: form.ID, Filler: "respondent:" + id})
+	}
+	if fp := fingerprint(r); fp != "" {
+		fillers = append(fillers, &models.FormAnonResponder{FormID: form.ID, Filler: "fingerprint:" + fp})
+	}
+	return fillers
+}
+
+// hasFilled : whether any of the fillers has filled the form
+func (h *Handler) hasFilled(ctx context.Context, fillers []*models.FormAnonResponder) bool {
+	for _, filler := range fillers {
+		if h.HasFilledAnon(ctx, filler.FormID, filler.Filler) {
+			return true
+		}
+	}
+	return false
+}
+
+// ResponseClaims : JWT claims of links that let a respondent manage their response
+type ResponseClaims struct {
+	FormID     string `json:"form_id"`
+	ResponseID string `json:"response_id"`
+	Scope      string `json:"scope"`
+
+	// Fillers recorded with the response, forgotten when it is withdrawn
+	Fillers []string `json:"fillers,omitempty"`
+	jwt.StandardClaims
+}
+
+// Scopes of response links
+const (
+	scopeEdit     = "edit"
+	scopeWithdraw = "withdraw"
+)
+
+// responseToken : sign a link to a response for the given scope
+func responseToken(formid string, id string, scope string, fillers []*models.FormAnonResponder) string {
+	claims := &ResponseClaims{FormID: formid, ResponseID: id, Scope: scope}
+	for _, filler := range fillers {
+		claims.Fillers = append(claims.Fillers, filler.Filler)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	tokenString, err := token.SignedString(jwtKey)
+	if err != nil {
+		log.Println(err)
+		return ""
+	}
+	return tokenString
+}
+
+// checkResponseToken : get the claims of a link, if it was signed for the form and scope
+func checkResponseToken(tokenString string, formid string, scope string) *ResponseClaims {
+	claims := &ResponseClaims{}
+	tkn, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return jwtKey, nil
+	})
+	if err != nil || !tkn.Valid || claims.FormID != formid || claims.Scope != scope {
+		return nil
+	}
+	return claims
+}
+
+// ownerOf : keyed hash of a roll number, which finds the responses of a
+// logged in filler without telling the creator who filled them
+func ownerOf(rno string) string {
+	if rno == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, jwtKey)
+	mac.Write([]byte(rno))
+	return hex.EncodeToString(mac.Sum(nil))
+}
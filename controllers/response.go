@@ -3,208 +3,438 @@ package controllers
 import (
 	"context"
 	"encoding/json"
-	"fmt"
 	"log"
 	"net/http"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 
 	"github.com/pulsejet/go-cerium/models"
+	"github.com/pulsejet/go-cerium/store"
 	u "github.com/pulsejet/go-cerium/utils"
+	"github.com/pulsejet/go-cerium/validate"
+	"github.com/pulsejet/go-cerium/widgets"
 )
 
+// respondUnavailable : tell the client why the form does not accept responses
+func respondUnavailable(w http.ResponseWriter, avail *models.Availability) {
+	text := "Form Closed"
+	if avail.Reason == models.NotYetOpen {
+		text = "Form Not Open Yet"
+	}
+	msg := u.Message(false, text)
+	msg["reason"] = avail.Reason
+	u.Respond(w, msg, 404)
+}
+
+// respondReplaceError : tell the client why a response could not be changed
+func respondReplaceError(w http.ResponseWriter, err error, full string, choices map[string]choiceQuota) {
+	if qe, ok := err.(*store.QuotaError); ok {
+		msg := u.Message(false, full)
+		msg["reason"] = models.QuotaReached
+		if c, ok := choices[qe.Key]; ok {
+			msg["errors"] = validate.Errors{c.uid: c.option + " is full"}
+		}
+		u.Respond(w, msg, 409)
+		return
+	}
+	switch err {
+	case store.ErrConflict:
+		u.Respond(w, u.Message(false, "Response was changed, try again"), 409)
+	case store.ErrNotFound:
+		u.Respond(w, u.Message(false, "Not Found"), 404)
+	default:
+		u.Respond(w, u.Message(false, err.Error()), 500)
+	}
+}
+
 // ResponsesRequest : helper for post processing
 type ResponsesRequest struct {
 	Type string `json:"type"`
 }
 
 // CreateResponse : API handler for POST-ing new response
-var CreateResponse = func(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) CreateResponse(w http.ResponseWriter, r *http.Request) {
 	formid := mux.Vars(r)["formid"]
 
 	// Check if login is required
-	rno := GetRollNo(w, r, false)
-	collection := u.Collection(r.Context(), "forms")
-	objID, _ := primitive.ObjectIDFromHex(formid)
-	filt := bson.M{"_id": objID}
-	form := &models.Form{}
-	collection.FindOne(r.Context(), filt).Decode(form)
+	rno := rollNo(r)
+	form, err := h.forms.FindForm(r.Context(), formid)
+	if err != nil {
+		u.Respond(w, u.Message(false, "Not Found"), 404)
+		return
+	}
 	if form.RequireLogin && rno == "" {
-		u.Respond(w, u.Message(false, "Not Found"), 401)
+		respondUnauthorized(w, r)
 		return
 	}
 
-	// Return error if form is closed
-	year2000 := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
-	if form.IsClosed || time.Now().UTC().After(form.CloseOn) && year2000.Before(form.CloseOn) {
-		u.Respond(w, u.Message(false, "Form Closed"), 404)
+	// Drafts cannot be filled, not even by their creator
+	if !form.IsPublished() {
+		u.Respond(w, u.Message(false, "Form Not Published"), 403)
+		return
+	}
+
+	// Return error if form is not open
+	if avail := h.availability(r.Context(), form); !avail.Open {
+		respondUnavailable(w, avail)
 		return
 	}
 
 	// Save the response
 	response := &models.FormResponse{}
-	err := json.NewDecoder(r.Body).Decode(response)
+	err = json.NewDecoder(r.Body).Decode(response)
 	if err != nil {
 		u.Respond(w, u.Message(false, err.Error()), 400)
 		return
 	}
 
+	// Check answers against the widgets of the form
+	if response.Responses == nil {
+		response.Responses = map[string]interface{}{}
+	}
+	if errs := validate.Response(form, response.Responses); errs != nil {
+		msg := u.Message(false, "Invalid response")
+		msg["errors"] = errs
+		u.Respond(w, msg, 422)
+		return
+	}
+
 	// Fill in the responses
 	response.FormID = formid
+	response.Version = form.Version
 	response.Timestamp = time.Now()
 	response.Responses["timestamp"] = response.Timestamp
 	if form.CollectEmail {
 		response.Filler = rno
 		response.Responses["filler"] = response.Filler
 	}
+	response.Owner = ownerOf(rno)
+
+	// Single-response forms record the fillers with the response, so that
+	// only one of concurrent submissions is saved
+	var fillers []*models.FormAnonResponder
+	if form.SingleResponse {
+		// Anonymous respondents get their cookie when they open the form
+		if rno == "" && getRespondent(r) == "" {
+			u.Respond(w, u.Message(false, "Open the form again to respond"), 403)
+			return
+		}
+
+		// Check if form already filled for single response
+		fillers = respondentFillers(r, form, rno)
+		if h.hasFilled(r.Context(), fillers) {
+			u.Respond(w, u.Message(false, "User has already filled this form"), 403)
+			return
+		}
+	}
+
+	// Add the document to the responses collection, unless it is over a quota
+	response.Status = models.ResponseAccepted
+	quotas, choices := responseQuotas(form, response.Responses)
+	id, err := h.responses.InsertCountedResponse(r.Context(), response, quotas, fillers)
+	if qe, ok := err.(*store.QuotaError); ok {
+		if c, ok := choices[qe.Key]; ok {
+			msg := u.Message(false, "Option Full")
+			msg["reason"] = models.QuotaReached
+			msg["errors"] = validate.Errors{c.uid: c.option + " is full"}
+			u.Respond(w, msg, 409)
+			return
+		}
+		if !form.Waitlist {
+			respondUnavailable(w, &models.Availability{Reason: models.QuotaReached})
+			return
+		}
+
+		// Over the limit, wait for a place
+		response.Status = models.ResponseWaitlisted
+		id, err = h.responses.InsertCountedResponse(r.Context(), response, nil, fillers)
 
-	// Check if form already filled for single response
-	if form.SingleResponse && HasFilledAnon(r.Context(), formid, rno) {
-		u.Respond(w, u.Message(false, "User has already filled this form"), 403)
+		// A place may have been freed while this was being saved
+		if err == nil && h.promoteWaitlist(r.Context(), form)[id] {
+			response.Status = models.ResponseAccepted
+		}
+	}
+	if err == store.ErrDuplicate {
+		u.Respond(w, u.Message(false, "User has already filled this form"), 409)
+		return
+	}
+	if err != nil {
+		u.Respond(w, u.Message(false, err.Error()), 500)
 		return
 	}
 
-	// Create an anon filler object
-	if form.RequireLogin {
+	// Create an anon filler object for forms that were not recorded above
+	if form.RequireLogin && fillers == nil {
 		anonResponse := &models.FormAnonResponder{}
 		anonResponse.Filler = rno
 		anonResponse.FormID = formid
 
 		// Add the anon filler to fillers collection
-		collection = u.Collection(r.Context(), "filler")
-		collection.InsertOne(r.Context(), anonResponse)
+		h.fillers.InsertFiller(r.Context(), anonResponse)
 	}
 
-	// Add the document to the responses collection
-	collection = u.Collection(r.Context(), "responses")
-	cur, _ := collection.InsertOne(r.Context(), response)
-	id := cur.InsertedID
-
 	// Log to console
-	log.Println(rno, ": new response for form", formid)
+	log.Println(rno, ": new", response.Status, "response for form", formid)
 
-	u.Respond(w, map[string]interface{}{"id": id}, 200)
+	// Respondents may come back to edit with the signed link
+	res := map[string]interface{}{"id": id, "status": response.Status}
+	if form.AllowEdit {
+		res["edit_token"] = responseToken(formid, id, scopeEdit, nil)
+	}
+	if form.AllowWithdraw {
+		if fillers == nil && rno != "" {
+			fillers = []*models.FormAnonResponder{{FormID: formid, Filler: rno}}
+		}
+		res["withdraw_token"] = responseToken(formid, id, scopeWithdraw, fillers)
+	}
+	u.Respond(w, res, 200)
 }
 
-// GetResponses : API handler for getting JSON responses (for CSV)
-var GetResponses = func(w http.ResponseWriter, r *http.Request) {
-	// Check authentication
-	rno := GetRollNo(w, r, true)
-	if rno == "" {
+// GetResponses : API handler for getting JSON responses (for CSV), behind ResultsAccess
+func (h *Handler) GetResponses(w http.ResponseWriter, r *http.Request) {
+	// Postprocess if wanted, which needs the export scope
+	rq := &ResponsesRequest{}
+	json.NewDecoder(r.Body).Decode(rq)
+	if rq.Type == "" {
+		rq.Type = r.URL.Query().Get("type")
+	}
+	scope := models.ScopeRaw
+	if rq.Type == "array" {
+		scope = models.ScopeExport
+	}
+	access := results(w, r, scope)
+	if access == nil {
 		return
 	}
+	form := access.form
 
-	id := mux.Vars(r)["formid"]
-	data := strings.Split(id, "-")
-	formid := data[0]
-	token := data[1]
-
-	// Check privileges
-	form := &models.Form{}
-	collection := u.Collection(r.Context(), "forms")
-	objID, _ := primitive.ObjectIDFromHex(formid)
-	filt := bson.M{"$and": bson.A{
-		bson.M{"_id": objID},
-		bson.M{"responsetoken": token}}}
-	err := collection.FindOne(r.Context(), filt).Decode(&form)
+	// Get responses
+	responses, err := h.responses.FindResponses(r.Context(), form.ID)
 	if err != nil {
 		u.Respond(w, u.Message(false, err.Error()), 400)
 		return
 	}
 
-	// Get responses
-	responses := []*models.FormResponse{}
-	collection = u.Collection(r.Context(), "responses")
-	cur, err := collection.Find(r.Context(), bson.M{"formid": formid})
+	if rq.Type == "array" {
+		u.Respond(w, arrayResponse(form, h.responseRevisions(r.Context(), form, responses), responses), 200)
+		return
+	}
+
+	u.Respond(w, responses, 200)
+}
+
+// DeleteResponse : API handler for an editor removing one response,
+// which gives its place to the first waitlisted response
+func (h *Handler) DeleteResponse(w http.ResponseWriter, r *http.Request) {
+	form, rno := h.sharedForm(w, r, models.RoleEditor)
+	if form == nil {
+		return
+	}
+
+	response, err := h.responses.DeleteResponse(r.Context(), form.ID, mux.Vars(r)["rid"])
+	if err == store.ErrNotFound {
+		u.Respond(w, u.Message(false, "Not Found"), 404)
+		return
+	}
 	if err != nil {
-		u.Respond(w, u.Message(false, err.Error()), 400)
+		u.Respond(w, u.Message(false, err.Error()), 500)
 		return
 	}
 
-	// Iterate and collect responses
-	for cur.Next(context.TODO()) {
-		var elem models.FormResponse
-		err := cur.Decode(&elem)
+	if response.Status != models.ResponseWaitlisted {
+		h.promoteWaitlist(r.Context(), form)
+	}
+
+	log.Println(rno, ": deleted response", response.ID, "of form", form.ID)
+	u.Respond(w, u.Message(true, "Response deleted"), 200)
+}
+
+// exportField : a column of the array response
+type exportField struct {
+	uid    string
+	name   string
+	format func(v interface{}) string
+}
+
+// responseRevisions : get the earlier versions of the form that responses were submitted against
+func (h *Handler) responseRevisions(ctx context.Context, form *models.Form, r []*models.FormResponse) map[int]*models.Form {
+	revisions := map[int]*models.Form{}
+	for _, response := range r {
+		v := response.Version
+		if _, ok := revisions[v]; ok || v == form.Version {
+			continue
+		}
+		old, err := h.formAt(ctx, form, v)
 		if err != nil {
-			log.Println(err)
+			// Answered before history was kept, the current form is the best guess
+			old = nil
 		}
-		responses = append(responses, &elem)
+		revisions[v] = old
 	}
+	return revisions
+}
 
-	// Postprocess if wanted
-	rq := &ResponsesRequest{}
-	json.NewDecoder(r.Body).Decode(rq)
-	if rq.Type == "array" {
-		u.Respond(w, arrayResponse(form, responses), 200)
-		return
+// arrayResponse : tabulate responses under the current questions, keeping
+// columns for removed questions and noting questions that were reworded
+// since a response was submitted
+func arrayResponse(f *models.Form, revisions map[int]*models.Form, r []*models.FormResponse) [][]string {
+	// Columns of each version of the form
+	current := formFields(f)
+	fieldsAt := map[int]map[string]exportField{f.Version: fieldIndex(current)}
+	versions := []int{}
+	for v, old := range revisions {
+		if old != nil {
+			fieldsAt[v] = fieldIndex(widgetFields(old))
+			versions = append(versions, v)
+		}
 	}
+	sort.Ints(versions)
 
-	u.Respond(w, responses, 200)
-}
+	// Current questions with earlier wordings, then removed questions
+	fields := make([]exportField, len(current))
+	copy(fields, current)
+	for j := range fields {
+		seen := map[string]bool{current[j].name: true}
+		for _, v := range versions {
+			if old, ok := fieldsAt[v][fields[j].uid]; ok && !seen[old.name] {
+				seen[old.name] = true
+				fields[j].name += " (previously " + strconv.Quote(old.name) + ")"
+			}
+		}
+	}
+	present := fieldIndex(fields)
+	for i := len(versions) - 1; i >= 0; i-- {
+		for _, old := range widgetFields(revisions[versions[i]]) {
+			if _, ok := present[old.uid]; !ok {
+				present[old.uid] = old
+				old.name += " (removed)"
+				fields = append(fields, old)
+			}
+		}
+	}
 
-func arrayResponse(f *models.Form, r []*models.FormResponse) [][]string {
-	// Get form fields
-	fields, fnames := formFields(f)
+	// Mixed versions get columns telling them apart
+	mixed := len(versions) > 0
+
+	// Waitlists and withdrawals get a column telling accepted responses apart
+	waitlist := f.Waitlist
+	for _, response := range r {
+		waitlist = waitlist || response.Status == models.ResponseWaitlisted ||
+			response.Status == models.ResponseWithdrawn
+	}
 
 	// Make grand array of arrays
 	a := make([][]string, len(r)+1)
 
 	// Construct header
-	a[0] = make([]string, len(fields))
+	a[0] = make([]string, 0, len(fields)+3)
 	for j := range fields {
-		a[0][j] = fnames[fields[j]]
+		a[0] = append(a[0], fields[j].name)
+	}
+	if waitlist {
+		a[0] = append(a[0], "Status")
+	}
+	if mixed {
+		a[0] = append(a[0], "Form Version", "Reworded Questions")
 	}
 
 	// Iterate each response
 	for iw := range r {
 		i := iw + 1
-		a[i] = make([]string, len(fields))
+		a[i] = make([]string, 0, len(fields)+3)
 
+		// Format answers as the question was at submission
+		asked, ok := fieldsAt[r[iw].Version]
+		if !ok {
+			asked = fieldsAt[f.Version]
+		}
+		reworded := []string{}
 		for j := range fields {
-			cf := r[iw].Responses[fields[j]]
-			switch cf.(type) {
-			default:
-				a[i][j] = fmt.Sprintf("%s", cf)
-			case float32, float64:
-				a[i][j] = fmt.Sprintf("%9.f", cf)
-			case nil:
-				a[i][j] = ""
-			case primitive.DateTime:
-				a[i][j] = primitiveToTime(cf.(primitive.DateTime)).String()
+			field := fields[j]
+			v := r[iw].Responses[field.uid]
+			if old, ok := asked[field.uid]; ok {
+				if cur, ok := fieldsAt[f.Version][field.uid]; ok && v != nil && old.name != cur.name {
+					reworded = append(reworded, cur.name+": asked as "+strconv.Quote(old.name))
+				}
+				field = old
+			}
+			a[i] = append(a[i], field.format(v))
+		}
+		if waitlist {
+			status := r[iw].Status
+			if status == "" {
+				status = models.ResponseAccepted
 			}
+			a[i] = append(a[i], status)
+		}
+		if mixed {
+			a[i] = append(a[i], strconv.Itoa(r[iw].Version), strings.Join(reworded, "; "))
 		}
 	}
 
 	return a
 }
 
-func formFields(f *models.Form) ([]string, map[string]string) {
-	// Initialize
-	m := map[string]string{}
-	a := make([]string, 0)
+// fieldIndex : index columns by widget UID
+func fieldIndex(fields []exportField) map[string]exportField {
+	index := map[string]exportField{}
+	for _, field := range fields {
+		index[field.uid] = field
+	}
+	return index
+}
 
+func formFields(f *models.Form) []exportField {
 	// Add extra fields
-	a = append(a, "timestamp")
-	m["timestamp"] = "Timestamp"
+	a := []exportField{{uid: "timestamp", name: "Timestamp", format: formatValue}}
 
 	if f.CollectEmail {
-		a = append(a, "filler")
-		m["filler"] = "Filler"
+		a = append(a, exportField{uid: "filler", name: "Filler", format: formatValue})
 	}
 
-	// Construct fields
+	return append(a, widgetFields(f)...)
+}
+
+// widgetFields : columns for the widgets that take answers
+func widgetFields(f *models.Form) []exportField {
+	a := []exportField{}
 	for pi := range f.Pages {
 		for wi := range f.Pages[pi].Widgets {
-			m[f.Pages[pi].Widgets[wi].UID] = f.Pages[pi].Widgets[wi].Props["question"].(string)
-			a = append(a, f.Pages[pi].Widgets[wi].UID)
+			w := &f.Pages[pi].Widgets[wi]
+			t, p, err := widgets.Decode(w)
+			if err != nil {
+				log.Println(err)
+			}
+			if t.Display {
+				continue
+			}
+
+			a = append(a, exportField{uid: w.UID, name: widgets.Label(w), format: func(v interface{}) string {
+				if v == nil {
+					return ""
+				}
+				return t.Format(p, v)
+			}})
 		}
 	}
 
-	return a, m
+	return a
+}
+
+// formatValue : render a field that is not a widget
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case primitive.DateTime:
+		return primitiveToTime(v).String()
+	case time.Time:
+		return v.String()
+	}
+	return widgets.FormatValue(v)
 }
 
 // Time returns the date as a time type.
@@ -213,16 +443,10 @@ func primitiveToTime(d primitive.DateTime) time.Time {
 }
 
 // HasFilledAnon returns true if the person has already filled this form
-func HasFilledAnon(ctx context.Context, formid string, filler string) bool {
-	// Filter matching form id and filler
-	collection := u.Collection(ctx, "filler")
-	anonExist := collection.FindOne(ctx, bson.M{
-		"$and": bson.A{
-			bson.M{"formid": formid},
-			bson.M{"filler": filler}}})
-
-	// Try to get the object
-	anonObj := &models.FormAnonResponder{}
-	err := anonExist.Decode(anonObj)
-	return err == nil
+func (h *Handler) HasFilledAnon(ctx context.Context, formid string, filler string) bool {
+	filled, err := h.fillers.HasFilled(ctx, formid, filler)
+	if err != nil {
+		log.Println(err)
+	}
+	return filled
 }
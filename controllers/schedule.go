@@ -0,0 +1,173 @@
+package controllers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/pulsejet/go-cerium/models"
+	"github.com/pulsejet/go-cerium/store"
+	u "github.com/pulsejet/go-cerium/utils"
+	"github.com/pulsejet/go-cerium/validate"
+	"github.com/pulsejet/go-cerium/widgets"
+)
+
+// booking : a response that picked a slot
+type booking struct {
+	ID        string    `json:"id"`
+	Filler    string    `json:"filler"`
+	Timestamp time.Time `json:"timestamp"`
+	Status    string    `json:"status"`
+}
+
+// slotSchedule : a slot with the responses that booked it
+type slotSchedule struct {
+	widgets.Slot
+	Label     string    `json:"label"`
+	Booked    int       `json:"booked"`
+	Remaining int       `json:"remaining"`
+	Bookings  []booking `json:"bookings"`
+}
+
+// widgetSchedule : the slots of a slot widget
+type widgetSchedule struct {
+	UID      string         `json:"uid"`
+	Question string         `json:"question"`
+	Slots    []slotSchedule `json:"slots"`
+}
+
+// slotWidget : get the props of the slot widget with the given UID
+func slotWidget(form *models.Form, uid string) *widgets.SlotProps {
+	var found *widgets.SlotProps
+	eachCapped(form, func(w *models.Widget, p widgets.Capped) {
+		if p, ok := p.(*widgets.SlotProps); ok && w.UID == uid {
+			found = p
+		}
+	})
+	return found
+}
+
+// GetSchedule : API handler for the collaborators getting who booked each slot
+func (h *Handler) GetSchedule(w http.ResponseWriter, r *http.Request) {
+	form, _ := h.sharedForm(w, r, models.RoleViewer)
+	if form == nil {
+		return
+	}
+
+	responses, err := h.responses.FindResponses(r.Context(), form.ID)
+	if err != nil {
+		u.Respond(w, u.Message(false, err.Error()), 500)
+		return
+	}
+	counts, err := h.counts(r.Context(), form)
+	if err != nil {
+		u.Respond(w, u.Message(false, err.Error()), 500)
+		return
+	}
+
+	schedule := []widgetSchedule{}
+	eachCapped(form, func(w *models.Widget, p widgets.Capped) {
+		props, ok := p.(*widgets.SlotProps)
+		if !ok {
+			return
+		}
+
+		ws := widgetSchedule{UID: w.UID, Question: props.Question, Slots: []slotSchedule{}}
+		for _, slot := range props.Slots {
+			ss := slotSchedule{Slot: slot, Label: slot.Label(), Bookings: []booking{}}
+			ss.Booked = counts[models.ChoiceCounter(w.UID, slot.ID)]
+			ss.Remaining = slot.Capacity - ss.Booked
+			if ss.Remaining < 0 {
+				ss.Remaining = 0
+			}
+
+			// Waitlisted responses are listed without holding a place
+			for _, response := range responses {
+				if response.Responses[w.UID] != slot.ID {
+					continue
+				}
+				status := response.Status
+				if status == "" {
+					status = models.ResponseAccepted
+				}
+				ss.Bookings = append(ss.Bookings, booking{ID: response.ID, Filler: response.Filler,
+					Timestamp: response.Timestamp, Status: status})
+			}
+			ws.Slots = append(ws.Slots, ss)
+		}
+		schedule = append(schedule, ws)
+	})
+
+	u.Respond(w, schedule, 200)
+}
+
+// MoveBooking : API handler for an editor moving a response to another slot,
+// which must have a free place
+func (h *Handler) MoveBooking(w http.ResponseWriter, r *http.Request) {
+	form, rno := h.sharedForm(w, r, models.RoleEditor)
+	if form == nil {
+		return
+	}
+
+	move := &struct {
+		UID  string `json:"uid"`
+		Slot string `json:"slot"`
+	}{}
+	err := json.NewDecoder(r.Body).Decode(move)
+	if err != nil {
+		u.Respond(w, u.Message(false, err.Error()), 400)
+		return
+	}
+
+	// The slot must exist in the published form
+	props := slotWidget(form, move.UID)
+	if props == nil {
+		msg := u.Message(false, "Invalid move")
+		msg["errors"] = validate.Errors{"uid": "must be a slot question"}
+		u.Respond(w, msg, 422)
+		return
+	}
+	if _, ok := props.Slot(move.Slot); !ok {
+		msg := u.Message(false, "Invalid move")
+		msg["errors"] = validate.Errors{move.UID: "must be one of the slots"}
+		u.Respond(w, msg, 422)
+		return
+	}
+
+	response, err := h.responses.FindResponse(r.Context(), form.ID, mux.Vars(r)["rid"])
+	if err == store.ErrNotFound {
+		u.Respond(w, u.Message(false, "Not Found"), 404)
+		return
+	}
+	if err != nil {
+		u.Respond(w, u.Message(false, err.Error()), 500)
+		return
+	}
+	if response.Status == models.ResponseWithdrawn {
+		u.Respond(w, u.Message(false, "Response Withdrawn"), 410)
+		return
+	}
+
+	// Take the new place and give up the old one together
+	if response.Responses == nil {
+		response.Responses = map[string]interface{}{}
+	}
+	response.Responses[move.UID] = move.Slot
+	quotas, choices := responseQuotas(form, response.Responses)
+	err = h.responses.ReplaceResponse(r.Context(), response, quotas, rno)
+	if err != nil {
+		respondReplaceError(w, err, "Slot Full", choices)
+		return
+	}
+
+	// The old slot may have a waitlisted response for it
+	if response.Status != models.ResponseWaitlisted {
+		h.promoteWaitlist(r.Context(), form)
+	}
+
+	log.Println(rno, ": moved response", response.ID, "of form", form.ID, "to slot", move.Slot)
+	u.Respond(w, u.Message(true, "Booking moved"), 200)
+}
@@ -0,0 +1,267 @@
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/pulsejet/go-cerium/models"
+	"github.com/pulsejet/go-cerium/store"
+	u "github.com/pulsejet/go-cerium/utils"
+	"github.com/pulsejet/go-cerium/validate"
+)
+
+// resultsKey : context key of the access granted by ResultsAccess
+type resultsKey struct{}
+
+// resultsAccess : the form whose results are requested, and the share
+// link used to see them, nil for collaborators who see everything
+type resultsAccess struct {
+	form *models.Form
+	link *models.ShareLink
+}
+
+// allows : true if the results may be seen with the scope
+func (a *resultsAccess) allows(scope string) bool {
+	return a.link == nil || a.link.Allows(scope)
+}
+
+// results : get the access granted to the request, responding and returning
+// nil if it does not allow the scope
+func results(w http.ResponseWriter, r *http.Request, scope string) *resultsAccess {
+	access, _ := r.Context().Value(resultsKey{}).(*resultsAccess)
+	if access == nil {
+		respondUnauthorized(w, r)
+		return nil
+	}
+	if !access.allows(scope) {
+		u.Respond(w, u.Message(false, "Share link does not allow "+scope), 403)
+		return nil
+	}
+	return access
+}
+
+// hashShareToken : the hash a share token is stored and looked up by
+func hashShareToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// newShareToken : a random share token
+func newShareToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// ResultsAccess : middleware letting collaborators, or anyone with an active
+// share link of the form given as the token query parameter, through to the
+// results of the form in {formid}. It goes behind OptionalAuth to find the collaborator
+func (h *Handler) ResultsAccess(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		formid := mux.Vars(r)["formid"]
+
+		access := &resultsAccess{}
+		if token := r.URL.Query().Get("token"); token != "" {
+			now := time.Now()
+			link, err := h.links.FindShareLinkByHash(r.Context(), hashShareToken(token))
+			if err != nil || link.FormID != formid || !link.Active(now) {
+				u.Respond(w, u.Message(false, "Share link is invalid, expired or revoked"), 401)
+				return
+			}
+			access.form, err = h.forms.FindForm(r.Context(), formid)
+			if err != nil {
+				u.Respond(w, u.Message(false, "Not Found"), 404)
+				return
+			}
+			access.link = link
+			if err := h.links.TouchShareLink(r.Context(), link.ID, now); err != nil {
+				log.Println("could not note use of share link", link.ID, ":", err)
+			}
+		} else {
+			// Check authentication
+			rno := rollNo(r)
+			if rno == "" {
+				respondUnauthorized(w, r)
+				return
+			}
+
+			// Check privileges
+			var err error
+			access.form, err = h.forms.FindForm(r.Context(), formid)
+			if err != nil {
+				u.Respond(w, u.Message(false, "Not Found"), 404)
+				return
+			}
+			if !access.form.Can(rno, models.RoleViewer) {
+				u.Respond(w, u.Message(false, "Only collaborators can see responses. Unauthorized access"), 403)
+				return
+			}
+		}
+
+		next(w, r.WithContext(context.WithValue(r.Context(), resultsKey{}, access)))
+	}
+}
+
+// shareLinkRequest : body of a request for a new share link
+type shareLinkRequest struct {
+	Name    string          `json:"name"`
+	Scopes  []string        `json:"scopes"`
+	Expires models.NullTime `json:"expires"`
+}
+
+// CreateShareLink : API handler for an owner creating a link to the results
+// of the form, whose token is only ever shown in the response
+func (h *Handler) CreateShareLink(w http.ResponseWriter, r *http.Request) {
+	form, rno := h.sharedForm(w, r, models.RoleOwner)
+	if form == nil {
+		return
+	}
+
+	rq := &shareLinkRequest{}
+	err := json.NewDecoder(r.Body).Decode(rq)
+	if err != nil {
+		u.Respond(w, u.Message(false, err.Error()), 400)
+		return
+	}
+
+	now := time.Now()
+	errs := validate.Errors{}
+	if strings.TrimSpace(rq.Name) == "" {
+		errs["name"] = "must not be empty"
+	}
+	if len(rq.Scopes) == 0 {
+		errs["scopes"] = "must not be empty"
+	}
+	for _, scope := range rq.Scopes {
+		if !models.ValidScope(scope) {
+			errs["scopes"] = "must be summary, raw or export"
+		}
+	}
+	if rq.Expires.Valid && !rq.Expires.Time.After(now) {
+		errs["expires"] = "must be in the future"
+	}
+	if len(errs) > 0 {
+		msg := u.Message(false, "Invalid share link")
+		msg["errors"] = errs
+		u.Respond(w, msg, 422)
+		return
+	}
+
+	token, err := newShareToken()
+	if err != nil {
+		u.Respond(w, u.Message(false, err.Error()), 500)
+		return
+	}
+	link := &models.ShareLink{FormID: form.ID, Name: strings.TrimSpace(rq.Name), Scopes: rq.Scopes,
+		Created: now, CreatedBy: rno, Expires: rq.Expires, TokenHash: hashShareToken(token)}
+	_, err = h.links.InsertShareLink(r.Context(), link)
+	if err != nil {
+		u.Respond(w, u.Message(false, err.Error()), 500)
+		return
+	}
+	h.record(r.Context(), &models.AuditEntry{FormID: form.ID, Actor: rno, Action: models.AuditShareLinkCreated,
+		Target: link.ID, Details: map[string]string{"name": link.Name, "scopes": strings.Join(link.Scopes, ",")}})
+
+	log.Println(rno, ": created share link", link.ID, "of form", form.ID)
+	u.Respond(w, struct {
+		*models.ShareLink
+		Token string `json:"token"`
+	}{link, token}, 200)
+}
+
+// GetShareLinks : API handler for the owners listing the share links of a form
+func (h *Handler) GetShareLinks(w http.ResponseWriter, r *http.Request) {
+	form, _ := h.sharedForm(w, r, models.RoleOwner)
+	if form == nil {
+		return
+	}
+
+	links, err := h.links.FindShareLinks(r.Context(), form.ID)
+	if err != nil {
+		u.Respond(w, u.Message(false, err.Error()), 500)
+		return
+	}
+	u.Respond(w, links, 200)
+}
+
+// RevokeShareLink : API handler for an owner revoking a share link, which
+// is kept so that owners can still see when it was used
+func (h *Handler) RevokeShareLink(w http.ResponseWriter, r *http.Request) {
+	form, rno := h.sharedForm(w, r, models.RoleOwner)
+	if form == nil {
+		return
+	}
+
+	lid := mux.Vars(r)["lid"]
+	err := h.links.RevokeShareLink(r.Context(), form.ID, lid, time.Now())
+	if err == store.ErrNotFound {
+		u.Respond(w, u.Message(false, "Not Found"), 404)
+		return
+	}
+	if err != nil {
+		u.Respond(w, u.Message(false, err.Error()), 500)
+		return
+	}
+	h.record(r.Context(), &models.AuditEntry{FormID: form.ID, Actor: rno, Action: models.AuditShareLinkRevoked,
+		Target: lid})
+
+	log.Println(rno, ": revoked share link", lid, "of form", form.ID)
+	u.Respond(w, u.Message(true, "Share link revoked"), 200)
+}
+
+// responseSummary : counts of the responses to a form and of the options they picked
+type responseSummary struct {
+	Accepted   int                       `json:"accepted"`
+	Waitlisted int                       `json:"waitlisted"`
+	Withdrawn  int                       `json:"withdrawn"`
+	Choices    map[string]map[string]int `json:"choices"`
+}
+
+// GetResponseSummary : API handler for the counts of the responses to a form,
+// behind ResultsAccess
+func (h *Handler) GetResponseSummary(w http.ResponseWriter, r *http.Request) {
+	access := results(w, r, models.ScopeSummary)
+	if access == nil {
+		return
+	}
+
+	responses, err := h.responses.FindResponses(r.Context(), access.form.ID)
+	if err != nil {
+		u.Respond(w, u.Message(false, err.Error()), 400)
+		return
+	}
+	summary := &responseSummary{Choices: map[string]map[string]int{}}
+	for _, response := range responses {
+		switch response.Status {
+		case models.ResponseWaitlisted:
+			summary.Waitlisted++
+			continue
+		case models.ResponseWithdrawn:
+			summary.Withdrawn++
+			continue
+		}
+		summary.Accepted++
+
+		// Options are counted as picked by accepted responses
+		_, choices := responseQuotas(access.form, response.Responses)
+		for _, c := range choices {
+			if summary.Choices[c.uid] == nil {
+				summary.Choices[c.uid] = map[string]int{}
+			}
+			summary.Choices[c.uid][c.option]++
+		}
+	}
+	u.Respond(w, summary, 200)
+}
@@ -0,0 +1,217 @@
+package controllers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/pulsejet/go-cerium/models"
+	"github.com/pulsejet/go-cerium/store"
+	u "github.com/pulsejet/go-cerium/utils"
+	"github.com/pulsejet/go-cerium/validate"
+)
+
+// OfferTransfer : API handler for an owner or a site administrator offering
+// the form to another registered user, who becomes its creator once they accept
+func (h *Handler) OfferTransfer(w http.ResponseWriter, r *http.Request) {
+	var form *models.Form
+	var rno string
+	if CurrentUser(r).HasRole(SiteRoleAdmin) {
+		form, rno = h.adminForm(w, r)
+	} else {
+		form, rno = h.sharedForm(w, r, models.RoleOwner)
+	}
+	if form == nil {
+		return
+	}
+
+	offer := &struct {
+		RollNumber string `json:"rno"`
+		KeepRole   string `json:"keep_role"`
+	}{}
+	err := json.NewDecoder(r.Body).Decode(offer)
+	if err != nil {
+		u.Respond(w, u.Message(false, err.Error()), 400)
+		return
+	}
+
+	errs := validate.Errors{}
+	if offer.RollNumber == "" {
+		errs["rno"] = "must not be empty"
+	} else if offer.RollNumber == form.Creator {
+		errs["rno"] = "is the creator of the form"
+	} else if _, err := h.users.FindUser(r.Context(), offer.RollNumber); err == store.ErrNotFound {
+		errs["rno"] = "must be a registered user"
+	} else if err != nil {
+		u.Respond(w, u.Message(false, err.Error()), 500)
+		return
+	}
+	if offer.KeepRole != "" && !models.ValidRole(offer.KeepRole) {
+		errs["keep_role"] = "must be owner, editor or viewer"
+	}
+	if len(errs) > 0 {
+		msg := u.Message(false, "Invalid transfer")
+		msg["errors"] = errs
+		u.Respond(w, msg, 422)
+		return
+	}
+
+	// A new offer replaces the pending one
+	transfer := &models.Transfer{FormID: form.ID, Name: form.Name, From: rno, To: offer.RollNumber,
+		Offered: time.Now(), KeepRole: offer.KeepRole}
+	err = h.transfers.SetTransfer(r.Context(), transfer)
+	if err != nil {
+		u.Respond(w, u.Message(false, err.Error()), 500)
+		return
+	}
+	h.record(r.Context(), &models.AuditEntry{FormID: form.ID, Actor: rno, Action: models.AuditTransferOffered,
+		Target: transfer.To, Details: map[string]string{"keep_role": transfer.KeepRole}})
+
+	log.Println(rno, ": offered form", form.ID, "to", transfer.To)
+	u.Respond(w, transfer, 200)
+}
+
+// GetTransfer : API handler for the owners getting the pending transfer of a form
+func (h *Handler) GetTransfer(w http.ResponseWriter, r *http.Request) {
+	form, _ := h.sharedForm(w, r, models.RoleOwner)
+	if form == nil {
+		return
+	}
+
+	transfer, err := h.transfers.FindTransfer(r.Context(), form.ID)
+	if err == store.ErrNotFound {
+		u.Respond(w, u.Message(false, "Not Found"), 404)
+		return
+	}
+	if err != nil {
+		u.Respond(w, u.Message(false, err.Error()), 500)
+		return
+	}
+	u.Respond(w, transfer, 200)
+}
+
+// pendingTransfer : get the transfer of the form in the request, if the
+// user is who it is offered to, an owner of the form or a site administrator
+func (h *Handler) pendingTransfer(w http.ResponseWriter, r *http.Request) (*models.Transfer, string) {
+	rno := rollNo(r)
+	transfer, err := h.transfers.FindTransfer(r.Context(), mux.Vars(r)["id"])
+	if err == store.ErrNotFound {
+		u.Respond(w, u.Message(false, "Not Found"), 404)
+		return nil, ""
+	}
+	if err != nil {
+		u.Respond(w, u.Message(false, err.Error()), 500)
+		return nil, ""
+	}
+	if transfer.To != rno && !CurrentUser(r).HasRole(SiteRoleAdmin) {
+		if form, _ := h.sharedForm(w, r, models.RoleOwner); form == nil {
+			return nil, ""
+		}
+	}
+	return transfer, rno
+}
+
+// CancelTransfer : API handler for an owner or administrator withdrawing the pending transfer,
+// or for the user it is offered to declining it
+func (h *Handler) CancelTransfer(w http.ResponseWriter, r *http.Request) {
+	transfer, rno := h.pendingTransfer(w, r)
+	if transfer == nil {
+		return
+	}
+
+	err := h.transfers.DeleteTransfer(r.Context(), transfer.FormID)
+	if err == store.ErrNotFound {
+		u.Respond(w, u.Message(false, "Not Found"), 404)
+		return
+	}
+	if err != nil {
+		u.Respond(w, u.Message(false, err.Error()), 500)
+		return
+	}
+	h.record(r.Context(), &models.AuditEntry{FormID: transfer.FormID, Actor: rno,
+		Action: models.AuditTransferCancelled, Target: transfer.To})
+
+	log.Println(rno, ": cancelled transfer of form", transfer.FormID, "to", transfer.To)
+	u.Respond(w, u.Message(true, "Transfer cancelled"), 200)
+}
+
+// AcceptTransfer : API handler for a user accepting the form offered to them,
+// becoming its creator with its responses and history
+func (h *Handler) AcceptTransfer(w http.ResponseWriter, r *http.Request) {
+	transfer, rno := h.pendingTransfer(w, r)
+	if transfer == nil {
+		return
+	}
+	if transfer.To != rno {
+		u.Respond(w, u.Message(false, "Only the user the form is offered to can accept it"), 403)
+		return
+	}
+
+	form, err := h.forms.FindForm(r.Context(), transfer.FormID)
+	if err != nil {
+		u.Respond(w, u.Message(false, "Not Found"), 404)
+		return
+	}
+
+	// Offers lapse when whoever made them is no longer an owner
+	if !form.Can(transfer.From, models.RoleOwner) && !h.isAdmin(r.Context(), transfer.From) {
+		if err := h.transfers.DeleteTransfer(r.Context(), form.ID); err != nil && err != store.ErrNotFound {
+			log.Println(err)
+		}
+		u.Respond(w, u.Message(false, "Transfer is no longer valid"), 409)
+		return
+	}
+
+	// Only one acceptance can replace the creator
+	transferred := *form
+	transferred.Creator = rno
+	err = h.replaceForm(r.Context(), rno, form, form.Version, &transferred)
+	if err == store.ErrNotFound {
+		u.Respond(w, u.Message(false, "Not Found"), 404)
+		return
+	}
+	if err == store.ErrConflict {
+		respondConflict(w, r, h.forms, form.ID)
+		return
+	}
+	if err != nil {
+		u.Respond(w, u.Message(false, err.Error()), 500)
+		return
+	}
+	if err := h.transfers.DeleteTransfer(r.Context(), form.ID); err != nil && err != store.ErrNotFound {
+		log.Println(err)
+	}
+
+	// The new creator is no longer a collaborator, the previous one may stay
+	if err := h.shares.DeleteCollaborator(r.Context(), form.ID, rno); err != nil && err != store.ErrNotFound {
+		log.Println(err)
+	}
+	if transfer.KeepRole != "" {
+		err := h.shares.SetCollaborator(r.Context(), form.ID,
+			&models.Collaborator{RollNumber: form.Creator, Role: transfer.KeepRole})
+		if err != nil {
+			log.Println(err)
+		}
+	}
+
+	h.record(r.Context(), &models.AuditEntry{FormID: form.ID, Actor: rno, Action: models.AuditTransferred,
+		Target: form.Creator, Details: map[string]string{"offered_by": transfer.From, "keep_role": transfer.KeepRole}})
+
+	log.Println(rno, ": accepted form", form.ID, "from", form.Creator)
+	setETag(w, transferred.Version)
+	u.Respond(w, map[string]interface{}{"id": form.ID, "creator": rno, "version": transferred.Version}, 200)
+}
+
+// GetTransfers : API handler for getting the forms offered to the logged in user
+func (h *Handler) GetTransfers(w http.ResponseWriter, r *http.Request) {
+	rno := rollNo(r)
+	transfers, err := h.transfers.FindTransfersTo(r.Context(), rno)
+	if err != nil {
+		u.Respond(w, u.Message(false, err.Error()), 500)
+		return
+	}
+	u.Respond(w, transfers, 200)
+}
@@ -0,0 +1,32 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pulsejet/go-cerium/store"
+	u "github.com/pulsejet/go-cerium/utils"
+)
+
+// setETag : tag the response with the version of the form
+func setETag(w http.ResponseWriter, version int) {
+	w.Header().Set("ETag", strconv.Quote(strconv.Itoa(version)))
+}
+
+// ifMatch : get the form version from the If-Match header
+func ifMatch(r *http.Request) (int, bool) {
+	tag := strings.TrimPrefix(strings.TrimSpace(r.Header.Get("If-Match")), "W/")
+	version, err := strconv.Atoi(strings.Trim(tag, `"`))
+	return version, err == nil
+}
+
+// respondConflict : tell the client it edited a stale version of the form
+func respondConflict(w http.ResponseWriter, r *http.Request, forms store.FormStore, id string) {
+	msg := u.Message(false, "Form was changed by someone else, reload to get the latest version")
+	if current, err := forms.FindForm(r.Context(), id); err == nil {
+		msg["version"] = current.Version
+		setETag(w, current.Version)
+	}
+	u.Respond(w, msg, 409)
+}
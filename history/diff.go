@@ -0,0 +1,209 @@
+package history
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/pulsejet/go-cerium/models"
+)
+
+// Kinds of change
+const (
+	Added    = "added"
+	Removed  = "removed"
+	Modified = "modified"
+)
+
+// Diff : structural changes between two versions of a form
+type Diff struct {
+	From     int            `json:"from"`
+	To       int            `json:"to"`
+	Settings []Change       `json:"settings"`
+	Pages    []PageChange   `json:"pages"`
+	Widgets  []WidgetChange `json:"widgets"`
+}
+
+// Change : a field whose value differs between the versions
+type Change struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+// PageChange : a page added, removed or modified, matched by position
+type PageChange struct {
+	Page   int      `json:"page"`
+	Change string   `json:"change"`
+	Fields []Change `json:"fields,omitempty"`
+}
+
+// WidgetChange : a widget added, removed or modified, matched by UID
+type WidgetChange struct {
+	UID    string   `json:"uid"`
+	Type   string   `json:"type"`
+	Change string   `json:"change"`
+	Fields []Change `json:"fields,omitempty"`
+}
+
+// location : where a widget sits in a form
+type location struct {
+	widget *models.Widget
+	page   int
+	order  int
+}
+
+// Content : the form with its latest edits, which published forms keep in their draft
+func Content(form *models.Form) *models.Form {
+	if form.Draft == nil {
+		return form
+	}
+	content := *form.Draft
+	content.ID = form.ID
+	content.Version = form.Version
+	content.Status = form.Status
+	return &content
+}
+
+// Compare : list the changes needed to turn one version of a form into another,
+// comparing the latest edits of each version whether published or not
+func Compare(from *models.Form, to *models.Form) *Diff {
+	d := &Diff{
+		From:     from.Version,
+		To:       to.Version,
+		Settings: []Change{},
+		Pages:    []PageChange{},
+		Widgets:  []WidgetChange{},
+	}
+
+	// Publishing changes what respondents see, even if not the content
+	d.Settings = changes(d.Settings, "status", from.Status, to.Status)
+	d.Settings = changes(d.Settings, "has_draft", from.Draft != nil, to.Draft != nil)
+	from, to = Content(from), Content(to)
+
+	// Form settings
+	d.Settings = changes(d.Settings, "name", from.Name, to.Name)
+	d.Settings = changes(d.Settings, "require_login", from.RequireLogin, to.RequireLogin)
+	d.Settings = changes(d.Settings, "collect_email", from.CollectEmail, to.CollectEmail)
+	d.Settings = changes(d.Settings, "single_response", from.SingleResponse, to.SingleResponse)
+	d.Settings = changes(d.Settings, "is_closed", from.IsClosed, to.IsClosed)
+	d.Settings = changes(d.Settings, "open_on", from.OpenOn, to.OpenOn)
+	d.Settings = changes(d.Settings, "close_on", from.CloseOn, to.CloseOn)
+	d.Settings = changes(d.Settings, "response_limit", from.ResponseLimit, to.ResponseLimit)
+	d.Settings = changes(d.Settings, "waitlist", from.Waitlist, to.Waitlist)
+	d.Settings = changes(d.Settings, "allow_edit", from.AllowEdit, to.AllowEdit)
+	d.Settings = changes(d.Settings, "allow_withdraw", from.AllowWithdraw, to.AllowWithdraw)
+	d.Settings = changes(d.Settings, "keep_withdrawn", from.KeepWithdrawn, to.KeepWithdrawn)
+
+	// Pages have no identity, so they are matched by position
+	for i := 0; i < len(from.Pages) || i < len(to.Pages); i++ {
+		switch {
+		case i >= len(to.Pages):
+			d.Pages = append(d.Pages, PageChange{Page: i, Change: Removed})
+		case i >= len(from.Pages):
+			d.Pages = append(d.Pages, PageChange{Page: i, Change: Added})
+		default:
+			a, b := &from.Pages[i], &to.Pages[i]
+			fields := changes(nil, "title", a.Title, b.Title)
+			fields = changes(fields, "description", a.Description, b.Description)
+			fields = changes(fields, "branches", a.Branches, b.Branches)
+			if len(fields) > 0 {
+				d.Pages = append(d.Pages, PageChange{Page: i, Change: Modified, Fields: fields})
+			}
+		}
+	}
+
+	// Widgets are matched by UID
+	before, after := locate(from, to), locate(to, from)
+	for _, uid := range order(from) {
+		if _, ok := after[uid]; !ok {
+			w := before[uid].widget
+			d.Widgets = append(d.Widgets, WidgetChange{UID: uid, Type: w.Type, Change: Removed})
+		}
+	}
+	for _, uid := range order(to) {
+		b := after[uid]
+		a, ok := before[uid]
+		if !ok {
+			d.Widgets = append(d.Widgets, WidgetChange{UID: uid, Type: b.widget.Type, Change: Added})
+			continue
+		}
+
+		fields := changes(nil, "type", a.widget.Type, b.widget.Type)
+		fields = changes(fields, "page", a.page, b.page)
+		fields = changes(fields, "order", a.order, b.order)
+		fields = changes(fields, "show_if", a.widget.ShowIf, b.widget.ShowIf)
+		for _, key := range propKeys(a.widget, b.widget) {
+			fields = changes(fields, "props."+key, a.widget.Props[key], b.widget.Props[key])
+		}
+		if len(fields) > 0 {
+			d.Widgets = append(d.Widgets, WidgetChange{UID: uid, Type: b.widget.Type, Change: Modified, Fields: fields})
+		}
+	}
+
+	return d
+}
+
+// changes : append a change if the values differ
+func changes(list []Change, field string, from interface{}, to interface{}) []Change {
+	if same(from, to) {
+		return list
+	}
+	return append(list, Change{Field: field, From: from, To: to})
+}
+
+// same : compare values by their JSON encoding, so that
+// values decoded by different stores compare equal
+func same(a interface{}, b interface{}) bool {
+	x, errx := json.Marshal(a)
+	y, erry := json.Marshal(b)
+	return errx == nil && erry == nil && string(x) == string(y)
+}
+
+// order : UIDs of the widgets of a form in document order
+func order(form *models.Form) []string {
+	uids := []string{}
+	for _, page := range form.Pages {
+		for _, w := range page.Widgets {
+			uids = append(uids, w.UID)
+		}
+	}
+	return uids
+}
+
+// locate : index the widgets of a form by UID, ordering them only among
+// widgets present in the other form so that insertions do not move the rest
+func locate(form *models.Form, other *models.Form) map[string]location {
+	common := map[string]bool{}
+	for _, uid := range order(other) {
+		common[uid] = true
+	}
+
+	index := map[string]location{}
+	n := 0
+	for pi := range form.Pages {
+		for wi := range form.Pages[pi].Widgets {
+			w := &form.Pages[pi].Widgets[wi]
+			index[w.UID] = location{widget: w, page: pi, order: n}
+			if common[w.UID] {
+				n++
+			}
+		}
+	}
+	return index
+}
+
+// propKeys : sorted union of the props of two widgets
+func propKeys(a *models.Widget, b *models.Widget) []string {
+	seen := map[string]bool{}
+	keys := []string{}
+	for _, props := range []map[string]interface{}{a.Props, b.Props} {
+		for key := range props {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
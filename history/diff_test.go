@@ -0,0 +1,77 @@
+package history_test
+
+import (
+	"testing"
+
+	"github.com/pulsejet/go-cerium/history"
+	"github.com/pulsejet/go-cerium/models"
+)
+
+func widget(uid string, question string) models.Widget {
+	return models.Widget{Type: "short_answer", UID: uid, Props: map[string]interface{}{"question": question}}
+}
+
+// Tests that settings, pages and widgets are compared
+func TestCompare(t *testing.T) {
+	from := &models.Form{Version: 1, Name: "Form", Pages: []models.Page{
+		{Title: "One", Widgets: []models.Widget{widget("a", "A"), widget("b", "B"), widget("c", "C")}},
+	}}
+	to := &models.Form{Version: 2, Name: "Form", RequireLogin: true, Pages: []models.Page{
+		{Title: "One", Widgets: []models.Widget{widget("new", "New"), widget("a", "A"), widget("c", "C changed")}},
+		{Title: "Two"},
+	}}
+
+	d := history.Compare(from, to)
+	if d.From != 1 || d.To != 2 {
+		t.Errorf("Unexpected versions %d %d", d.From, d.To)
+	}
+	if len(d.Settings) != 1 || d.Settings[0].Field != "require_login" {
+		t.Errorf("Unexpected settings %+v", d.Settings)
+	}
+	if len(d.Pages) != 1 || d.Pages[0].Page != 1 || d.Pages[0].Change != history.Added {
+		t.Errorf("Unexpected pages %+v", d.Pages)
+	}
+
+	// Inserting a widget does not move the others
+	changes := map[string]history.WidgetChange{}
+	for _, c := range d.Widgets {
+		changes[c.UID] = c
+	}
+	if len(changes) != 3 || changes["b"].Change != history.Removed || changes["new"].Change != history.Added {
+		t.Errorf("Unexpected widgets %+v", d.Widgets)
+	}
+	c := changes["c"]
+	if c.Change != history.Modified || len(c.Fields) != 1 || c.Fields[0].Field != "props.question" || c.Fields[0].To != "C changed" {
+		t.Errorf("Unexpected change %+v", c)
+	}
+}
+
+// Tests that identical forms have no changes
+func TestCompareSame(t *testing.T) {
+	form := &models.Form{Pages: []models.Page{{Title: "One", Widgets: []models.Widget{widget("a", "A")}}}}
+	d := history.Compare(form, form)
+	if len(d.Settings) != 0 || len(d.Pages) != 0 || len(d.Widgets) != 0 {
+		t.Errorf("Unexpected changes %+v", d)
+	}
+}
+
+// Tests that published forms are compared by their draft, and publishing is a change
+func TestCompareDraft(t *testing.T) {
+	published := &models.Form{Version: 2, Status: models.StatusPublished, Pages: []models.Page{{Title: "One"}}}
+	edited := &models.Form{Version: 3, Status: models.StatusPublished, Pages: []models.Page{{Title: "One"}},
+		Draft: &models.Form{Pages: []models.Page{{Title: "Edited"}}}}
+
+	d := history.Compare(published, edited)
+	if len(d.Settings) != 1 || d.Settings[0].Field != "has_draft" {
+		t.Errorf("Unexpected settings %+v", d.Settings)
+	}
+	if len(d.Pages) != 1 || d.Pages[0].Fields[0].To != "Edited" {
+		t.Errorf("Unexpected pages %+v", d.Pages)
+	}
+
+	draft := &models.Form{Version: 1, Status: models.StatusDraft, Pages: []models.Page{{Title: "One"}}}
+	d = history.Compare(draft, published)
+	if len(d.Settings) != 1 || d.Settings[0].Field != "status" || len(d.Pages) != 0 {
+		t.Errorf("Unexpected changes %+v", d)
+	}
+}
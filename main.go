@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"math/rand"
@@ -11,6 +12,7 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/pulsejet/go-cerium/controllers"
+	"github.com/pulsejet/go-cerium/store"
 
 	"github.com/joho/godotenv"
 )
@@ -65,8 +67,17 @@ func main() {
 		log.Fatal("Error loading .env file")
 	}
 
-        // Create new router
+        // Connect to database
+	db, err := store.Open(context.Background(), os.Getenv("CONNECTION"), os.Getenv("DATABASE"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	h := controllers.New(db)
+
+        // Create new router, reading the session of each API call once
 	router := mux.NewRouter()
+	api := router.PathPrefix("/api").Subrouter()
+	api.Use(h.Authenticate)
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -77,17 +88,51 @@ func main() {
 	rand.Seed(time.Now().UnixNano())
 
         // Handle API calls
-	router.HandleFunc("/api/form", controllers.CreateForm).Methods("POST")
-	router.HandleFunc("/api/forms", controllers.GetAllForms).Methods("GET")
-	router.HandleFunc("/api/form/{id}", controllers.CreateForm).Methods("PUT")
-	router.HandleFunc("/api/form/{id}", controllers.GetForm).Methods("GET")
-	router.HandleFunc("/api/form/{id}", controllers.DeleteForm).Methods("DELETE")
-	router.HandleFunc("/api/response/{formid}", controllers.CreateResponse).Methods("POST")
-	router.HandleFunc("/api/responses/{formid}", controllers.GetResponses).Methods("POST")
+	api.HandleFunc("/form", h.RequireAuth(h.CreateForm)).Methods("POST")
+	api.HandleFunc("/forms", h.RequireAuth(h.GetAllForms)).Methods("GET")
+	api.HandleFunc("/transfers", h.RequireAuth(h.GetTransfers)).Methods("GET")
+	api.HandleFunc("/form/{id}", h.RequireAuth(h.CreateForm)).Methods("PUT")
+	api.HandleFunc("/form/{id}", h.OptionalAuth(h.GetForm)).Methods("GET")
+	api.HandleFunc("/form/{id}", h.RequireAuth(h.DeleteForm)).Methods("DELETE")
+	api.HandleFunc("/form/{id}/visibility", h.OptionalAuth(h.GetVisibility)).Methods("POST")
+	api.HandleFunc("/form/{id}/publish", h.RequireAuth(h.PublishForm)).Methods("POST")
+	api.HandleFunc("/form/{id}/revisions", h.RequireAuth(h.GetRevisions)).Methods("GET")
+	api.HandleFunc("/form/{id}/revisions/{version}", h.RequireAuth(h.GetRevision)).Methods("GET")
+	api.HandleFunc("/form/{id}/revisions/{version}/restore", h.RequireAuth(h.RestoreRevision)).Methods("POST")
+	api.HandleFunc("/form/{id}/diff", h.RequireAuth(h.GetDiff)).Methods("GET")
+	api.HandleFunc("/form/{id}/responses/{rid}", h.RequireAuth(h.DeleteResponse)).Methods("DELETE")
+	api.HandleFunc("/form/{id}/responses/{rid}/slot", h.RequireAuth(h.MoveBooking)).Methods("POST")
+	api.HandleFunc("/form/{id}/schedule", h.RequireAuth(h.GetSchedule)).Methods("GET")
+	api.HandleFunc("/form/{id}/audit", h.RequireAuth(h.GetAudit)).Methods("GET")
+	api.HandleFunc("/form/{id}/collaborators", h.RequireAuth(h.InviteCollaborator)).Methods("POST")
+	api.HandleFunc("/form/{id}/collaborators/{rno}", h.RequireAuth(h.ChangeCollaborator)).Methods("PUT")
+	api.HandleFunc("/form/{id}/collaborators/{rno}", h.RequireAuth(h.RemoveCollaborator)).Methods("DELETE")
+	api.HandleFunc("/form/{id}/transfer", h.RequireAuth(h.OfferTransfer)).Methods("POST")
+	api.HandleFunc("/form/{id}/transfer", h.RequireAuth(h.GetTransfer)).Methods("GET")
+	api.HandleFunc("/form/{id}/transfer", h.RequireAuth(h.CancelTransfer)).Methods("DELETE")
+	api.HandleFunc("/form/{id}/transfer/accept", h.RequireAuth(h.AcceptTransfer)).Methods("POST")
+	api.HandleFunc("/form/{id}/links", h.RequireAuth(h.CreateShareLink)).Methods("POST")
+	api.HandleFunc("/form/{id}/links", h.RequireAuth(h.GetShareLinks)).Methods("GET")
+	api.HandleFunc("/form/{id}/links/{lid}", h.RequireAuth(h.RevokeShareLink)).Methods("DELETE")
+	api.HandleFunc("/admin/forms", h.RequireAuth(h.SearchForms)).Methods("GET")
+	api.HandleFunc("/admin/forms/{id}", h.RequireAuth(h.AdminGetForm)).Methods("GET")
+	api.HandleFunc("/admin/forms/{id}", h.RequireAuth(h.AdminDeleteForm)).Methods("DELETE")
+	api.HandleFunc("/admin/forms/{id}/close", h.RequireAuth(h.AdminCloseForm)).Methods("POST")
+	api.HandleFunc("/admin/forms/{id}/reopen", h.RequireAuth(h.AdminReopenForm)).Methods("POST")
+	api.HandleFunc("/admin/forms/{id}/recount", h.RequireAuth(h.AdminRecountForm)).Methods("POST")
+	api.HandleFunc("/admin/users/{rno}/stats", h.RequireAuth(h.AdminUserStats)).Methods("GET")
+	api.HandleFunc("/admin/users/{rno}/admin", h.RequireAuth(h.SetAdmin)).Methods("PUT")
+	api.HandleFunc("/admin/audit", h.RequireAuth(h.GetSiteAudit)).Methods("GET")
+	api.HandleFunc("/response/{formid}", h.OptionalAuth(h.CreateResponse)).Methods("POST")
+	api.HandleFunc("/response/{formid}/{rid}", h.OptionalAuth(h.GetOwnResponse)).Methods("GET")
+	api.HandleFunc("/response/{formid}/{rid}", h.OptionalAuth(h.EditOwnResponse)).Methods("PUT")
+	api.HandleFunc("/response/{formid}/{rid}", h.OptionalAuth(h.WithdrawResponse)).Methods("DELETE")
+	api.HandleFunc("/responses/{formid}", h.OptionalAuth(h.ResultsAccess(h.GetResponses))).Methods("POST", "GET")
+	api.HandleFunc("/responses/{formid}/summary", h.OptionalAuth(h.ResultsAccess(h.GetResponseSummary))).Methods("GET")
 
         // Handle auth API calls
-	router.HandleFunc("/api/login", controllers.Login).Methods("POST", "GET")
-	router.HandleFunc("/api/logout", controllers.Logout).Methods("GET")
+	api.HandleFunc("/login", h.OptionalAuth(h.Login)).Methods("POST", "GET")
+	api.HandleFunc("/logout", controllers.Logout).Methods("GET")
 
         // Handlse SPA
 	spa := spaHandler{staticPath: "dist/cerium", indexPath: "index.html"}
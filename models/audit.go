@@ -0,0 +1,69 @@
+package models
+
+import (
+	"time"
+)
+
+// AuditEntry : a record of an action taken on a form, shown to its owners.
+// Actions on the site rather than a form have no form id, and those of site
+// administrators on a form are also kept on the site with the form as the target
+type AuditEntry struct {
+	FormID  string            `json:"form_id"`
+	Time    time.Time         `json:"time"`
+	Actor   string            `json:"actor"`
+	Action  string            `json:"action"`
+	Target  string            `json:"target,omitempty"`
+	Details map[string]string `json:"details,omitempty"`
+}
+
+// Audited actions
+const (
+	// AuditWithdrawn : a respondent withdrew their response, the target
+	AuditWithdrawn = "response_withdrawn"
+
+	// AuditCollaboratorSet : a collaborator, the target, was added or given a role
+	AuditCollaboratorSet = "collaborator_set"
+
+	// AuditCollaboratorRemoved : a collaborator, the target, was removed
+	AuditCollaboratorRemoved = "collaborator_removed"
+
+	// AuditTransferOffered : the form was offered to another user, the target
+	AuditTransferOffered = "transfer_offered"
+
+	// AuditTransferCancelled : the offer to the target was withdrawn or declined
+	AuditTransferCancelled = "transfer_cancelled"
+
+	// AuditTransferred : the offer was accepted, the target being the previous creator
+	AuditTransferred = "ownership_transferred"
+
+	// AuditShareLinkCreated : a link to the results, the target, was created
+	AuditShareLinkCreated = "share_link_created"
+
+	// AuditShareLinkRevoked : a link to the results, the target, was revoked
+	AuditShareLinkRevoked = "share_link_revoked"
+
+	// AuditAdminSearched : a site administrator searched the forms
+	AuditAdminSearched = "admin_searched"
+
+	// AuditAdminViewed : a site administrator read the form
+	AuditAdminViewed = "admin_viewed"
+
+	// AuditAdminClosed : a site administrator closed the form until they reopen it
+	AuditAdminClosed = "admin_closed"
+
+	// AuditAdminReopened : a site administrator reopened the form
+	AuditAdminReopened = "admin_reopened"
+
+	// AuditAdminDeleted : a site administrator deleted the form
+	AuditAdminDeleted = "admin_deleted"
+
+	// AuditAdminRecounted : a site administrator set the counters of the form
+	// from its responses, the details holding those that changed
+	AuditAdminRecounted = "admin_recounted"
+
+	// AuditAdminStats : a site administrator viewed the usage of a user, the target
+	AuditAdminStats = "admin_stats"
+
+	// AuditAdminSet : a site administrator made the target one, or not
+	AuditAdminSet = "admin_set"
+)
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"time"
+)
+
+// Reasons a form does not accept responses
+const (
+	NotYetOpen       = "not_yet_open"
+	ClosedManually   = "closed_manually"
+	ClosedByAdmin    = "closed_by_admin"
+	ClosedBySchedule = "closed_by_schedule"
+	QuotaReached     = "quota_reached"
+)
+
+// ResponsesCounter : key of the counter of all responses to a form
+const ResponsesCounter = "*"
+
+// ChoiceCounter : key of the counter of responses picking an option of a widget
+func ChoiceCounter(uid string, option string) string {
+	return uid + ":" + option
+}
+
+// Availability : whether a form accepts responses, and why not
+type Availability struct {
+	Open   bool     `json:"open"`
+	Reason string   `json:"reason,omitempty"`
+	OpenOn NullTime `json:"open_on"`
+
+	// Responses left before the response limit, if any
+	Remaining *int `json:"remaining,omitempty"`
+
+	// New responses join the waitlist
+	Waitlisted bool `json:"waitlisted,omitempty"`
+
+	// Places left in options with a capacity, by widget UID and option
+	RemainingChoices map[string]map[string]int `json:"remaining_choices,omitempty"`
+}
+
+// Available : check the schedule, state and response limit of the form
+// at the given time, given its counters
+func (f *Form) Available(now time.Time, counts map[string]int) *Availability {
+	a := &Availability{OpenOn: f.OpenOn}
+	if f.ResponseLimit > 0 {
+		remaining := f.ResponseLimit - counts[ResponsesCounter]
+		if remaining < 0 {
+			remaining = 0
+		}
+		a.Remaining = &remaining
+		a.Waitlisted = remaining == 0 && f.Waitlist
+	}
+
+	switch {
+	case f.Suspended:
+		a.Reason = ClosedByAdmin
+	case f.IsClosed:
+		a.Reason = ClosedManually
+	case f.CloseOn.Valid && !now.Before(f.CloseOn.Time):
+		a.Reason = ClosedBySchedule
+	case f.OpenOn.Valid && now.Before(f.OpenOn.Time):
+		a.Reason = NotYetOpen
+	case a.Remaining != nil && *a.Remaining == 0 && !f.Waitlist:
+		a.Reason = QuotaReached
+	default:
+		a.Open = true
+	}
+	return a
+}
@@ -0,0 +1,59 @@
+package models
+
+// Collaborator : a user sharing a form with its creator
+type Collaborator struct {
+	RollNumber string `json:"rno"`
+	Role       string `json:"role"`
+}
+
+// Roles on a form, each allowing all that the ones after it allow
+const (
+	// RoleOwner : manages collaborators and deletes the form
+	RoleOwner = "owner"
+
+	// RoleEditor : edits and publishes the form and manages its responses
+	RoleEditor = "editor"
+
+	// RoleViewer : sees the responses
+	RoleViewer = "viewer"
+)
+
+// roleRank : how much a role allows, zero for no role
+func roleRank(role string) int {
+	switch role {
+	case RoleOwner:
+		return 3
+	case RoleEditor:
+		return 2
+	case RoleViewer:
+		return 1
+	}
+	return 0
+}
+
+// ValidRole : whether the role can be given to a collaborator
+func ValidRole(role string) bool {
+	return roleRank(role) > 0
+}
+
+// RoleOf : the role of a user on the form, the creator being an owner
+func (f *Form) RoleOf(rno string) string {
+	if rno == "" {
+		return ""
+	}
+	if rno == f.Creator {
+		return RoleOwner
+	}
+	for _, c := range f.Collaborators {
+		if c.RollNumber == rno {
+			return c.Role
+		}
+	}
+	return ""
+}
+
+// Can : whether the user has the role on the form, or one that allows more
+func (f *Form) Can(rno string, role string) bool {
+	has := f.RoleOf(rno)
+	return has != "" && roleRank(has) >= roleRank(role)
+}
@@ -6,6 +6,7 @@ import (
 
 // Form : a single form stored in database
 type Form struct {
+	ID             string    `json:"id,omitempty" bson:"-"`
 	Name           string    `json:"name"`
 	Creator        string    `json:"creator"`
 	Timestamp      time.Time `json:"timestamp"`
@@ -15,8 +16,35 @@ type Form struct {
 	CollectEmail   bool      `json:"collect_email"`
 	SingleResponse bool      `json:"single_response"`
 	IsClosed       bool      `json:"is_closed"`
-	CloseOn        time.Time `json:"close_on"`
-	ResponseToken  string    `json:"-"`
+	OpenOn         NullTime  `json:"open_on"`
+	CloseOn        NullTime  `json:"close_on"`
+	ResponseLimit  int       `json:"response_limit"`
+	Waitlist       bool      `json:"waitlist"`
+	AllowEdit      bool      `json:"allow_edit"`
+	AllowWithdraw  bool      `json:"allow_withdraw"`
+	KeepWithdrawn  bool      `json:"keep_withdrawn"`
+	Suspended      bool      `json:"suspended"`
+	Version        int       `json:"version"`
+	Status         string    `json:"status"`
+	Draft          *Form     `json:"draft,omitempty" bson:"draft,omitempty"`
+	HasDraft       bool      `json:"has_draft" bson:"-"`
+
+	// Collaborators are kept apart from the form, sorted by roll number
+	Collaborators []Collaborator `json:"collaborators" bson:"-"`
+
+	// Availability is filled in when the form is sent to a client
+	Availability *Availability `json:"availability,omitempty" bson:"-"`
+}
+
+// Form statuses, forms saved before drafts existed have no status and are published
+const (
+	StatusDraft     = "draft"
+	StatusPublished = "published"
+)
+
+// IsPublished : whether the form is open to respondents
+func (f *Form) IsPublished() bool {
+	return f.Status != StatusDraft
 }
 
 // Page : a section in  a form
@@ -24,23 +52,60 @@ type Page struct {
 	Title       string   `json:"title"`
 	Description string   `json:"description"`
 	Widgets     []Widget `json:"widgets"`
+	Branches    []Branch `json:"branches,omitempty"`
+}
+
+// Branch : jump to another page after this one when a condition holds
+type Branch struct {
+	When string `json:"when"`
+	Goto int    `json:"goto"`
 }
 
-// Widget : a single control in a page
+// Widget : a single control in a page, with props decoded by the widgets package
 type Widget struct {
-	Type  string                 `json:"type"`
-	UID   string                 `json:"uid"`
-	Props map[string]interface{} `json:"props"`
+	Type   string                 `json:"type"`
+	UID    string                 `json:"uid"`
+	Props  map[string]interface{} `json:"props"`
+	ShowIf string                 `json:"show_if,omitempty"`
 }
 
 // FormResponse : a single response to a form
 type FormResponse struct {
+	ID        string                 `json:"id,omitempty" bson:"-"`
 	FormID    string                 `json:"form_id"`
 	Timestamp time.Time              `json:"timestamp"`
 	Filler    string                 `json:"filler"`
 	Responses map[string]interface{} `json:"responses"`
+	Version   int                    `json:"version"`
+	Status    string                 `json:"status"`
+
+	// Keys of the counters the response was counted in
+	Counters []string `json:"-" bson:"counters,omitempty"`
+
+	// Keyed hash of the roll number of a logged in filler, to find their response
+	Owner string `json:"-" bson:"owner,omitempty"`
+
+	// Earlier answers, oldest first
+	Edits []ResponseEdit `json:"edits,omitempty" bson:"edits,omitempty"`
+}
+
+// ResponseEdit : the answers of a response before an edit
+type ResponseEdit struct {
+	Edited    time.Time              `json:"edited"`
+	EditedBy  string                 `json:"edited_by"`
+	Version   int                    `json:"version"`
+	Responses map[string]interface{} `json:"responses"`
 }
 
+// Response statuses, responses saved before waitlists existed have no status and are accepted
+const (
+	ResponseAccepted   = "accepted"
+	ResponseWaitlisted = "waitlisted"
+
+	// ResponseWithdrawn : kept without answers after its respondent withdrew it
+	ResponseWithdrawn = "withdrawn"
+)
+
 // FormAnonResponder : mapping between form and filler for singe-response
 type FormAnonResponder struct {
 	FormID string
@@ -0,0 +1,14 @@
+package models
+
+import (
+	"time"
+)
+
+// Revision : snapshot of a form as it was before being replaced
+type Revision struct {
+	FormID     string    `json:"form_id"`
+	Version    int       `json:"version"`
+	Replaced   time.Time `json:"replaced"`
+	ReplacedBy string    `json:"replaced_by"`
+	Form       Form      `json:"form"`
+}
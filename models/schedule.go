@@ -0,0 +1,108 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+)
+
+// legacyUnset : older clients sent dates up to this instant to mean no date
+var legacyUnset = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// NullTime : a scheduled instant that may be unset, encoded as null in
+// JSON, BSON and SQL when unset
+type NullTime struct {
+	Time  time.Time
+	Valid bool
+}
+
+// At : a set NullTime
+func At(t time.Time) NullTime {
+	return NullTime{Time: t, Valid: true}
+}
+
+// fromLegacy : treat the placeholder dates of older clients as unset
+func fromLegacy(t time.Time) NullTime {
+	if !t.After(legacyUnset) {
+		return NullTime{}
+	}
+	return At(t)
+}
+
+// Equal : both unset or both set to the same instant
+func (n NullTime) Equal(o NullTime) bool {
+	return n.Valid == o.Valid && (!n.Valid || n.Time.Equal(o.Time))
+}
+
+// MarshalJSON : RFC 3339 time or null
+func (n NullTime) MarshalJSON() ([]byte, error) {
+	if !n.Valid {
+		return []byte("null"), nil
+	}
+	return json.Marshal(n.Time)
+}
+
+// UnmarshalJSON : RFC 3339 time, or null or an empty string for unset
+func (n *NullTime) UnmarshalJSON(b []byte) error {
+	if s := string(b); s == "null" || s == `""` {
+		*n = NullTime{}
+		return nil
+	}
+	var t time.Time
+	if err := json.Unmarshal(b, &t); err != nil {
+		return err
+	}
+	*n = fromLegacy(t)
+	return nil
+}
+
+// MarshalBSONValue : date time or null
+func (n NullTime) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	if !n.Valid {
+		return bsontype.Null, nil, nil
+	}
+	ms := n.Time.Unix()*1000 + int64(n.Time.Nanosecond()/1e6)
+	return bsontype.DateTime, bsoncore.AppendDateTime(nil, ms), nil
+}
+
+// UnmarshalBSONValue : date time, or null for unset
+func (n *NullTime) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	switch t {
+	case bsontype.Null, bsontype.Undefined:
+		*n = NullTime{}
+		return nil
+	case bsontype.DateTime:
+		ms, _, ok := bsoncore.ReadDateTime(data)
+		if !ok {
+			return fmt.Errorf("invalid date time")
+		}
+		*n = fromLegacy(time.Unix(ms/1000, ms%1000*1e6).UTC())
+		return nil
+	}
+	return fmt.Errorf("cannot decode %v into a time", t)
+}
+
+// Scan : read a nullable timestamp column
+func (n *NullTime) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*n = NullTime{}
+	case time.Time:
+		*n = fromLegacy(v)
+	default:
+		return fmt.Errorf("cannot scan %T into a time", value)
+	}
+	return nil
+}
+
+// Value : write a nullable timestamp column
+func (n NullTime) Value() (driver.Value, error) {
+	if !n.Valid {
+		return nil, nil
+	}
+	return n.Time.UTC(), nil
+}
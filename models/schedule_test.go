@@ -0,0 +1,45 @@
+package models_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/pulsejet/go-cerium/models"
+)
+
+// Tests that unset times and the placeholders of older clients decode as unset
+func TestNullTimeJSON(t *testing.T) {
+	for _, src := range []string{`null`, `""`, `"0001-01-01T00:00:00Z"`, `"1970-01-01T00:00:00Z"`} {
+		var n models.NullTime
+		if err := json.Unmarshal([]byte(src), &n); err != nil || n.Valid {
+			t.Errorf("Expected %s to be unset, got %+v %v", src, n, err)
+		}
+	}
+
+	var n models.NullTime
+	if err := json.Unmarshal([]byte(`"2030-01-02T03:04:05Z"`), &n); err != nil || !n.Valid ||
+		!n.Time.Equal(time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Errorf("Time not decoded: %+v %v", n, err)
+	}
+	if b, _ := json.Marshal(models.NullTime{}); string(b) != "null" {
+		t.Errorf("Unset time encoded as %s", b)
+	}
+}
+
+// Tests that times survive a round trip through BSON
+func TestNullTimeBSON(t *testing.T) {
+	type doc struct{ At models.NullTime }
+	for _, n := range []models.NullTime{{}, models.At(time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC))} {
+		b, err := bson.Marshal(doc{n})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var d doc
+		if err := bson.Unmarshal(b, &d); err != nil || !d.At.Equal(n) {
+			t.Errorf("Expected %+v, got %+v %v", n, d.At, err)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"time"
+)
+
+// ShareLink : a named token that lets anyone holding it see the results of a form
+type ShareLink struct {
+	ID        string    `json:"id"`
+	FormID    string    `json:"form_id"`
+	Name      string    `json:"name"`
+	Scopes    []string  `json:"scopes"`
+	Created   time.Time `json:"created"`
+	CreatedBy string    `json:"created_by"`
+	Expires   NullTime  `json:"expires"`
+	LastUsed  NullTime  `json:"last_used"`
+	Revoked   NullTime  `json:"revoked"`
+
+	// Only a hash of the token is kept, the token is shown once when created
+	TokenHash string `json:"-"`
+}
+
+// Parts of the results a share link may give access to
+const (
+	// ScopeSummary : counts of responses and of the options picked
+	ScopeSummary = "summary"
+
+	// ScopeRaw : the responses as stored
+	ScopeRaw = "raw"
+
+	// ScopeExport : the responses as a table for spreadsheets
+	ScopeExport = "export"
+)
+
+// ValidScope : true if the scope is one a share link may have
+func ValidScope(scope string) bool {
+	return scope == ScopeSummary || scope == ScopeRaw || scope == ScopeExport
+}
+
+// Allows : true if the link has the scope
+func (l *ShareLink) Allows(scope string) bool {
+	for _, s := range l.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Active : true if the link is neither revoked nor expired at the given time
+func (l *ShareLink) Active(now time.Time) bool {
+	return !l.Revoked.Valid && (!l.Expires.Valid || now.Before(l.Expires.Time))
+}
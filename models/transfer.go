@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+)
+
+// Transfer : an offer to hand a form over to another user, pending until they accept it
+type Transfer struct {
+	FormID  string    `json:"form_id"`
+	Name    string    `json:"name"`
+	From    string    `json:"from"`
+	To      string    `json:"to"`
+	Offered time.Time `json:"offered"`
+
+	// Role the creator keeps as a collaborator, none if they leave the form
+	KeepRole string `json:"keep_role,omitempty"`
+}
@@ -0,0 +1,14 @@
+package models
+
+// Profile : a user profile as received from SSO
+type Profile struct {
+	ID             int    `json:"id"`
+	FirstName      string `json:"first_name"`
+	LastName       string `json:"last_name"`
+	RollNumber     string `json:"roll_number"`
+	ProfilePicture string `json:"profile_picture"`
+	Email          string `json:"email"`
+
+	// Site administrators, kept when the profile is saved again from SSO
+	Admin bool `json:"admin"`
+}
@@ -0,0 +1,366 @@
+package rules
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/pulsejet/go-cerium/widgets"
+)
+
+// Expr : a compiled condition over answers, referring to widgets by UID
+//
+// Conditions compare answers with literals using == != < <= > >= and
+// contains, and combine them with && || ! and parentheses, for example
+//   q3 == 'Yes' && (q2 > 5 || clubs contains 'Music')
+// Unanswered questions are null, which equals any empty value.
+type Expr struct {
+	src  string
+	root node
+	refs []string
+}
+
+// node : an element of the parsed expression
+type node interface {
+	eval(answers map[string]interface{}) interface{}
+}
+
+type literal struct{ value interface{} }
+type ref struct{ uid string }
+type not struct{ x node }
+type binary struct {
+	op   string
+	x, y node
+}
+
+// Parse : compile a condition
+func Parse(src string) (*Expr, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	root, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+	return &Expr{src: src, root: root, refs: p.refs}, nil
+}
+
+// String : the source of the condition
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Refs : UIDs of the widgets the condition refers to
+func (e *Expr) Refs() []string {
+	return e.refs
+}
+
+// Eval : evaluate the condition against answers keyed by widget UID
+func (e *Expr) Eval(answers map[string]interface{}) bool {
+	return truthy(e.root.eval(answers))
+}
+
+func (n literal) eval(answers map[string]interface{}) interface{} {
+	return n.value
+}
+
+func (n ref) eval(answers map[string]interface{}) interface{} {
+	return answers[n.uid]
+}
+
+func (n not) eval(answers map[string]interface{}) interface{} {
+	return !truthy(n.x.eval(answers))
+}
+
+func (n binary) eval(answers map[string]interface{}) interface{} {
+	// Short circuit logical operators
+	switch n.op {
+	case "&&":
+		return truthy(n.x.eval(answers)) && truthy(n.y.eval(answers))
+	case "||":
+		return truthy(n.x.eval(answers)) || truthy(n.y.eval(answers))
+	}
+
+	x, y := n.x.eval(answers), n.y.eval(answers)
+	switch n.op {
+	case "==":
+		return equal(x, y)
+	case "!=":
+		return !equal(x, y)
+	case "contains":
+		return contains(x, y)
+	}
+
+	c, ok := compare(x, y)
+	if !ok {
+		return false
+	}
+	switch n.op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
+
+// truthy : false for null, false, zero and empty values
+func truthy(v interface{}) bool {
+	if b, ok := v.(bool); ok {
+		return b
+	}
+	if n, ok := v.(float64); ok {
+		return n != 0
+	}
+	return !widgets.IsEmpty(v)
+}
+
+// equal : compare numerically when both sides are numbers, and deeply
+// when they are objects, which cannot be compared with ==
+func equal(x, y interface{}) bool {
+	if widgets.IsEmpty(x) || widgets.IsEmpty(y) {
+		return widgets.IsEmpty(x) && widgets.IsEmpty(y)
+	}
+	if c, ok := compare(x, y); ok {
+		return c == 0
+	}
+	if a, ok := widgets.ToSlice(x); ok {
+		b, ok := widgets.ToSlice(y)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !equal(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(x, y)
+}
+
+// compare : order two numbers or two strings
+func compare(x, y interface{}) (int, bool) {
+	if _, isBool := x.(bool); isBool {
+		return 0, false
+	}
+	if _, isBool := y.(bool); isBool {
+		return 0, false
+	}
+
+	if a, ok := widgets.ToNumber(x); ok {
+		if b, ok := widgets.ToNumber(y); ok {
+			switch {
+			case a < b:
+				return -1, true
+			case a > b:
+				return 1, true
+			}
+			return 0, true
+		}
+	}
+
+	a, aok := x.(string)
+	b, bok := y.(string)
+	if aok && bok {
+		return strings.Compare(a, b), true
+	}
+	return 0, false
+}
+
+// contains : list membership or substring match
+func contains(x, y interface{}) bool {
+	if a, ok := widgets.ToSlice(x); ok {
+		for _, item := range a {
+			if equal(item, y) {
+				return true
+			}
+		}
+		return false
+	}
+
+	a, aok := x.(string)
+	b, bok := y.(string)
+	return aok && bok && strings.Contains(a, b)
+}
+
+// token : a lexical element of an expression
+type token struct {
+	text  string
+	value interface{}
+	kind  int
+}
+
+const (
+	tokOp = iota
+	tokLiteral
+	tokIdent
+)
+
+var operators = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "(", ")"}
+
+func lex(src string) ([]token, error) {
+	tokens := []token{}
+	for i := 0; i < len(src); {
+		c := src[i]
+
+		// Whitespace
+		if c == ' ' || c == '\t' || c == '\n' || c == '\r' {
+			i++
+			continue
+		}
+
+		// Quoted strings
+		if c == '\'' || c == '"' {
+			j := strings.IndexByte(src[i+1:], c)
+			if j < 0 {
+				return nil, fmt.Errorf("unterminated string at %d", i)
+			}
+			s := src[i+1 : i+1+j]
+			tokens = append(tokens, token{text: src[i : i+2+j], value: s, kind: tokLiteral})
+			i += j + 2
+			continue
+		}
+
+		// Operators and parentheses
+		matched := false
+		for _, op := range operators {
+			if strings.HasPrefix(src[i:], op) {
+				tokens = append(tokens, token{text: op, kind: tokOp})
+				i += len(op)
+				matched = true
+				break
+			}
+		}
+		if matched {
+			continue
+		}
+
+		// Words are numbers, keywords or widget UIDs
+		j := i
+		for j < len(src) && isWordChar(src[j]) {
+			j++
+		}
+		if j == i {
+			return nil, fmt.Errorf("unexpected %q at %d", c, i)
+		}
+		word := src[i:j]
+		i = j
+
+		switch word {
+		case "true", "false":
+			tokens = append(tokens, token{text: word, value: word == "true", kind: tokLiteral})
+		case "null":
+			tokens = append(tokens, token{text: word, value: nil, kind: tokLiteral})
+		case "contains":
+			tokens = append(tokens, token{text: word, kind: tokOp})
+		default:
+			if n, err := strconv.ParseFloat(word, 64); err == nil {
+				tokens = append(tokens, token{text: word, value: n, kind: tokLiteral})
+			} else {
+				tokens = append(tokens, token{text: word, kind: tokIdent})
+			}
+		}
+	}
+	return tokens, nil
+}
+
+func isWordChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '_' || c == '-' || c == '.'
+}
+
+// parser : recursive descent over the tokens
+type parser struct {
+	tokens []token
+	pos    int
+	refs   []string
+}
+
+func (p *parser) peek(op string) bool {
+	return p.pos < len(p.tokens) && p.tokens[p.pos].kind == tokOp && p.tokens[p.pos].text == op
+}
+
+func (p *parser) or() (node, error) {
+	x, err := p.and()
+	for err == nil && p.peek("||") {
+		p.pos++
+		var y node
+		y, err = p.and()
+		x = binary{op: "||", x: x, y: y}
+	}
+	return x, err
+}
+
+func (p *parser) and() (node, error) {
+	x, err := p.not()
+	for err == nil && p.peek("&&") {
+		p.pos++
+		var y node
+		y, err = p.not()
+		x = binary{op: "&&", x: x, y: y}
+	}
+	return x, err
+}
+
+func (p *parser) not() (node, error) {
+	if p.peek("!") {
+		p.pos++
+		x, err := p.not()
+		return not{x: x}, err
+	}
+	return p.comparison()
+}
+
+func (p *parser) comparison() (node, error) {
+	x, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">", "contains"} {
+		if p.peek(op) {
+			p.pos++
+			y, err := p.primary()
+			return binary{op: op, x: x, y: y}, err
+		}
+	}
+	return x, nil
+}
+
+func (p *parser) primary() (node, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+
+	t := p.tokens[p.pos]
+	p.pos++
+	switch {
+	case t.kind == tokLiteral:
+		return literal{value: t.value}, nil
+	case t.kind == tokIdent:
+		p.refs = append(p.refs, t.text)
+		return ref{uid: t.text}, nil
+	case t.text == "(":
+		x, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if !p.peek(")") {
+			return nil, fmt.Errorf("missing )")
+		}
+		p.pos++
+		return x, nil
+	}
+	return nil, fmt.Errorf("unexpected %q", t.text)
+}
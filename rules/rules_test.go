@@ -0,0 +1,95 @@
+package rules_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pulsejet/go-cerium/models"
+	"github.com/pulsejet/go-cerium/rules"
+)
+
+// Tests evaluation of conditions
+func TestExpr(t *testing.T) {
+	answers := map[string]interface{}{
+		"q2":    6.0,
+		"q3":    "Yes",
+		"age":   "17",
+		"clubs": []interface{}{"Music", "Drama"},
+		"1ab":   "x",
+		"obj1":  map[string]interface{}{"a": "x"},
+		"obj2":  map[string]interface{}{"a": "x"},
+		"obj3":  map[string]interface{}{"a": "y"},
+	}
+
+	cases := map[string]bool{
+		"q3 == 'Yes'":                       true,
+		`q3 != "Yes"`:                       false,
+		"q2 > 5":                            true,
+		"q2 >= 6 && q2 <= 6":                true,
+		"age < 18":                          true,
+		"clubs contains 'Music'":            true,
+		"clubs contains 'Dance'":            false,
+		"!(q3 == 'No') || q2 < 0":           true,
+		"missing == null":                   true,
+		"missing":                           false,
+		"q3":                                true,
+		"missing > 3":                       false,
+		"1ab == 'x'":                        true,
+		"q3 == 'No' || q2 > 5 && age == 17": true,
+		"obj1 == obj2":                      true,
+		"obj1 == obj3":                      false,
+		"obj1 != q3":                        true,
+	}
+	for src, want := range cases {
+		e, err := rules.Parse(src)
+		if err != nil {
+			t.Errorf("%s: %v", src, err)
+			continue
+		}
+		if got := e.Eval(answers); got != want {
+			t.Errorf("%s: got %v want %v", src, got, want)
+		}
+	}
+
+	for _, src := range []string{"", "q3 ==", "(q3 == 'a'", "q3 == 'a", "q3 = 'a'", "q3 == 'a' q2"} {
+		if _, err := rules.Parse(src); err == nil {
+			t.Errorf("%q should not parse", src)
+		}
+	}
+
+	e, _ := rules.Parse("q3 == 'Yes' && (q2 > 5 || clubs contains 'Music')")
+	if !reflect.DeepEqual(e.Refs(), []string{"q3", "q2", "clubs"}) {
+		t.Errorf("Unexpected refs %v", e.Refs())
+	}
+}
+
+// Tests page branching and conditional widgets
+func TestEvaluate(t *testing.T) {
+	form := &models.Form{Pages: []models.Page{
+		{
+			Widgets: []models.Widget{{UID: "q2"}, {UID: "q3"}, {UID: "q7", ShowIf: "q2 > 5"}},
+			Branches: []models.Branch{
+				{When: "q3 == 'Yes'", Goto: 2},
+				{When: "q3 == 'No'", Goto: 3},
+			},
+		},
+		{Widgets: []models.Widget{{UID: "p1"}}},
+		{Widgets: []models.Widget{{UID: "p2"}}},
+		{Widgets: []models.Widget{{UID: "p3"}}},
+	}}
+
+	v := rules.Evaluate(form, map[string]interface{}{"q2": 6.0, "q3": "Yes"})
+	if !reflect.DeepEqual(v.Pages, []int{0, 2, 3}) || !v.Widgets["q7"] || v.Widgets["p1"] || !v.Widgets["p2"] {
+		t.Errorf("Unexpected visibility %+v", v)
+	}
+
+	v = rules.Evaluate(form, map[string]interface{}{"q2": 1.0, "q3": "No"})
+	if !reflect.DeepEqual(v.Pages, []int{0, 3}) || v.Widgets["q7"] || v.Widgets["p2"] {
+		t.Errorf("Unexpected visibility %+v", v)
+	}
+
+	v = rules.Evaluate(form, nil)
+	if !reflect.DeepEqual(v.Pages, []int{0, 1, 2, 3}) || v.Widgets["q7"] {
+		t.Errorf("Unexpected visibility %+v", v)
+	}
+}
@@ -0,0 +1,68 @@
+package rules
+
+import (
+	"log"
+
+	"github.com/pulsejet/go-cerium/models"
+)
+
+// Visibility : pages and widgets shown to a respondent for some answers
+type Visibility struct {
+	// Pages : indices of the pages in the order they are shown
+	Pages []int `json:"pages"`
+
+	// Widgets : UIDs of widgets that are shown
+	Widgets map[string]bool `json:"widgets"`
+}
+
+// Evaluate : walk the form from the first page, following branches and
+// showing widgets whose conditions hold for the answers to visible widgets
+func Evaluate(form *models.Form, answers map[string]interface{}) *Visibility {
+	v := &Visibility{Pages: []int{}, Widgets: map[string]bool{}}
+
+	// Answers to visible widgets seen so far
+	known := map[string]interface{}{}
+
+	visited := map[int]bool{}
+	for pi := 0; pi >= 0 && pi < len(form.Pages) && !visited[pi]; {
+		page := &form.Pages[pi]
+		visited[pi] = true
+		v.Pages = append(v.Pages, pi)
+
+		for wi := range page.Widgets {
+			w := &page.Widgets[wi]
+			if !holds(w.ShowIf, known, true) {
+				continue
+			}
+			v.Widgets[w.UID] = true
+			if answer, ok := answers[w.UID]; ok {
+				known[w.UID] = answer
+			}
+		}
+
+		// First matching branch wins, otherwise go to the next page
+		next := pi + 1
+		for _, b := range page.Branches {
+			if holds(b.When, known, false) {
+				next = b.Goto
+				break
+			}
+		}
+		pi = next
+	}
+
+	return v
+}
+
+// holds : evaluate a condition, using def for empty or broken conditions
+func holds(cond string, answers map[string]interface{}, def bool) bool {
+	if cond == "" {
+		return def
+	}
+	e, err := Parse(cond)
+	if err != nil {
+		log.Println("bad condition", cond, err)
+		return def
+	}
+	return e.Eval(answers)
+}
@@ -0,0 +1,798 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pulsejet/go-cerium/models"
+	u "github.com/pulsejet/go-cerium/utils"
+)
+
+// Memory : store kept in process memory, safe for concurrent use
+type Memory struct {
+	mu        sync.RWMutex
+	forms     map[string]*models.Form
+	shared    map[string]map[string]string
+	transfers map[string]*models.Transfer
+	links     map[string]*models.ShareLink
+	responses map[string]*models.FormResponse
+	fillers   map[models.FormAnonResponder]bool
+	users     map[string]*models.Profile
+	revisions map[string][]*models.Revision
+	counts    map[string]map[string]int
+	audit     map[string][]*models.AuditEntry
+}
+
+// NewMemory : create an empty in-memory store
+func NewMemory() *Memory {
+	return &Memory{
+		forms:     map[string]*models.Form{},
+		shared:    map[string]map[string]string{},
+		transfers: map[string]*models.Transfer{},
+		links:     map[string]*models.ShareLink{},
+		responses: map[string]*models.FormResponse{},
+		fillers:   map[models.FormAnonResponder]bool{},
+		users:     map[string]*models.Profile{},
+		revisions: map[string][]*models.Revision{},
+		counts:    map[string]map[string]int{},
+		audit:     map[string][]*models.AuditEntry{},
+	}
+}
+
+// InsertForm : add a copy of the form
+func (s *Memory) InsertForm(ctx context.Context, form *models.Form) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	form.ID = u.RandomID()
+	s.forms[form.ID] = cloneForm(form)
+	s.forms[form.ID].Collaborators = nil
+	return form.ID, nil
+}
+
+// FindForm : get a copy of the form by id
+func (s *Memory) FindForm(ctx context.Context, id string) (*models.Form, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	form, ok := s.forms[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return s.withCollaborators(form), nil
+}
+
+// FindFormsByCreator : get copies of forms by creator, newest first
+func (s *Memory) FindFormsByCreator(ctx context.Context, creator string) ([]*models.Form, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	forms := []*models.Form{}
+	for _, form := range s.forms {
+		if form.Creator == creator {
+			forms = append(forms, s.withCollaborators(form))
+		}
+	}
+	sort.SliceStable(forms, func(i, j int) bool {
+		return forms[i].Timestamp.After(forms[j].Timestamp)
+	})
+	return forms, nil
+}
+
+// SearchForms : get copies of the forms matching the query, newest first
+func (s *Memory) SearchForms(ctx context.Context, query string, limit int) ([]*models.Form, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	forms := []*models.Form{}
+	for _, form := range s.forms {
+		if query == "" || form.ID == query || form.Creator == query ||
+			strings.Contains(strings.ToLower(form.Name), strings.ToLower(query)) {
+			forms = append(forms, s.withCollaborators(form))
+		}
+	}
+	sort.SliceStable(forms, func(i, j int) bool {
+		return forms[i].Timestamp.After(forms[j].Timestamp)
+	})
+	if len(forms) > limit {
+		forms = forms[:limit]
+	}
+	return forms, nil
+}
+
+// ReplaceForm : overwrite the form matching id, creator and version
+func (s *Memory) ReplaceForm(ctx context.Context, id string, creator string, version int, form *models.Form) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, ok := s.forms[id]
+	if !ok || old.Creator != creator {
+		return ErrNotFound
+	}
+	if old.Version != version {
+		return ErrConflict
+	}
+	form.ID = id
+	form.Version = version + 1
+	s.forms[id] = cloneForm(form)
+	s.forms[id].Collaborators = nil
+	return nil
+}
+
+// DeleteForm : remove the form by id
+func (s *Memory) DeleteForm(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.forms, id)
+	delete(s.shared, id)
+	delete(s.transfers, id)
+	for lid, link := range s.links {
+		if link.FormID == id {
+			delete(s.links, lid)
+		}
+	}
+	return nil
+}
+
+// withCollaborators : copy of a stored form with its collaborators, which
+// must be called holding the lock
+func (s *Memory) withCollaborators(form *models.Form) *models.Form {
+	c := cloneForm(form)
+	c.Collaborators = []models.Collaborator{}
+	for rno, role := range s.shared[form.ID] {
+		c.Collaborators = append(c.Collaborators, models.Collaborator{RollNumber: rno, Role: role})
+	}
+	sort.Slice(c.Collaborators, func(i, j int) bool {
+		return c.Collaborators[i].RollNumber < c.Collaborators[j].RollNumber
+	})
+	return c
+}
+
+// SetTransfer : keep a copy of the transfer as the one pending for its form
+func (s *Memory) SetTransfer(ctx context.Context, transfer *models.Transfer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := *transfer
+	s.transfers[transfer.FormID] = &c
+	return nil
+}
+
+// FindTransfer : get a copy of the transfer pending for the form
+func (s *Memory) FindTransfer(ctx context.Context, formid string) (*models.Transfer, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	transfer, ok := s.transfers[formid]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	c := *transfer
+	return &c, nil
+}
+
+// FindTransfersTo : get copies of the transfers pending for the user, newest first
+func (s *Memory) FindTransfersTo(ctx context.Context, rno string) ([]*models.Transfer, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	transfers := []*models.Transfer{}
+	for _, transfer := range s.transfers {
+		if transfer.To == rno {
+			c := *transfer
+			transfers = append(transfers, &c)
+		}
+	}
+	sort.SliceStable(transfers, func(i, j int) bool {
+		return transfers[i].Offered.After(transfers[j].Offered)
+	})
+	return transfers, nil
+}
+
+// DeleteTransfer : remove the transfer pending for the form
+func (s *Memory) DeleteTransfer(ctx context.Context, formid string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.transfers[formid]; !ok {
+		return ErrNotFound
+	}
+	delete(s.transfers, formid)
+	return nil
+}
+
+// cloneShareLink : copy of a share link that shares no slices with it
+func cloneShareLink(link *models.ShareLink) *models.ShareLink {
+	c := *link
+	c.Scopes = append([]string{}, link.Scopes...)
+	return &c
+}
+
+// InsertShareLink : keep a copy of the share link under a new id
+func (s *Memory) InsertShareLink(ctx context.Context, link *models.ShareLink) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	link.ID = u.RandomID()
+	s.links[link.ID] = cloneShareLink(link)
+	return link.ID, nil
+}
+
+// FindShareLinks : get copies of the share links of the form, newest first
+func (s *Memory) FindShareLinks(ctx context.Context, formid string) ([]*models.ShareLink, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	links := []*models.ShareLink{}
+	for _, link := range s.links {
+		if link.FormID == formid {
+			links = append(links, cloneShareLink(link))
+		}
+	}
+	sort.SliceStable(links, func(i, j int) bool {
+		return links[i].Created.After(links[j].Created)
+	})
+	return links, nil
+}
+
+// FindShareLinkByHash : get a copy of the share link with the token hash
+func (s *Memory) FindShareLinkByHash(ctx context.Context, hash string) (*models.ShareLink, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, link := range s.links {
+		if link.TokenHash == hash {
+			return cloneShareLink(link), nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// RevokeShareLink : mark the share link of the form revoked
+func (s *Memory) RevokeShareLink(ctx context.Context, formid string, id string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	link, ok := s.links[id]
+	if !ok || link.FormID != formid || link.Revoked.Valid {
+		return ErrNotFound
+	}
+	link.Revoked = models.At(at)
+	return nil
+}
+
+// TouchShareLink : note when the share link was last used
+func (s *Memory) TouchShareLink(ctx context.Context, id string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	link, ok := s.links[id]
+	if !ok {
+		return ErrNotFound
+	}
+	link.LastUsed = models.At(at)
+	return nil
+}
+
+// SetCollaborator : add the collaborator to the form or change their role
+func (s *Memory) SetCollaborator(ctx context.Context, formid string, collaborator *models.Collaborator) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.shared[formid] == nil {
+		s.shared[formid] = map[string]string{}
+	}
+	s.shared[formid][collaborator.RollNumber] = collaborator.Role
+	return nil
+}
+
+// DeleteCollaborator : remove the collaborator from the form
+func (s *Memory) DeleteCollaborator(ctx context.Context, formid string, rno string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.shared[formid][rno]; !ok {
+		return ErrNotFound
+	}
+	delete(s.shared[formid], rno)
+	return nil
+}
+
+// FindSharedForms : get copies of the forms shared with the user, newest first
+func (s *Memory) FindSharedForms(ctx context.Context, rno string) ([]*models.Form, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	forms := []*models.Form{}
+	for id, collaborators := range s.shared {
+		if form, ok := s.forms[id]; ok && collaborators[rno] != "" {
+			forms = append(forms, s.withCollaborators(form))
+		}
+	}
+	sort.SliceStable(forms, func(i, j int) bool {
+		return forms[i].Timestamp.After(forms[j].Timestamp)
+	})
+	return forms, nil
+}
+
+// InsertResponse : add a copy of the response
+func (s *Memory) InsertResponse(ctx context.Context, response *models.FormResponse) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	response.ID = u.RandomID()
+	s.responses[response.ID] = cloneResponse(response)
+	return response.ID, nil
+}
+
+// InsertCountedResponse : add a copy of the response and record its fillers
+// if no counter is at its quota and the fillers are new
+func (s *Memory) InsertCountedResponse(ctx context.Context, response *models.FormResponse, quotas []Quota,
+	fillers []*models.FormAnonResponder) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, filler := range fillers {
+		if s.fillers[*filler] {
+			return "", ErrDuplicate
+		}
+	}
+	counts := s.counts[response.FormID]
+	for _, q := range quotas {
+		if q.Max > 0 && counts[q.Key] >= q.Max {
+			return "", &QuotaError{Key: q.Key}
+		}
+	}
+
+	if counts == nil {
+		counts = map[string]int{}
+		s.counts[response.FormID] = counts
+	}
+	for _, q := range quotas {
+		counts[q.Key]++
+	}
+
+	for _, filler := range fillers {
+		s.fillers[*filler] = true
+	}
+
+	response.Counters = quotaKeys(quotas)
+	response.ID = u.RandomID()
+	s.responses[response.ID] = cloneResponse(response)
+	return response.ID, nil
+}
+
+// PromoteResponse : accept a waitlisted response if no counter is at its quota
+func (s *Memory) PromoteResponse(ctx context.Context, formid string, id string, quotas []Quota) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	response, ok := s.responses[id]
+	if !ok || response.FormID != formid {
+		return ErrNotFound
+	}
+	if response.Status != models.ResponseWaitlisted {
+		return ErrConflict
+	}
+
+	counts := s.counts[formid]
+	for _, q := range quotas {
+		if q.Max > 0 && counts[q.Key] >= q.Max {
+			return &QuotaError{Key: q.Key}
+		}
+	}
+	if counts == nil {
+		counts = map[string]int{}
+		s.counts[formid] = counts
+	}
+	for _, q := range quotas {
+		counts[q.Key]++
+	}
+
+	response.Status = models.ResponseAccepted
+	response.Counters = quotaKeys(quotas)
+	return nil
+}
+
+// ReplaceResponse : overwrite the answers of the response if no counter
+// it is added to is at its quota
+func (s *Memory) ReplaceResponse(ctx context.Context, response *models.FormResponse, quotas []Quota,
+	editedBy string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.responses[response.ID]
+	if !ok || stored.FormID != response.FormID || stored.Status == models.ResponseWithdrawn {
+		return ErrNotFound
+	}
+
+	if stored.Status != models.ResponseWaitlisted {
+		added, removed := moveQuotas(stored.Counters, quotas)
+		counts := s.counts[stored.FormID]
+		for _, q := range added {
+			if q.Max > 0 && counts[q.Key] >= q.Max {
+				return &QuotaError{Key: q.Key}
+			}
+		}
+		if counts == nil {
+			counts = map[string]int{}
+			s.counts[stored.FormID] = counts
+		}
+		for _, q := range added {
+			counts[q.Key]++
+		}
+		s.release(stored.FormID, removed)
+		stored.Counters = quotaKeys(quotas)
+	}
+
+	stored.Edits = append(stored.Edits, models.ResponseEdit{Edited: time.Now(), EditedBy: editedBy,
+		Version: stored.Version, Responses: stored.Responses})
+	stored.Responses = cloneMap(response.Responses)
+	stored.Version = response.Version
+	response.Status = stored.Status
+	response.Counters = append([]string(nil), stored.Counters...)
+	response.Edits = cloneResponse(stored).Edits
+	return nil
+}
+
+// WithdrawResponse : clear the response and decrement its counters
+func (s *Memory) WithdrawResponse(ctx context.Context, formid string, id string) (*models.FormResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	response, ok := s.responses[id]
+	if !ok || response.FormID != formid || response.Status == models.ResponseWithdrawn {
+		return nil, ErrNotFound
+	}
+	s.release(formid, response.Counters)
+
+	tombstone := *response
+	tombstone.Status = models.ResponseWithdrawn
+	tombstone.Responses = map[string]interface{}{}
+	tombstone.Edits = nil
+	tombstone.Counters = nil
+	s.responses[id] = &tombstone
+	return response, nil
+}
+
+// release : decrement counters, which must be done holding the lock
+func (s *Memory) release(formid string, keys []string) {
+	for _, key := range keys {
+		if s.counts[formid][key] > 0 {
+			s.counts[formid][key]--
+		}
+	}
+}
+
+// DeleteResponse : remove the response and decrement its counters
+func (s *Memory) DeleteResponse(ctx context.Context, formid string, id string) (*models.FormResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	response, ok := s.responses[id]
+	if !ok || response.FormID != formid {
+		return nil, ErrNotFound
+	}
+	delete(s.responses, id)
+	s.release(formid, response.Counters)
+	return response, nil
+}
+
+// FindCounts : get a copy of the counters of a form
+func (s *Memory) FindCounts(ctx context.Context, formid string) (map[string]int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counts := map[string]int{}
+	for key, n := range s.counts[formid] {
+		counts[key] = n
+	}
+	return counts, nil
+}
+
+// SetCounts : replace the counters by form id, and those of responses stored without them
+func (s *Memory) SetCounts(ctx context.Context, formid string, counts map[string]int,
+	counters map[string][]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.counts[formid] = map[string]int{}
+	for key, n := range counts {
+		s.counts[formid][key] = n
+	}
+	for id, keys := range counters {
+		response, ok := s.responses[id]
+		if ok && response.FormID == formid && len(response.Counters) == 0 {
+			response.Counters = append([]string{}, keys...)
+		}
+	}
+	return nil
+}
+
+// FindResponse : get a copy of a response by form id and id
+func (s *Memory) FindResponse(ctx context.Context, formid string, id string) (*models.FormResponse, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	response, ok := s.responses[id]
+	if !ok || response.FormID != formid {
+		return nil, ErrNotFound
+	}
+	return cloneResponse(response), nil
+}
+
+// FindOwnResponse : get a copy of the latest response by form id and owner
+func (s *Memory) FindOwnResponse(ctx context.Context, formid string, owner string) (*models.FormResponse, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var latest *models.FormResponse
+	for _, response := range s.responses {
+		if response.FormID == formid && response.Owner == owner &&
+			(latest == nil || response.Timestamp.After(latest.Timestamp)) {
+			latest = response
+		}
+	}
+	if latest == nil || owner == "" {
+		return nil, ErrNotFound
+	}
+	return cloneResponse(latest), nil
+}
+
+// FindResponses : get copies of responses by form id, oldest first
+func (s *Memory) FindResponses(ctx context.Context, formid string) ([]*models.FormResponse, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	responses := []*models.FormResponse{}
+	for _, response := range s.responses {
+		if response.FormID == formid {
+			responses = append(responses, cloneResponse(response))
+		}
+	}
+	sort.SliceStable(responses, func(i, j int) bool {
+		return responses[i].Timestamp.Before(responses[j].Timestamp)
+	})
+	return responses, nil
+}
+
+// DeleteResponses : remove responses and counters by form id
+func (s *Memory) DeleteResponses(ctx context.Context, formid string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, response := range s.responses {
+		if response.FormID == formid {
+			delete(s.responses, id)
+		}
+	}
+	delete(s.counts, formid)
+	return nil
+}
+
+// InsertFiller : record the form id and filler pair
+func (s *Memory) InsertFiller(ctx context.Context, filler *models.FormAnonResponder) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.fillers[*filler] = true
+	return nil
+}
+
+// HasFilled : check for the form id and filler pair
+func (s *Memory) HasFilled(ctx context.Context, formid string, filler string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.fillers[models.FormAnonResponder{FormID: formid, Filler: filler}], nil
+}
+
+// DeleteFillers : remove form id and filler pairs
+func (s *Memory) DeleteFillers(ctx context.Context, fillers []*models.FormAnonResponder) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, filler := range fillers {
+		delete(s.fillers, *filler)
+	}
+	return nil
+}
+
+// FindUser : get a copy of the profile by roll number
+func (s *Memory) FindUser(ctx context.Context, rno string) (*models.Profile, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[rno]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	copy := *user
+	return &copy, nil
+}
+
+// UpsertUser : set the profile by roll number
+func (s *Memory) UpsertUser(ctx context.Context, profile *models.Profile) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	copy := *profile
+	copy.Admin = false
+	if old, ok := s.users[profile.RollNumber]; ok {
+		copy.Admin = old.Admin
+	}
+	s.users[profile.RollNumber] = &copy
+	return nil
+}
+
+// SetAdmin : change whether the user is an administrator
+func (s *Memory) SetAdmin(ctx context.Context, rno string, admin bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[rno]
+	if !ok {
+		return ErrNotFound
+	}
+	user.Admin = admin
+	return nil
+}
+
+// InsertRevision : append a copy of the revision
+func (s *Memory) InsertRevision(ctx context.Context, revision *models.Revision) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, r := range s.revisions[revision.FormID] {
+		if r.Version == revision.Version {
+			return ErrConflict
+		}
+	}
+	s.revisions[revision.FormID] = append(s.revisions[revision.FormID], cloneRevision(revision))
+	return nil
+}
+
+// FindRevisions : get copies of revisions of a form, oldest first
+func (s *Memory) FindRevisions(ctx context.Context, formid string) ([]*models.Revision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	revisions := []*models.Revision{}
+	for _, r := range s.revisions[formid] {
+		revisions = append(revisions, cloneRevision(r))
+	}
+	sort.SliceStable(revisions, func(i, j int) bool {
+		return revisions[i].Version < revisions[j].Version
+	})
+	return revisions, nil
+}
+
+// FindRevision : get a copy of a revision by form id and version
+func (s *Memory) FindRevision(ctx context.Context, formid string, version int) (*models.Revision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, r := range s.revisions[formid] {
+		if r.Version == version {
+			return cloneRevision(r), nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// DeleteRevisions : remove revisions of a form
+func (s *Memory) DeleteRevisions(ctx context.Context, formid string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.revisions, formid)
+	return nil
+}
+
+// InsertAudit : add a copy of the audit entry
+func (s *Memory) InsertAudit(ctx context.Context, entry *models.AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.audit[entry.FormID] = append(s.audit[entry.FormID], cloneAudit(entry))
+	return nil
+}
+
+// FindAudit : get copies of the audit entries of a form, oldest first
+func (s *Memory) FindAudit(ctx context.Context, formid string) ([]*models.AuditEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entries := []*models.AuditEntry{}
+	for _, entry := range s.audit[formid] {
+		entries = append(entries, cloneAudit(entry))
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Time.Before(entries[j].Time)
+	})
+	return entries, nil
+}
+
+// cloneForm : deep copy a form so callers cannot mutate stored state
+func cloneForm(f *models.Form) *models.Form {
+	c := *f
+	c.Pages = make([]models.Page, len(f.Pages))
+	for i, page := range f.Pages {
+		c.Pages[i] = page
+		c.Pages[i].Branches = append([]models.Branch(nil), page.Branches...)
+		c.Pages[i].Widgets = make([]models.Widget, len(page.Widgets))
+		for j, widget := range page.Widgets {
+			c.Pages[i].Widgets[j] = widget
+			c.Pages[i].Widgets[j].Props = cloneMap(widget.Props)
+		}
+	}
+	if f.Draft != nil {
+		c.Draft = cloneForm(f.Draft)
+	}
+	c.Collaborators = append([]models.Collaborator(nil), f.Collaborators...)
+	return &c
+}
+
+// cloneRevision : deep copy a revision so callers cannot mutate stored state
+func cloneRevision(r *models.Revision) *models.Revision {
+	c := *r
+	c.Form = *cloneForm(&r.Form)
+	return &c
+}
+
+// cloneResponse : deep copy a response so callers cannot mutate stored state
+func cloneResponse(r *models.FormResponse) *models.FormResponse {
+	c := *r
+	c.Responses = cloneMap(r.Responses)
+	c.Counters = append([]string(nil), r.Counters...)
+	c.Edits = nil
+	for _, edit := range r.Edits {
+		edit.Responses = cloneMap(edit.Responses)
+		c.Edits = append(c.Edits, edit)
+	}
+	return &c
+}
+
+// cloneMap : deep copy a decoded JSON object
+func cloneMap(m map[string]interface{}) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+	c := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		c[k] = cloneValue(v)
+	}
+	return c
+}
+
+// cloneValue : deep copy a decoded JSON value
+func cloneValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return cloneMap(v)
+	case []interface{}:
+		c := make([]interface{}, len(v))
+		for i := range v {
+			c[i] = cloneValue(v[i])
+		}
+		return c
+	default:
+		return v
+	}
+}
+
+// cloneAudit : deep copy an audit entry so callers cannot mutate stored state
+func cloneAudit(e *models.AuditEntry) *models.AuditEntry {
+	c := *e
+	if e.Details != nil {
+		c.Details = map[string]string{}
+		for k, v := range e.Details {
+			c.Details[k] = v
+		}
+	}
+	return &c
+}
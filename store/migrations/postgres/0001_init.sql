@@ -0,0 +1,40 @@
+CREATE TABLE forms (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL DEFAULT '',
+    creator TEXT NOT NULL DEFAULT '',
+    timestamp TIMESTAMPTZ NOT NULL,
+    pages JSONB NOT NULL DEFAULT '[]',
+    require_login BOOLEAN NOT NULL DEFAULT FALSE,
+    collect_email BOOLEAN NOT NULL DEFAULT FALSE,
+    single_response BOOLEAN NOT NULL DEFAULT FALSE,
+    is_closed BOOLEAN NOT NULL DEFAULT FALSE,
+    close_on TIMESTAMPTZ NOT NULL,
+    response_token TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX forms_creator_idx ON forms (creator, timestamp DESC);
+
+CREATE TABLE responses (
+    id TEXT PRIMARY KEY,
+    form_id TEXT NOT NULL,
+    timestamp TIMESTAMPTZ NOT NULL,
+    filler TEXT NOT NULL DEFAULT '',
+    responses JSONB NOT NULL DEFAULT '{}'
+);
+
+CREATE INDEX responses_form_idx ON responses (form_id, timestamp);
+
+CREATE TABLE fillers (
+    form_id TEXT NOT NULL,
+    filler TEXT NOT NULL,
+    UNIQUE (form_id, filler)
+);
+
+CREATE TABLE users (
+    roll_number TEXT PRIMARY KEY,
+    id INTEGER NOT NULL DEFAULT 0,
+    first_name TEXT NOT NULL DEFAULT '',
+    last_name TEXT NOT NULL DEFAULT '',
+    profile_picture TEXT NOT NULL DEFAULT '',
+    email TEXT NOT NULL DEFAULT ''
+);
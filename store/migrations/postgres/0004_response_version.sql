@@ -0,0 +1 @@
+ALTER TABLE responses ADD COLUMN version INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+ALTER TABLE forms ALTER COLUMN close_on DROP NOT NULL;
+ALTER TABLE forms ADD COLUMN open_on TIMESTAMPTZ;
@@ -0,0 +1,10 @@
+CREATE TABLE transfers (
+    form_id TEXT PRIMARY KEY,
+    name TEXT NOT NULL DEFAULT '',
+    from_rno TEXT NOT NULL,
+    to_rno TEXT NOT NULL,
+    offered TIMESTAMPTZ NOT NULL,
+    keep_role TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX transfers_to_idx ON transfers (to_rno, offered DESC);
@@ -0,0 +1 @@
+ALTER TABLE forms DROP COLUMN response_token;
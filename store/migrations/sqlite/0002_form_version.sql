@@ -0,0 +1 @@
+ALTER TABLE forms ADD COLUMN version INTEGER NOT NULL DEFAULT 0;
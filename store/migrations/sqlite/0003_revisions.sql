@@ -0,0 +1,8 @@
+CREATE TABLE revisions (
+    form_id TEXT NOT NULL,
+    version INTEGER NOT NULL,
+    replaced TIMESTAMP NOT NULL,
+    replaced_by TEXT NOT NULL DEFAULT '',
+    form TEXT NOT NULL,
+    PRIMARY KEY (form_id, version)
+);
@@ -0,0 +1,2 @@
+ALTER TABLE forms ADD COLUMN status TEXT NOT NULL DEFAULT '';
+ALTER TABLE forms ADD COLUMN draft TEXT;
@@ -0,0 +1,28 @@
+CREATE TABLE forms_new (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL DEFAULT '',
+    creator TEXT NOT NULL DEFAULT '',
+    timestamp TIMESTAMP NOT NULL,
+    pages TEXT NOT NULL DEFAULT '[]',
+    require_login BOOLEAN NOT NULL DEFAULT 0,
+    collect_email BOOLEAN NOT NULL DEFAULT 0,
+    single_response BOOLEAN NOT NULL DEFAULT 0,
+    is_closed BOOLEAN NOT NULL DEFAULT 0,
+    close_on TIMESTAMP,
+    response_token TEXT NOT NULL DEFAULT '',
+    version INTEGER NOT NULL DEFAULT 0,
+    status TEXT NOT NULL DEFAULT '',
+    draft TEXT,
+    open_on TIMESTAMP
+);
+
+INSERT INTO forms_new (id, name, creator, timestamp, pages, require_login, collect_email,
+    single_response, is_closed, close_on, response_token, version, status, draft)
+SELECT id, name, creator, timestamp, pages, require_login, collect_email,
+    single_response, is_closed, close_on, response_token, version, status, draft FROM forms;
+
+DROP TABLE forms;
+
+ALTER TABLE forms_new RENAME TO forms;
+
+CREATE INDEX forms_creator_idx ON forms (creator, timestamp DESC);
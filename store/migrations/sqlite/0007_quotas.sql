@@ -0,0 +1,8 @@
+ALTER TABLE forms ADD COLUMN response_limit INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE counts (
+    form_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    count INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (form_id, name)
+);
@@ -0,0 +1,3 @@
+ALTER TABLE forms ADD COLUMN waitlist BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE responses ADD COLUMN status TEXT NOT NULL DEFAULT '';
+ALTER TABLE responses ADD COLUMN counters TEXT NOT NULL DEFAULT '[]';
@@ -0,0 +1,5 @@
+ALTER TABLE forms ADD COLUMN allow_edit BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE responses ADD COLUMN owner TEXT NOT NULL DEFAULT '';
+ALTER TABLE responses ADD COLUMN edits TEXT NOT NULL DEFAULT '[]';
+
+CREATE INDEX responses_owner_idx ON responses (form_id, owner, timestamp);
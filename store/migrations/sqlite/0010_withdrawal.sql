@@ -0,0 +1,13 @@
+ALTER TABLE forms ADD COLUMN allow_withdraw BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE forms ADD COLUMN keep_withdrawn BOOLEAN NOT NULL DEFAULT 0;
+
+CREATE TABLE audit (
+    form_id TEXT NOT NULL,
+    time TIMESTAMP NOT NULL,
+    actor TEXT NOT NULL DEFAULT '',
+    action TEXT NOT NULL,
+    target TEXT NOT NULL DEFAULT '',
+    details TEXT NOT NULL DEFAULT '{}'
+);
+
+CREATE INDEX audit_form_idx ON audit (form_id, time);
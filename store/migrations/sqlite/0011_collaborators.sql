@@ -0,0 +1,8 @@
+CREATE TABLE collaborators (
+    form_id TEXT NOT NULL,
+    rno TEXT NOT NULL,
+    role TEXT NOT NULL,
+    PRIMARY KEY (form_id, rno)
+);
+
+CREATE INDEX collaborators_rno_idx ON collaborators (rno);
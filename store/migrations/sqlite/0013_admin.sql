@@ -0,0 +1,2 @@
+ALTER TABLE forms ADD COLUMN suspended BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN admin BOOLEAN NOT NULL DEFAULT 0;
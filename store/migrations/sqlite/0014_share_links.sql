@@ -0,0 +1,14 @@
+CREATE TABLE share_links (
+    id TEXT PRIMARY KEY,
+    form_id TEXT NOT NULL,
+    name TEXT NOT NULL DEFAULT '',
+    scopes TEXT NOT NULL DEFAULT '[]',
+    created TIMESTAMP NOT NULL,
+    created_by TEXT NOT NULL,
+    expires TIMESTAMP,
+    last_used TIMESTAMP,
+    revoked TIMESTAMP,
+    token_hash TEXT NOT NULL UNIQUE
+);
+
+CREATE INDEX share_links_form_idx ON share_links (form_id, created DESC);
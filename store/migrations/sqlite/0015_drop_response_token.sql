@@ -0,0 +1,35 @@
+CREATE TABLE forms_new (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL DEFAULT '',
+    creator TEXT NOT NULL DEFAULT '',
+    timestamp TIMESTAMP NOT NULL,
+    pages TEXT NOT NULL DEFAULT '[]',
+    require_login BOOLEAN NOT NULL DEFAULT 0,
+    collect_email BOOLEAN NOT NULL DEFAULT 0,
+    single_response BOOLEAN NOT NULL DEFAULT 0,
+    is_closed BOOLEAN NOT NULL DEFAULT 0,
+    close_on TIMESTAMP,
+    version INTEGER NOT NULL DEFAULT 0,
+    status TEXT NOT NULL DEFAULT '',
+    draft TEXT,
+    open_on TIMESTAMP,
+    response_limit INTEGER NOT NULL DEFAULT 0,
+    waitlist BOOLEAN NOT NULL DEFAULT 0,
+    allow_edit BOOLEAN NOT NULL DEFAULT 0,
+    allow_withdraw BOOLEAN NOT NULL DEFAULT 0,
+    keep_withdrawn BOOLEAN NOT NULL DEFAULT 0,
+    suspended BOOLEAN NOT NULL DEFAULT 0
+);
+
+INSERT INTO forms_new (id, name, creator, timestamp, pages, require_login, collect_email,
+    single_response, is_closed, close_on, version, status, draft, open_on, response_limit, waitlist,
+    allow_edit, allow_withdraw, keep_withdrawn, suspended)
+SELECT id, name, creator, timestamp, pages, require_login, collect_email,
+    single_response, is_closed, close_on, version, status, draft, open_on, response_limit, waitlist,
+    allow_edit, allow_withdraw, keep_withdrawn, suspended FROM forms;
+
+DROP TABLE forms;
+
+ALTER TABLE forms_new RENAME TO forms;
+
+CREATE INDEX forms_creator_idx ON forms (creator, timestamp DESC);
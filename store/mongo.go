@@ -0,0 +1,1039 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/pulsejet/go-cerium/models"
+)
+
+// Mongo : store backed by a MongoDB database
+type Mongo struct {
+	db *mongo.Database
+}
+
+// formDoc : form as stored in the forms collection
+type formDoc struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty"`
+	models.Form `bson:",inline"`
+}
+
+// responseDoc : response as stored in the responses collection
+type responseDoc struct {
+	ID                  primitive.ObjectID `bson:"_id,omitempty"`
+	models.FormResponse `bson:",inline"`
+}
+
+// collaboratorDoc : collaborator as stored in the collaborators collection
+type collaboratorDoc struct {
+	FormID     string `bson:"formid"`
+	RollNumber string `bson:"rno"`
+	Role       string `bson:"role"`
+}
+
+// NewMongo : connect to the database with the given name
+func NewMongo(ctx context.Context, uri string, database string) (*Mongo, error) {
+	// Setup options
+	opts := options.Client().ApplyURI(uri)
+	opts.SetMaxPoolSize(10)
+
+	// Create client
+	client, err := mongo.NewClient(opts)
+	if err != nil {
+		return nil, err
+	}
+	err = client.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Mongo{db: client.Database(database)}
+	err = s.ensureIndexes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// ensureIndexes : create the unique indexes the store relies on
+func (s *Mongo) ensureIndexes(ctx context.Context) error {
+	_, err := s.Collection("counts").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "formid", Value: 1}, {Key: "key", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	// Fillers were recorded on every response to forms requiring login before
+	// the index existed, so the duplicates are removed once if it fails
+	fillerIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "formid", Value: 1}, {Key: "filler", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+	_, err = s.Collection("filler").Indexes().CreateOne(ctx, fillerIndex)
+	if err != nil {
+		log.Println("could not create unique index on fillers, removing duplicate fillers:", err)
+		err = s.dedupeFillers(ctx)
+		if err != nil {
+			return fmt.Errorf("could not remove duplicate fillers: %v", err)
+		}
+		_, err = s.Collection("filler").Indexes().CreateOne(ctx, fillerIndex)
+		if err != nil {
+			return fmt.Errorf("could not create unique index on fillers: %v", err)
+		}
+	}
+
+	_, err = s.Collection("collaborators").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "formid", Value: 1}, {Key: "rno", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "rno", Value: 1}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	// One transfer may be pending for each form
+	_, err = s.Collection("transfers").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "formid", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = s.Collection("share_links").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "tokenhash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "formid", Value: 1}, {Key: "created", Value: -1}}},
+	})
+	return err
+}
+
+// dedupeFillers : keep one document for each form and filler in the filler collection
+func (s *Mongo) dedupeFillers(ctx context.Context) error {
+	cur, err := s.Collection("filler").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{
+			"_id": bson.M{"formid": "$formid", "filler": "$filler"},
+			"ids": bson.M{"$push": "$_id"},
+			"n":   bson.M{"$sum": 1},
+		}}},
+		{{Key: "$match", Value: bson.M{"n": bson.M{"$gt": 1}}}},
+	}, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+
+	removed := 0
+	for cur.Next(ctx) {
+		var doc struct {
+			IDs []primitive.ObjectID `bson:"ids"`
+		}
+		err := cur.Decode(&doc)
+		if err != nil {
+			return err
+		}
+		res, err := s.Collection("filler").DeleteMany(ctx, bson.M{"_id": bson.M{"$in": doc.IDs[1:]}})
+		if err != nil {
+			return err
+		}
+		removed += int(res.DeletedCount)
+	}
+	if err := cur.Err(); err != nil {
+		return err
+	}
+	log.Println("removed", removed, "duplicate fillers")
+	return nil
+}
+
+// Collection : get pointer to collection
+func (s *Mongo) Collection(name string) *mongo.Collection {
+	return s.db.Collection(name)
+}
+
+// mongoErr : translate driver errors to store errors
+func mongoErr(err error) error {
+	if err == mongo.ErrNoDocuments {
+		return ErrNotFound
+	}
+	return err
+}
+
+// isDuplicate : whether the write failed on a unique index
+func isDuplicate(err error) bool {
+	if we, ok := err.(mongo.WriteException); ok {
+		for _, e := range we.WriteErrors {
+			if e.Code == 11000 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// InsertForm : insert into the forms collection
+func (s *Mongo) InsertForm(ctx context.Context, form *models.Form) (string, error) {
+	res, err := s.Collection("forms").InsertOne(ctx, &formDoc{Form: *form})
+	if err != nil {
+		return "", err
+	}
+	id := res.InsertedID.(primitive.ObjectID).Hex()
+	form.ID = id
+	return id, nil
+}
+
+// findForm : find one form matching the filter
+func (s *Mongo) findForm(ctx context.Context, filt bson.M) (*models.Form, error) {
+	doc := &formDoc{}
+	err := s.Collection("forms").FindOne(ctx, filt).Decode(doc)
+	if err != nil {
+		return nil, mongoErr(err)
+	}
+	doc.Form.ID = doc.ID.Hex()
+	err = s.loadCollaborators(ctx, []*models.Form{&doc.Form})
+	if err != nil {
+		return nil, err
+	}
+	return &doc.Form, nil
+}
+
+// findForms : find the forms matching the filter, newest first, at most
+// limit of them unless it is zero
+func (s *Mongo) findForms(ctx context.Context, filt bson.M, limit int64) ([]*models.Form, error) {
+	opt := options.Find()
+	opt.SetSort(bson.D{{Key: "timestamp", Value: -1}})
+	if limit > 0 {
+		opt.SetLimit(limit)
+	}
+
+	cur, err := s.Collection("forms").Find(ctx, filt, opt)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	// Iterate and collect forms
+	forms := []*models.Form{}
+	for cur.Next(ctx) {
+		doc := &formDoc{}
+		err := cur.Decode(doc)
+		if err != nil {
+			return nil, err
+		}
+		doc.Form.ID = doc.ID.Hex()
+		forms = append(forms, &doc.Form)
+	}
+	if err := cur.Err(); err != nil {
+		return nil, err
+	}
+
+	err = s.loadCollaborators(ctx, forms)
+	if err != nil {
+		return nil, err
+	}
+	return forms, nil
+}
+
+// loadCollaborators : find the collaborators of the forms, sorted by roll number
+func (s *Mongo) loadCollaborators(ctx context.Context, forms []*models.Form) error {
+	if len(forms) == 0 {
+		return nil
+	}
+	byID := map[string]*models.Form{}
+	ids := bson.A{}
+	for _, form := range forms {
+		form.Collaborators = []models.Collaborator{}
+		byID[form.ID] = form
+		ids = append(ids, form.ID)
+	}
+
+	opt := options.Find()
+	opt.SetSort(bson.D{{Key: "rno", Value: 1}})
+	cur, err := s.Collection("collaborators").Find(ctx, bson.M{"formid": bson.M{"$in": ids}}, opt)
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		doc := &collaboratorDoc{}
+		err := cur.Decode(doc)
+		if err != nil {
+			return err
+		}
+		byID[doc.FormID].Collaborators = append(byID[doc.FormID].Collaborators,
+			models.Collaborator{RollNumber: doc.RollNumber, Role: doc.Role})
+	}
+	return cur.Err()
+}
+
+// FindForm : find form by object id
+func (s *Mongo) FindForm(ctx context.Context, id string) (*models.Form, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	return s.findForm(ctx, bson.M{"_id": objID})
+}
+
+// FindFormsByCreator : find forms by creator sorted by timestamp
+func (s *Mongo) FindFormsByCreator(ctx context.Context, creator string) ([]*models.Form, error) {
+	return s.findForms(ctx, bson.M{"creator": creator}, 0)
+}
+
+// SearchForms : find the forms matching the query, newest first
+func (s *Mongo) SearchForms(ctx context.Context, query string, limit int) ([]*models.Form, error) {
+	filt := bson.M{}
+	if query != "" {
+		or := bson.A{
+			bson.M{"creator": query},
+			bson.M{"name": primitive.Regex{Pattern: regexp.QuoteMeta(query), Options: "i"}},
+		}
+		if objID, err := primitive.ObjectIDFromHex(query); err == nil {
+			or = append(or, bson.M{"_id": objID})
+		}
+		filt = bson.M{"$or": or}
+	}
+
+	return s.findForms(ctx, filt, int64(limit))
+}
+
+// ReplaceForm : replace form matching object id, creator and version
+func (s *Mongo) ReplaceForm(ctx context.Context, id string, creator string, version int, form *models.Form) error {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNotFound
+	}
+
+	// Forms saved before versioning have no version field
+	versionFilt := bson.M{"version": version}
+	if version == 0 {
+		versionFilt = bson.M{"version": bson.M{"$in": bson.A{0, nil}}}
+	}
+	filt := bson.M{"$and": bson.A{
+		bson.M{"_id": objID},
+		bson.M{"creator": creator},
+		versionFilt}}
+
+	replacement := *form
+	replacement.Version = version + 1
+	res, err := s.Collection("forms").ReplaceOne(ctx, filt, &replacement)
+	if err != nil {
+		return err
+	}
+
+	// Tell apart a missing form from a stale version
+	if res.MatchedCount == 0 {
+		old, err := s.FindForm(ctx, id)
+		if err != nil || old.Creator != creator {
+			return ErrNotFound
+		}
+		return ErrConflict
+	}
+	form.ID = id
+	form.Version = replacement.Version
+	return nil
+}
+
+// DeleteForm : delete form by object id
+func (s *Mongo) DeleteForm(ctx context.Context, id string) error {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNotFound
+	}
+	_, err = s.Collection("forms").DeleteOne(ctx, bson.M{"_id": objID})
+	if err != nil {
+		return err
+	}
+	_, err = s.Collection("collaborators").DeleteMany(ctx, bson.M{"formid": id})
+	if err != nil {
+		return err
+	}
+	_, err = s.Collection("share_links").DeleteMany(ctx, bson.M{"formid": id})
+	if err != nil {
+		return err
+	}
+	_, err = s.Collection("transfers").DeleteOne(ctx, bson.M{"formid": id})
+	return err
+}
+
+// InsertShareLink : insert the share link under a new id
+func (s *Mongo) InsertShareLink(ctx context.Context, link *models.ShareLink) (string, error) {
+	c := *link
+	c.ID = primitive.NewObjectID().Hex()
+	_, err := s.Collection("share_links").InsertOne(ctx, &c)
+	if err != nil {
+		return "", err
+	}
+	link.ID = c.ID
+	return c.ID, nil
+}
+
+// FindShareLinks : find the share links of the form, newest first
+func (s *Mongo) FindShareLinks(ctx context.Context, formid string) ([]*models.ShareLink, error) {
+	opt := options.Find()
+	opt.SetSort(bson.D{{Key: "created", Value: -1}})
+
+	cur, err := s.Collection("share_links").Find(ctx, bson.M{"formid": formid}, opt)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	links := []*models.ShareLink{}
+	for cur.Next(ctx) {
+		link := &models.ShareLink{}
+		err := cur.Decode(link)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+	return links, cur.Err()
+}
+
+// FindShareLinkByHash : find the share link with the token hash
+func (s *Mongo) FindShareLinkByHash(ctx context.Context, hash string) (*models.ShareLink, error) {
+	link := &models.ShareLink{}
+	err := s.Collection("share_links").FindOne(ctx, bson.M{"tokenhash": hash}).Decode(link)
+	if err != nil {
+		return nil, mongoErr(err)
+	}
+	return link, nil
+}
+
+// RevokeShareLink : set the revocation time of the share link of the form
+func (s *Mongo) RevokeShareLink(ctx context.Context, formid string, id string, at time.Time) error {
+	res, err := s.Collection("share_links").UpdateOne(ctx,
+		bson.M{"id": id, "formid": formid, "revoked": nil},
+		bson.M{"$set": bson.M{"revoked": models.At(at)}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// TouchShareLink : set the last use time of the share link
+func (s *Mongo) TouchShareLink(ctx context.Context, id string, at time.Time) error {
+	res, err := s.Collection("share_links").UpdateOne(ctx, bson.M{"id": id},
+		bson.M{"$set": bson.M{"lastused": models.At(at)}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// SetTransfer : upsert the transfer pending for the form
+func (s *Mongo) SetTransfer(ctx context.Context, transfer *models.Transfer) error {
+	_, err := s.Collection("transfers").ReplaceOne(ctx, bson.M{"formid": transfer.FormID}, transfer,
+		options.Replace().SetUpsert(true))
+	return err
+}
+
+// FindTransfer : find the transfer pending for the form
+func (s *Mongo) FindTransfer(ctx context.Context, formid string) (*models.Transfer, error) {
+	transfer := &models.Transfer{}
+	err := s.Collection("transfers").FindOne(ctx, bson.M{"formid": formid}).Decode(transfer)
+	if err != nil {
+		return nil, mongoErr(err)
+	}
+	return transfer, nil
+}
+
+// FindTransfersTo : find the transfers pending for the user, newest first
+func (s *Mongo) FindTransfersTo(ctx context.Context, rno string) ([]*models.Transfer, error) {
+	opt := options.Find()
+	opt.SetSort(bson.D{{Key: "offered", Value: -1}})
+
+	cur, err := s.Collection("transfers").Find(ctx, bson.M{"to": rno}, opt)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	transfers := []*models.Transfer{}
+	for cur.Next(ctx) {
+		transfer := &models.Transfer{}
+		err := cur.Decode(transfer)
+		if err != nil {
+			return nil, err
+		}
+		transfers = append(transfers, transfer)
+	}
+	return transfers, cur.Err()
+}
+
+// DeleteTransfer : delete the transfer pending for the form
+func (s *Mongo) DeleteTransfer(ctx context.Context, formid string) error {
+	res, err := s.Collection("transfers").DeleteOne(ctx, bson.M{"formid": formid})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// SetCollaborator : upsert the collaborator of the form
+func (s *Mongo) SetCollaborator(ctx context.Context, formid string, collaborator *models.Collaborator) error {
+	_, err := s.Collection("collaborators").UpdateOne(ctx,
+		bson.M{"formid": formid, "rno": collaborator.RollNumber},
+		bson.M{"$set": bson.M{"role": collaborator.Role}},
+		options.Update().SetUpsert(true))
+	return err
+}
+
+// DeleteCollaborator : delete the collaborator of the form
+func (s *Mongo) DeleteCollaborator(ctx context.Context, formid string, rno string) error {
+	res, err := s.Collection("collaborators").DeleteOne(ctx, bson.M{"formid": formid, "rno": rno})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// FindSharedForms : find the forms shared with the user, newest first
+func (s *Mongo) FindSharedForms(ctx context.Context, rno string) ([]*models.Form, error) {
+	cur, err := s.Collection("collaborators").Find(ctx, bson.M{"rno": rno})
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	ids := bson.A{}
+	for cur.Next(ctx) {
+		doc := &collaboratorDoc{}
+		err := cur.Decode(doc)
+		if err != nil {
+			return nil, err
+		}
+		if objID, err := primitive.ObjectIDFromHex(doc.FormID); err == nil {
+			ids = append(ids, objID)
+		}
+	}
+	if err := cur.Err(); err != nil {
+		return nil, err
+	}
+	return s.findForms(ctx, bson.M{"_id": bson.M{"$in": ids}}, 0)
+}
+
+// InsertResponse : insert into the responses collection
+func (s *Mongo) InsertResponse(ctx context.Context, response *models.FormResponse) (string, error) {
+	res, err := s.Collection("responses").InsertOne(ctx, &responseDoc{FormResponse: *response})
+	if err != nil {
+		return "", err
+	}
+	id := res.InsertedID.(primitive.ObjectID).Hex()
+	response.ID = id
+	return id, nil
+}
+
+// release : decrement counters in the counts collection, even once the
+// request is cancelled so that places are not lost
+func (s *Mongo) release(formid string, keys []string) {
+	ctx := context.Background()
+	for _, key := range keys {
+		_, err := s.Collection("counts").UpdateOne(ctx,
+			bson.M{"formid": formid, "key": key, "count": bson.M{"$gt": 0}},
+			bson.M{"$inc": bson.M{"count": -1}})
+		if err != nil {
+			log.Println("could not release quota:", err)
+		}
+	}
+}
+
+// count : increment counters in the counts collection one by one,
+// undoing the increments if one is at its quota
+func (s *Mongo) count(ctx context.Context, formid string, quotas []Quota) error {
+	counts := s.Collection("counts")
+	for i, q := range quotas {
+		// Create the counter if missing, losing a race to create it is fine
+		_, err := counts.UpdateOne(ctx, bson.M{"formid": formid, "key": q.Key},
+			bson.M{"$setOnInsert": bson.M{"count": 0}}, options.Update().SetUpsert(true))
+		if err != nil && !isDuplicate(err) {
+			s.release(formid, quotaKeys(quotas[:i]))
+			return err
+		}
+
+		// Increment only below the quota
+		filt := bson.M{"formid": formid, "key": q.Key}
+		if q.Max > 0 {
+			filt["count"] = bson.M{"$lt": q.Max}
+		}
+		res, err := counts.UpdateOne(ctx, filt, bson.M{"$inc": bson.M{"count": 1}})
+		if err == nil && res.MatchedCount == 0 {
+			err = &QuotaError{Key: q.Key}
+		}
+		if err != nil {
+			s.release(formid, quotaKeys(quotas[:i]))
+			return err
+		}
+	}
+	return nil
+}
+
+// InsertCountedResponse : increment the counters, then insert the fillers and
+// the response, undoing what was done if one of them fails
+func (s *Mongo) InsertCountedResponse(ctx context.Context, response *models.FormResponse, quotas []Quota,
+	fillers []*models.FormAnonResponder) (string, error) {
+	err := s.count(ctx, response.FormID, quotas)
+	if err != nil {
+		return "", err
+	}
+
+	response.Counters = quotaKeys(quotas)
+	id, err := s.insertFilledResponse(ctx, response, fillers)
+	if err != nil {
+		s.release(response.FormID, response.Counters)
+		return "", err
+	}
+	return id, nil
+}
+
+// insertFilledResponse : insert the fillers, then the response, removing the
+// fillers if it fails. The unique index on fillers lets one of concurrent
+// inserts through without needing a transaction
+func (s *Mongo) insertFilledResponse(ctx context.Context, response *models.FormResponse,
+	fillers []*models.FormAnonResponder) (string, error) {
+	for i, filler := range fillers {
+		_, err := s.Collection("filler").InsertOne(ctx, filler)
+		if isDuplicate(err) {
+			err = ErrDuplicate
+		}
+		if err != nil {
+			s.removeFillers(ctx, fillers[:i])
+			return "", err
+		}
+	}
+
+	id, err := s.InsertResponse(ctx, response)
+	if err != nil {
+		s.removeFillers(ctx, fillers)
+		return "", err
+	}
+	return id, nil
+}
+
+// removeFillers : delete fillers inserted with a response that was not stored
+func (s *Mongo) removeFillers(ctx context.Context, fillers []*models.FormAnonResponder) {
+	if err := s.DeleteFillers(ctx, fillers); err != nil {
+		log.Println("could not remove fillers:", err)
+	}
+}
+
+// PromoteResponse : increment the counters, then accept the response if it
+// is still waitlisted, undoing the increments otherwise
+func (s *Mongo) PromoteResponse(ctx context.Context, formid string, id string, quotas []Quota) error {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNotFound
+	}
+
+	err = s.count(ctx, formid, quotas)
+	if err != nil {
+		return err
+	}
+
+	res, err := s.Collection("responses").UpdateOne(ctx,
+		bson.M{"_id": objID, "formid": formid, "status": models.ResponseWaitlisted},
+		bson.M{"$set": bson.M{"status": models.ResponseAccepted, "counters": quotaKeys(quotas)}})
+	if err == nil && res.MatchedCount == 0 {
+		err = ErrConflict
+	}
+	if err != nil {
+		s.release(formid, quotaKeys(quotas))
+		return err
+	}
+	return nil
+}
+
+// FindResponse : find a response by form id and object id
+func (s *Mongo) FindResponse(ctx context.Context, formid string, id string) (*models.FormResponse, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+
+	doc := &responseDoc{}
+	err = s.Collection("responses").FindOne(ctx, bson.M{"_id": objID, "formid": formid}).Decode(doc)
+	if err != nil {
+		return nil, mongoErr(err)
+	}
+	doc.FormResponse.ID = id
+	return &doc.FormResponse, nil
+}
+
+// ReplaceResponse : increment the counters the response is added to, then
+// update it if it did not change since it was read and decrement the
+// counters it is removed from, undoing the increments otherwise
+func (s *Mongo) ReplaceResponse(ctx context.Context, response *models.FormResponse, quotas []Quota,
+	editedBy string) error {
+	stored, err := s.FindResponse(ctx, response.FormID, response.ID)
+	if err != nil {
+		return err
+	}
+	if stored.Status == models.ResponseWithdrawn {
+		return ErrNotFound
+	}
+	objID, _ := primitive.ObjectIDFromHex(response.ID)
+
+	keys := stored.Counters
+	added, removed := []Quota{}, []string{}
+	if stored.Status != models.ResponseWaitlisted {
+		added, removed = moveQuotas(stored.Counters, quotas)
+		keys = quotaKeys(quotas)
+	}
+	err = s.count(ctx, stored.FormID, added)
+	if err != nil {
+		return err
+	}
+
+	// Promotions change the counters and other edits the number of edits
+	n := len(stored.Edits)
+	filt := bson.M{"_id": objID, "formid": stored.FormID, "counters": stored.Counters,
+		"status": bson.M{"$ne": models.ResponseWithdrawn}, "edits." + strconv.Itoa(n): bson.M{"$exists": false}}
+	if n > 0 {
+		filt["edits."+strconv.Itoa(n-1)] = bson.M{"$exists": true}
+	}
+	edit := models.ResponseEdit{Edited: time.Now(), EditedBy: editedBy, Version: stored.Version,
+		Responses: stored.Responses}
+	res, err := s.Collection("responses").UpdateOne(ctx, filt, bson.M{
+		"$set":  bson.M{"responses": response.Responses, "version": response.Version, "counters": keys},
+		"$push": bson.M{"edits": edit}})
+	if err == nil && res.MatchedCount == 0 {
+		err = ErrConflict
+	}
+	if err != nil {
+		s.release(stored.FormID, quotaKeys(added))
+		return err
+	}
+	s.release(stored.FormID, removed)
+
+	response.Status = stored.Status
+	response.Counters = keys
+	response.Edits = append(stored.Edits, edit)
+	return nil
+}
+
+// WithdrawResponse : clear the response by object id unless it was withdrawn,
+// then decrement its counters
+func (s *Mongo) WithdrawResponse(ctx context.Context, formid string, id string) (*models.FormResponse, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+
+	doc := &responseDoc{}
+	err = s.Collection("responses").FindOneAndUpdate(ctx,
+		bson.M{"_id": objID, "formid": formid, "status": bson.M{"$ne": models.ResponseWithdrawn}},
+		bson.M{
+			"$set":   bson.M{"status": models.ResponseWithdrawn, "responses": bson.M{}},
+			"$unset": bson.M{"counters": "", "edits": ""},
+		}).Decode(doc)
+	if err != nil {
+		return nil, mongoErr(err)
+	}
+	doc.FormResponse.ID = id
+
+	s.release(formid, doc.Counters)
+	return &doc.FormResponse, nil
+}
+
+// DeleteResponse : delete the response by object id, then decrement its counters
+func (s *Mongo) DeleteResponse(ctx context.Context, formid string, id string) (*models.FormResponse, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+
+	doc := &responseDoc{}
+	err = s.Collection("responses").FindOneAndDelete(ctx, bson.M{"_id": objID, "formid": formid}).Decode(doc)
+	if err != nil {
+		return nil, mongoErr(err)
+	}
+	doc.FormResponse.ID = id
+
+	s.release(formid, doc.Counters)
+	return &doc.FormResponse, nil
+}
+
+// FindCounts : find counters by form id
+func (s *Mongo) FindCounts(ctx context.Context, formid string) (map[string]int, error) {
+	cur, err := s.Collection("counts").Find(ctx, bson.M{"formid": formid})
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	counts := map[string]int{}
+	for cur.Next(ctx) {
+		var doc struct {
+			Key   string
+			Count int
+		}
+		err := cur.Decode(&doc)
+		if err != nil {
+			return nil, err
+		}
+		counts[doc.Key] = doc.Count
+	}
+	return counts, cur.Err()
+}
+
+// SetCounts : set the counters by form id and remove the others, then set the
+// counters of responses stored without them
+func (s *Mongo) SetCounts(ctx context.Context, formid string, counts map[string]int,
+	counters map[string][]string) error {
+	keys := bson.A{}
+	for key, n := range counts {
+		_, err := s.Collection("counts").UpdateOne(ctx, bson.M{"formid": formid, "key": key},
+			bson.M{"$set": bson.M{"count": n}}, options.Update().SetUpsert(true))
+		if err != nil {
+			return err
+		}
+		keys = append(keys, key)
+	}
+	_, err := s.Collection("counts").DeleteMany(ctx, bson.M{"formid": formid, "key": bson.M{"$nin": keys}})
+	if err != nil {
+		return err
+	}
+
+	for id, keys := range counters {
+		objID, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			continue
+		}
+		_, err = s.Collection("responses").UpdateOne(ctx,
+			bson.M{"_id": objID, "formid": formid,
+				"$or": bson.A{bson.M{"counters": nil}, bson.M{"counters": bson.M{"$size": 0}}}},
+			bson.M{"$set": bson.M{"counters": keys}})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FindOwnResponse : find the latest response by form id and owner
+func (s *Mongo) FindOwnResponse(ctx context.Context, formid string, owner string) (*models.FormResponse, error) {
+	if owner == "" {
+		return nil, ErrNotFound
+	}
+
+	doc := &responseDoc{}
+	err := s.Collection("responses").FindOne(ctx, bson.M{"formid": formid, "owner": owner},
+		options.FindOne().SetSort(bson.M{"timestamp": -1})).Decode(doc)
+	if err != nil {
+		return nil, mongoErr(err)
+	}
+	doc.FormResponse.ID = doc.ID.Hex()
+	return &doc.FormResponse, nil
+}
+
+// FindResponses : find responses by form id, oldest first
+func (s *Mongo) FindResponses(ctx context.Context, formid string) ([]*models.FormResponse, error) {
+	// Oldest first, so that waitlists are promoted in order
+	opt := options.Find()
+	opt.SetSort(bson.D{{Key: "timestamp", Value: 1}, {Key: "_id", Value: 1}})
+
+	cur, err := s.Collection("responses").Find(ctx, bson.M{"formid": formid}, opt)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	// Iterate and collect responses
+	responses := []*models.FormResponse{}
+	for cur.Next(ctx) {
+		doc := &responseDoc{}
+		err := cur.Decode(doc)
+		if err != nil {
+			return nil, err
+		}
+		doc.FormResponse.ID = doc.ID.Hex()
+		responses = append(responses, &doc.FormResponse)
+	}
+	return responses, cur.Err()
+}
+
+// DeleteResponses : delete responses and counters by form id
+func (s *Mongo) DeleteResponses(ctx context.Context, formid string) error {
+	_, err := s.Collection("responses").DeleteMany(ctx, bson.M{"formid": formid})
+	if err != nil {
+		return err
+	}
+	_, err = s.Collection("counts").DeleteMany(ctx, bson.M{"formid": formid})
+	return err
+}
+
+// InsertFiller : insert into the filler collection
+func (s *Mongo) InsertFiller(ctx context.Context, filler *models.FormAnonResponder) error {
+	_, err := s.Collection("filler").InsertOne(ctx, filler)
+	if isDuplicate(err) {
+		return nil
+	}
+	return err
+}
+
+// DeleteFillers : delete from the filler collection
+func (s *Mongo) DeleteFillers(ctx context.Context, fillers []*models.FormAnonResponder) error {
+	for _, filler := range fillers {
+		_, err := s.Collection("filler").DeleteOne(ctx, bson.M{"formid": filler.FormID, "filler": filler.Filler})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HasFilled : check the filler collection for form id and filler
+func (s *Mongo) HasFilled(ctx context.Context, formid string, filler string) (bool, error) {
+	err := s.Collection("filler").FindOne(ctx, bson.M{
+		"$and": bson.A{
+			bson.M{"formid": formid},
+			bson.M{"filler": filler}}}).Decode(&models.FormAnonResponder{})
+	if err == mongo.ErrNoDocuments {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// InsertRevision : insert into the revisions collection
+func (s *Mongo) InsertRevision(ctx context.Context, revision *models.Revision) error {
+	_, err := s.Collection("revisions").InsertOne(ctx, revision)
+	return err
+}
+
+// FindRevisions : find revisions by form id sorted by version
+func (s *Mongo) FindRevisions(ctx context.Context, formid string) ([]*models.Revision, error) {
+	opt := options.Find()
+	opt.SetSort(bson.D{{Key: "version", Value: 1}})
+
+	cur, err := s.Collection("revisions").Find(ctx, bson.M{"formid": formid}, opt)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	// Iterate and collect revisions
+	revisions := []*models.Revision{}
+	for cur.Next(ctx) {
+		revision := &models.Revision{}
+		err := cur.Decode(revision)
+		if err != nil {
+			return nil, err
+		}
+		revision.Form.ID = formid
+		revisions = append(revisions, revision)
+	}
+	return revisions, cur.Err()
+}
+
+// FindRevision : find revision by form id and version
+func (s *Mongo) FindRevision(ctx context.Context, formid string, version int) (*models.Revision, error) {
+	revision := &models.Revision{}
+	err := s.Collection("revisions").FindOne(ctx, bson.M{"$and": bson.A{
+		bson.M{"formid": formid},
+		bson.M{"version": version}}}).Decode(revision)
+	if err != nil {
+		return nil, mongoErr(err)
+	}
+	revision.Form.ID = formid
+	return revision, nil
+}
+
+// DeleteRevisions : delete revisions by form id
+func (s *Mongo) DeleteRevisions(ctx context.Context, formid string) error {
+	_, err := s.Collection("revisions").DeleteMany(ctx, bson.M{"formid": formid})
+	return err
+}
+
+// InsertAudit : insert into the audit collection
+func (s *Mongo) InsertAudit(ctx context.Context, entry *models.AuditEntry) error {
+	_, err := s.Collection("audit").InsertOne(ctx, entry)
+	return err
+}
+
+// FindAudit : find audit entries by form id, oldest first
+func (s *Mongo) FindAudit(ctx context.Context, formid string) ([]*models.AuditEntry, error) {
+	opt := options.Find()
+	opt.SetSort(bson.D{{Key: "time", Value: 1}})
+
+	cur, err := s.Collection("audit").Find(ctx, bson.M{"formid": formid}, opt)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	entries := []*models.AuditEntry{}
+	for cur.Next(ctx) {
+		entry := &models.AuditEntry{}
+		err := cur.Decode(entry)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, cur.Err()
+}
+
+// FindUser : find profile by roll number
+func (s *Mongo) FindUser(ctx context.Context, rno string) (*models.Profile, error) {
+	user := &models.Profile{}
+	err := s.Collection("users").FindOne(ctx, bson.M{"rollnumber": rno}).Decode(user)
+	if err != nil {
+		return nil, mongoErr(err)
+	}
+	return user, nil
+}
+
+// UpsertUser : replace or insert profile by roll number
+func (s *Mongo) UpsertUser(ctx context.Context, profile *models.Profile) error {
+	doc, err := bson.Marshal(profile)
+	if err != nil {
+		return err
+	}
+	fields := bson.M{}
+	err = bson.Unmarshal(doc, &fields)
+	if err != nil {
+		return err
+	}
+
+	// Administrators are only made with SetAdmin
+	delete(fields, "admin")
+	opts := options.Update().SetUpsert(true)
+	_, err = s.Collection("users").UpdateOne(
+		ctx, bson.M{"rollnumber": profile.RollNumber}, bson.M{"$set": fields}, opts)
+	return err
+}
+
+// SetAdmin : update whether the user is an administrator
+func (s *Mongo) SetAdmin(ctx context.Context, rno string, admin bool) error {
+	res, err := s.Collection("users").UpdateOne(ctx, bson.M{"rollnumber": rno},
+		bson.M{"$set": bson.M{"admin": admin}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+package store
+
+import (
+	"context"
+
+	// PostgreSQL driver
+	_ "github.com/lib/pq"
+)
+
+// NewPostgres : connect to a PostgreSQL database and apply migrations
+func NewPostgres(ctx context.Context, uri string) (*SQL, error) {
+	return openSQL(ctx, "postgres", uri, dialect{name: "postgres", numbered: true})
+}
@@ -0,0 +1,1090 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pulsejet/go-cerium/models"
+	u "github.com/pulsejet/go-cerium/utils"
+)
+
+//go:embed migrations
+var migrations embed.FS
+
+// SQL : store backed by a relational database
+type SQL struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+// dialect : differences between the supported SQL databases
+type dialect struct {
+	// name of the directory holding the migrations
+	name string
+
+	// numbered placeholders ($1, $2) instead of ?
+	numbered bool
+
+	// maximum open connections, zero for no limit
+	maxConns int
+}
+
+// rowScanner : common interface of sql.Row and sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// openSQL : open the database and bring its schema up to date
+func openSQL(ctx context.Context, driver string, dsn string, d dialect) (*SQL, error) {
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(d.maxConns)
+	err = db.PingContext(ctx)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	s := &SQL{db: db, dialect: d}
+	err = s.migrate(ctx)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Close : close the underlying database
+func (s *SQL) Close() error {
+	return s.db.Close()
+}
+
+// migrate : apply embedded migrations newer than the schema version
+func (s *SQL) migrate(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx,
+		"CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)")
+	if err != nil {
+		return err
+	}
+
+	var current int
+	err = s.db.QueryRowContext(ctx,
+		"SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&current)
+	if err != nil {
+		return err
+	}
+
+	// Migrations are named NNNN_description.sql
+	dir := "migrations/" + s.dialect.name
+	files, err := fs.ReadDir(migrations, dir)
+	if err != nil {
+		return err
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name() < files[j].Name() })
+
+	for _, file := range files {
+		version, err := strconv.Atoi(strings.SplitN(file.Name(), "_", 2)[0])
+		if err != nil {
+			return fmt.Errorf("bad migration name %s", file.Name())
+		}
+		if version <= current {
+			continue
+		}
+
+		script, err := migrations.ReadFile(dir + "/" + file.Name())
+		if err != nil {
+			return err
+		}
+
+		// Apply each migration atomically
+		err = s.inTx(ctx, func(tx *sql.Tx) error {
+			for _, stmt := range strings.Split(string(script), ";") {
+				if strings.TrimSpace(stmt) == "" {
+					continue
+				}
+				if _, err := tx.ExecContext(ctx, stmt); err != nil {
+					return err
+				}
+			}
+			_, err := tx.ExecContext(ctx, s.q("INSERT INTO schema_migrations (version) VALUES (?)"), version)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("migration %s: %v", file.Name(), err)
+		}
+	}
+	return nil
+}
+
+// inTx : run fn in a transaction, committing if it returns nil
+func (s *SQL) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	err = fn(tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// q : rewrite ? placeholders for the dialect
+func (s *SQL) q(query string) string {
+	if !s.dialect.numbered {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// sqlErr : translate driver errors to store errors
+func sqlErr(err error) error {
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	return err
+}
+
+// toJSON : encode a value for a JSON column
+func toJSON(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+const formColumns = "id, name, creator, timestamp, pages, require_login, collect_email, " +
+	"single_response, is_closed, close_on, version, status, draft, open_on, response_limit, waitlist, allow_edit, " +
+	"allow_withdraw, keep_withdrawn, suspended"
+
+// scanForm : read a row selected with formColumns
+func scanForm(row rowScanner) (*models.Form, error) {
+	form := &models.Form{}
+	var pages string
+	var draft sql.NullString
+	err := row.Scan(&form.ID, &form.Name, &form.Creator, &form.Timestamp, &pages,
+		&form.RequireLogin, &form.CollectEmail, &form.SingleResponse, &form.IsClosed,
+		&form.CloseOn, &form.Version, &form.Status, &draft, &form.OpenOn, &form.ResponseLimit, &form.Waitlist,
+		&form.AllowEdit, &form.AllowWithdraw, &form.KeepWithdrawn, &form.Suspended)
+	if err != nil {
+		return nil, sqlErr(err)
+	}
+	err = json.Unmarshal([]byte(pages), &form.Pages)
+	if err != nil {
+		return nil, err
+	}
+	if draft.Valid {
+		form.Draft = &models.Form{}
+		err = json.Unmarshal([]byte(draft.String), form.Draft)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return form, nil
+}
+
+// formValues : column values of a form in the order of formColumns
+func formValues(id string, form *models.Form) ([]interface{}, error) {
+	pages, err := toJSON(form.Pages)
+	if err != nil {
+		return nil, err
+	}
+	var draft interface{}
+	if form.Draft != nil {
+		draft, err = toJSON(form.Draft)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return []interface{}{id, form.Name, form.Creator, form.Timestamp.UTC(), pages,
+		form.RequireLogin, form.CollectEmail, form.SingleResponse, form.IsClosed,
+		form.CloseOn, form.Version, form.Status, draft, form.OpenOn, form.ResponseLimit, form.Waitlist,
+		form.AllowEdit, form.AllowWithdraw, form.KeepWithdrawn, form.Suspended}, nil
+}
+
+// InsertForm : insert a row into forms
+func (s *SQL) InsertForm(ctx context.Context, form *models.Form) (string, error) {
+	id := u.RandomID()
+	values, err := formValues(id, form)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = s.db.ExecContext(ctx, s.q("INSERT INTO forms ("+formColumns+
+		") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"), values...)
+	if err != nil {
+		return "", err
+	}
+	form.ID = id
+	return id, nil
+}
+
+// findForms : select forms with the given conditions and their collaborators
+func (s *SQL) findForms(ctx context.Context, where string, args ...interface{}) ([]*models.Form, error) {
+	rows, err := s.db.QueryContext(ctx, s.q("SELECT "+formColumns+" FROM forms WHERE "+where), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	forms := []*models.Form{}
+	for rows.Next() {
+		form, err := scanForm(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		forms = append(forms, form)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	// Collaborators are selected once the connection is free again
+	err = s.loadCollaborators(ctx, forms)
+	if err != nil {
+		return nil, err
+	}
+	return forms, nil
+}
+
+// findForm : select the one form with the given conditions
+func (s *SQL) findForm(ctx context.Context, where string, args ...interface{}) (*models.Form, error) {
+	forms, err := s.findForms(ctx, where, args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(forms) == 0 {
+		return nil, ErrNotFound
+	}
+	return forms[0], nil
+}
+
+// loadCollaborators : select the collaborators of the forms, sorted by roll number
+func (s *SQL) loadCollaborators(ctx context.Context, forms []*models.Form) error {
+	if len(forms) == 0 {
+		return nil
+	}
+	byID := map[string]*models.Form{}
+	ids := []interface{}{}
+	for _, form := range forms {
+		form.Collaborators = []models.Collaborator{}
+		byID[form.ID] = form
+		ids = append(ids, form.ID)
+	}
+
+	marks := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+	rows, err := s.db.QueryContext(ctx, s.q("SELECT form_id, rno, role FROM collaborators "+
+		"WHERE form_id IN ("+marks+") ORDER BY rno"), ids...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var formid string
+		var c models.Collaborator
+		err := rows.Scan(&formid, &c.RollNumber, &c.Role)
+		if err != nil {
+			return err
+		}
+		byID[formid].Collaborators = append(byID[formid].Collaborators, c)
+	}
+	return rows.Err()
+}
+
+// FindForm : select form by id
+func (s *SQL) FindForm(ctx context.Context, id string) (*models.Form, error) {
+	return s.findForm(ctx, "id = ?", id)
+}
+
+// FindFormsByCreator : select forms by creator, newest first
+func (s *SQL) FindFormsByCreator(ctx context.Context, creator string) ([]*models.Form, error) {
+	return s.findForms(ctx, "creator = ? ORDER BY timestamp DESC", creator)
+}
+
+// SearchForms : select the forms matching the query, newest first
+func (s *SQL) SearchForms(ctx context.Context, query string, limit int) ([]*models.Form, error) {
+	if query == "" {
+		return s.findForms(ctx, "1 = 1 ORDER BY timestamp DESC LIMIT ?", limit)
+	}
+
+	// Wildcards in the query match themselves
+	pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(strings.ToLower(query)) + "%"
+	return s.findForms(ctx, `id = ? OR creator = ? OR LOWER(name) LIKE ? ESCAPE '\' ORDER BY timestamp DESC LIMIT ?`,
+		query, query, pattern, limit)
+}
+
+// ReplaceForm : update all columns of the form matching id, creator and version
+func (s *SQL) ReplaceForm(ctx context.Context, id string, creator string, version int, form *models.Form) error {
+	replacement := *form
+	replacement.Version = version + 1
+	values, err := formValues(id, &replacement)
+	if err != nil {
+		return err
+	}
+
+	res, err := s.db.ExecContext(ctx, s.q("UPDATE forms SET name = ?, creator = ?, timestamp = ?, "+
+		"pages = ?, require_login = ?, collect_email = ?, single_response = ?, is_closed = ?, "+
+		"close_on = ?, version = ?, status = ?, draft = ?, open_on = ?, response_limit = ?, waitlist = ?, "+
+		"allow_edit = ?, allow_withdraw = ?, keep_withdrawn = ?, suspended = ? WHERE id = ? AND creator = ? AND version = ?"),
+		append(values[1:], id, creator, version)...)
+	if err != nil {
+		return err
+	}
+
+	// Tell apart a missing form from a stale version
+	if n, _ := res.RowsAffected(); n == 0 {
+		old, err := s.FindForm(ctx, id)
+		if err != nil || old.Creator != creator {
+			return ErrNotFound
+		}
+		return ErrConflict
+	}
+	form.ID = id
+	form.Version = replacement.Version
+	return nil
+}
+
+// DeleteForm : delete form by id with its collaborators, share links and transfer
+func (s *SQL) DeleteForm(ctx context.Context, id string) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		for _, table := range []string{"collaborators", "share_links", "transfers"} {
+			_, err := tx.ExecContext(ctx, s.q("DELETE FROM "+table+" WHERE form_id = ?"), id)
+			if err != nil {
+				return err
+			}
+		}
+		_, err := tx.ExecContext(ctx, s.q("DELETE FROM forms WHERE id = ?"), id)
+		return err
+	})
+}
+
+const transferColumns = "form_id, name, from_rno, to_rno, offered, keep_role"
+
+// scanTransfer : read a row selected with transferColumns
+func scanTransfer(row rowScanner) (*models.Transfer, error) {
+	transfer := &models.Transfer{}
+	err := row.Scan(&transfer.FormID, &transfer.Name, &transfer.From, &transfer.To, &transfer.Offered,
+		&transfer.KeepRole)
+	if err != nil {
+		return nil, sqlErr(err)
+	}
+	return transfer, nil
+}
+
+// SetTransfer : insert the transfer, or replace the one pending for the form
+func (s *SQL) SetTransfer(ctx context.Context, transfer *models.Transfer) error {
+	_, err := s.db.ExecContext(ctx, s.q("INSERT INTO transfers ("+transferColumns+") VALUES (?, ?, ?, ?, ?, ?) "+
+		"ON CONFLICT (form_id) DO UPDATE SET name = excluded.name, from_rno = excluded.from_rno, "+
+		"to_rno = excluded.to_rno, offered = excluded.offered, keep_role = excluded.keep_role"),
+		transfer.FormID, transfer.Name, transfer.From, transfer.To, transfer.Offered.UTC(), transfer.KeepRole)
+	return err
+}
+
+// FindTransfer : select the transfer pending for the form
+func (s *SQL) FindTransfer(ctx context.Context, formid string) (*models.Transfer, error) {
+	return scanTransfer(s.db.QueryRowContext(ctx,
+		s.q("SELECT "+transferColumns+" FROM transfers WHERE form_id = ?"), formid))
+}
+
+// FindTransfersTo : select the transfers pending for the user, newest first
+func (s *SQL) FindTransfersTo(ctx context.Context, rno string) ([]*models.Transfer, error) {
+	rows, err := s.db.QueryContext(ctx,
+		s.q("SELECT "+transferColumns+" FROM transfers WHERE to_rno = ? ORDER BY offered DESC"), rno)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transfers := []*models.Transfer{}
+	for rows.Next() {
+		transfer, err := scanTransfer(rows)
+		if err != nil {
+			return nil, err
+		}
+		transfers = append(transfers, transfer)
+	}
+	return transfers, rows.Err()
+}
+
+// DeleteTransfer : delete the transfer pending for the form
+func (s *SQL) DeleteTransfer(ctx context.Context, formid string) error {
+	res, err := s.db.ExecContext(ctx, s.q("DELETE FROM transfers WHERE form_id = ?"), formid)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+const shareLinkColumns = "id, form_id, name, scopes, created, created_by, expires, last_used, revoked, token_hash"
+
+// scanShareLink : read a row selected with shareLinkColumns
+func scanShareLink(row rowScanner) (*models.ShareLink, error) {
+	link := &models.ShareLink{}
+	var scopes string
+	err := row.Scan(&link.ID, &link.FormID, &link.Name, &scopes, &link.Created, &link.CreatedBy, &link.Expires,
+		&link.LastUsed, &link.Revoked, &link.TokenHash)
+	if err != nil {
+		return nil, sqlErr(err)
+	}
+	err = json.Unmarshal([]byte(scopes), &link.Scopes)
+	if err != nil {
+		return nil, err
+	}
+	return link, nil
+}
+
+// InsertShareLink : insert a row into share_links
+func (s *SQL) InsertShareLink(ctx context.Context, link *models.ShareLink) (string, error) {
+	scopes, err := toJSON(link.Scopes)
+	if err != nil {
+		return "", err
+	}
+	id := u.RandomID()
+	_, err = s.db.ExecContext(ctx, s.q("INSERT INTO share_links ("+shareLinkColumns+
+		") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"), id, link.FormID, link.Name, scopes, link.Created.UTC(),
+		link.CreatedBy, link.Expires, link.LastUsed, link.Revoked, link.TokenHash)
+	if err != nil {
+		return "", err
+	}
+	link.ID = id
+	return id, nil
+}
+
+// FindShareLinks : select the share links of the form, newest first
+func (s *SQL) FindShareLinks(ctx context.Context, formid string) ([]*models.ShareLink, error) {
+	rows, err := s.db.QueryContext(ctx,
+		s.q("SELECT "+shareLinkColumns+" FROM share_links WHERE form_id = ? ORDER BY created DESC"), formid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := []*models.ShareLink{}
+	for rows.Next() {
+		link, err := scanShareLink(rows)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
+
+// FindShareLinkByHash : select the share link with the token hash
+func (s *SQL) FindShareLinkByHash(ctx context.Context, hash string) (*models.ShareLink, error) {
+	return scanShareLink(s.db.QueryRowContext(ctx,
+		s.q("SELECT "+shareLinkColumns+" FROM share_links WHERE token_hash = ?"), hash))
+}
+
+// RevokeShareLink : set the revocation time of the share link of the form
+func (s *SQL) RevokeShareLink(ctx context.Context, formid string, id string, at time.Time) error {
+	res, err := s.db.ExecContext(ctx, s.q("UPDATE share_links SET revoked = ? "+
+		"WHERE id = ? AND form_id = ? AND revoked IS NULL"), at.UTC(), id, formid)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// TouchShareLink : set the last use time of the share link
+func (s *SQL) TouchShareLink(ctx context.Context, id string, at time.Time) error {
+	res, err := s.db.ExecContext(ctx, s.q("UPDATE share_links SET last_used = ? WHERE id = ?"), at.UTC(), id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// SetCollaborator : insert the collaborator, or update their role
+func (s *SQL) SetCollaborator(ctx context.Context, formid string, collaborator *models.Collaborator) error {
+	_, err := s.db.ExecContext(ctx, s.q("INSERT INTO collaborators (form_id, rno, role) VALUES (?, ?, ?) "+
+		"ON CONFLICT (form_id, rno) DO UPDATE SET role = excluded.role"),
+		formid, collaborator.RollNumber, collaborator.Role)
+	return err
+}
+
+// DeleteCollaborator : delete the collaborator of the form
+func (s *SQL) DeleteCollaborator(ctx context.Context, formid string, rno string) error {
+	res, err := s.db.ExecContext(ctx, s.q("DELETE FROM collaborators WHERE form_id = ? AND rno = ?"), formid, rno)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// FindSharedForms : select the forms shared with the user, newest first
+func (s *SQL) FindSharedForms(ctx context.Context, rno string) ([]*models.Form, error) {
+	return s.findForms(ctx, "id IN (SELECT form_id FROM collaborators WHERE rno = ?) ORDER BY timestamp DESC", rno)
+}
+
+// execer : common interface of sql.DB and sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+const responseColumns = "id, form_id, timestamp, filler, responses, version, status, counters, owner, edits"
+
+// scanResponse : read a row selected with responseColumns
+func scanResponse(row rowScanner) (*models.FormResponse, error) {
+	response := &models.FormResponse{}
+	var answers, counters, edits string
+	err := row.Scan(&response.ID, &response.FormID, &response.Timestamp, &response.Filler, &answers,
+		&response.Version, &response.Status, &counters, &response.Owner, &edits)
+	if err != nil {
+		return nil, sqlErr(err)
+	}
+	err = json.Unmarshal([]byte(answers), &response.Responses)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal([]byte(counters), &response.Counters)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal([]byte(edits), &response.Edits)
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// InsertResponse : insert a row into responses
+func (s *SQL) InsertResponse(ctx context.Context, response *models.FormResponse) (string, error) {
+	return s.insertResponse(ctx, s.db, response)
+}
+
+// insertResponse : insert a row into responses with the given connection
+func (s *SQL) insertResponse(ctx context.Context, db execer, response *models.FormResponse) (string, error) {
+	answers, err := toJSON(response.Responses)
+	if err != nil {
+		return "", err
+	}
+	counters := "[]"
+	if len(response.Counters) > 0 {
+		counters, err = toJSON(response.Counters)
+		if err != nil {
+			return "", err
+		}
+	}
+	edits := "[]"
+	if len(response.Edits) > 0 {
+		edits, err = toJSON(response.Edits)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	id := u.RandomID()
+	_, err = db.ExecContext(ctx, s.q("INSERT INTO responses ("+responseColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"),
+		id, response.FormID, response.Timestamp.UTC(), response.Filler, answers, response.Version,
+		response.Status, counters, response.Owner, edits)
+	if err != nil {
+		return "", err
+	}
+	response.ID = id
+	return id, nil
+}
+
+// count : increment counters within their quotas in the transaction
+func (s *SQL) count(ctx context.Context, tx *sql.Tx, formid string, quotas []Quota) error {
+	for _, q := range quotas {
+		_, err := tx.ExecContext(ctx, s.q("INSERT INTO counts (form_id, name, count) VALUES (?, ?, 0) "+
+			"ON CONFLICT (form_id, name) DO NOTHING"), formid, q.Key)
+		if err != nil {
+			return err
+		}
+
+		// The row lock held until commit keeps concurrent increments in order
+		res, err := tx.ExecContext(ctx, s.q("UPDATE counts SET count = count + 1 "+
+			"WHERE form_id = ? AND name = ? AND (? = 0 OR count < ?)"), formid, q.Key, q.Max, q.Max)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return &QuotaError{Key: q.Key}
+		}
+	}
+	return nil
+}
+
+// release : decrement counters in the transaction
+func (s *SQL) release(ctx context.Context, tx *sql.Tx, formid string, keys []string) error {
+	for _, key := range keys {
+		_, err := tx.ExecContext(ctx, s.q("UPDATE counts SET count = count - 1 "+
+			"WHERE form_id = ? AND name = ? AND count > 0"), formid, key)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InsertCountedResponse : insert the fillers, increment counters and insert
+// the response in a transaction
+func (s *SQL) InsertCountedResponse(ctx context.Context, response *models.FormResponse, quotas []Quota,
+	fillers []*models.FormAnonResponder) (string, error) {
+	var id string
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		// The unique index on fillers lets one of concurrent inserts through
+		for _, filler := range fillers {
+			res, err := tx.ExecContext(ctx, s.q("INSERT INTO fillers (form_id, filler) VALUES (?, ?) "+
+				"ON CONFLICT DO NOTHING"), filler.FormID, filler.Filler)
+			if err != nil {
+				return err
+			}
+			if n, _ := res.RowsAffected(); n == 0 {
+				return ErrDuplicate
+			}
+		}
+
+		err := s.count(ctx, tx, response.FormID, quotas)
+		if err != nil {
+			return err
+		}
+		response.Counters = quotaKeys(quotas)
+		id, err = s.insertResponse(ctx, tx, response)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// FindCounts : select counters by form id
+func (s *SQL) FindCounts(ctx context.Context, formid string) (map[string]int, error) {
+	rows, err := s.db.QueryContext(ctx, s.q("SELECT name, count FROM counts WHERE form_id = ?"), formid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[string]int{}
+	for rows.Next() {
+		var key string
+		var n int
+		if err := rows.Scan(&key, &n); err != nil {
+			return nil, err
+		}
+		counts[key] = n
+	}
+	return counts, rows.Err()
+}
+
+// SetCounts : replace the counters by form id, and those of responses stored
+// without them, in a transaction
+func (s *SQL) SetCounts(ctx context.Context, formid string, counts map[string]int,
+	counters map[string][]string) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, s.q("DELETE FROM counts WHERE form_id = ?"), formid)
+		if err != nil {
+			return err
+		}
+		for key, n := range counts {
+			_, err := tx.ExecContext(ctx, s.q("INSERT INTO counts (form_id, name, count) VALUES (?, ?, ?)"),
+				formid, key, n)
+			if err != nil {
+				return err
+			}
+		}
+		for id, keys := range counters {
+			value, err := toJSON(keys)
+			if err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, s.q("UPDATE responses SET counters = ? "+
+				"WHERE form_id = ? AND id = ? AND counters = ?"), value, formid, id, "[]")
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// FindResponses : select responses by form id, oldest first
+func (s *SQL) FindResponses(ctx context.Context, formid string) ([]*models.FormResponse, error) {
+	rows, err := s.db.QueryContext(ctx, s.q("SELECT "+responseColumns+
+		" FROM responses WHERE form_id = ? ORDER BY timestamp"), formid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	responses := []*models.FormResponse{}
+	for rows.Next() {
+		response, err := scanResponse(rows)
+		if err != nil {
+			return nil, err
+		}
+		responses = append(responses, response)
+	}
+	return responses, rows.Err()
+}
+
+// FindResponse : select a response by form id and id
+func (s *SQL) FindResponse(ctx context.Context, formid string, id string) (*models.FormResponse, error) {
+	return scanResponse(s.db.QueryRowContext(ctx, s.q("SELECT "+responseColumns+
+		" FROM responses WHERE form_id = ? AND id = ?"), formid, id))
+}
+
+// ReplaceResponse : update the response, add an edit and move it between
+// counters in a transaction
+func (s *SQL) ReplaceResponse(ctx context.Context, response *models.FormResponse, quotas []Quota,
+	editedBy string) error {
+	answers, err := toJSON(response.Responses)
+	if err != nil {
+		return err
+	}
+
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		// Locks the row so that concurrent changes are made one after another
+		res, err := tx.ExecContext(ctx, s.q("UPDATE responses SET version = version "+
+			"WHERE form_id = ? AND id = ?"), response.FormID, response.ID)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrNotFound
+		}
+		stored, err := scanResponse(tx.QueryRowContext(ctx, s.q("SELECT "+responseColumns+
+			" FROM responses WHERE form_id = ? AND id = ?"), response.FormID, response.ID))
+		if err != nil {
+			return err
+		}
+		if stored.Status == models.ResponseWithdrawn {
+			return ErrNotFound
+		}
+
+		if stored.Status != models.ResponseWaitlisted {
+			added, removed := moveQuotas(stored.Counters, quotas)
+			if err := s.count(ctx, tx, stored.FormID, added); err != nil {
+				return err
+			}
+			if err := s.release(ctx, tx, stored.FormID, removed); err != nil {
+				return err
+			}
+			stored.Counters = quotaKeys(quotas)
+		}
+		stored.Edits = append(stored.Edits, models.ResponseEdit{Edited: time.Now().UTC(), EditedBy: editedBy,
+			Version: stored.Version, Responses: stored.Responses})
+
+		counters, err := toJSON(stored.Counters)
+		if err != nil {
+			return err
+		}
+		edits, err := toJSON(stored.Edits)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, s.q("UPDATE responses SET responses = ?, version = ?, counters = ?, edits = ? "+
+			"WHERE form_id = ? AND id = ?"), answers, response.Version, counters, edits, stored.FormID, stored.ID)
+		if err != nil {
+			return err
+		}
+
+		response.Status = stored.Status
+		response.Counters = stored.Counters
+		response.Edits = stored.Edits
+		return nil
+	})
+}
+
+// FindOwnResponse : select the latest response by form id and owner
+func (s *SQL) FindOwnResponse(ctx context.Context, formid string, owner string) (*models.FormResponse, error) {
+	if owner == "" {
+		return nil, ErrNotFound
+	}
+	return scanResponse(s.db.QueryRowContext(ctx, s.q("SELECT "+responseColumns+
+		" FROM responses WHERE form_id = ? AND owner = ? ORDER BY timestamp DESC LIMIT 1"), formid, owner))
+}
+
+// WithdrawResponse : clear the response and release its counters in a transaction
+func (s *SQL) WithdrawResponse(ctx context.Context, formid string, id string) (*models.FormResponse, error) {
+	var response *models.FormResponse
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		// Locks the row so that only one of concurrent withdrawals goes through
+		res, err := tx.ExecContext(ctx, s.q("UPDATE responses SET status = status "+
+			"WHERE form_id = ? AND id = ? AND status <> ?"), formid, id, models.ResponseWithdrawn)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrNotFound
+		}
+		response, err = scanResponse(tx.QueryRowContext(ctx, s.q("SELECT "+responseColumns+
+			" FROM responses WHERE form_id = ? AND id = ?"), formid, id))
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, s.q("UPDATE responses SET status = ?, responses = '{}', "+
+			"counters = '[]', edits = '[]' WHERE form_id = ? AND id = ?"), models.ResponseWithdrawn, formid, id)
+		if err != nil {
+			return err
+		}
+		return s.release(ctx, tx, formid, response.Counters)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// DeleteResponse : delete the response and release its counters in a transaction
+func (s *SQL) DeleteResponse(ctx context.Context, formid string, id string) (*models.FormResponse, error) {
+	var response *models.FormResponse
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		response, err = scanResponse(tx.QueryRowContext(ctx, s.q("SELECT "+responseColumns+
+			" FROM responses WHERE form_id = ? AND id = ?"), formid, id))
+		if err != nil {
+			return err
+		}
+
+		// Only one of concurrent deletes removes the row
+		res, err := tx.ExecContext(ctx, s.q("DELETE FROM responses WHERE form_id = ? AND id = ?"), formid, id)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrNotFound
+		}
+		return s.release(ctx, tx, formid, response.Counters)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// PromoteResponse : accept a waitlisted response and increment counters in a transaction
+func (s *SQL) PromoteResponse(ctx context.Context, formid string, id string, quotas []Quota) error {
+	counters, err := toJSON(quotaKeys(quotas))
+	if err != nil {
+		return err
+	}
+
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		// Locks the row so that it is promoted once
+		res, err := tx.ExecContext(ctx, s.q("UPDATE responses SET status = ?, counters = ? "+
+			"WHERE form_id = ? AND id = ? AND status = ?"),
+			models.ResponseAccepted, counters, formid, id, models.ResponseWaitlisted)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrConflict
+		}
+		return s.count(ctx, tx, formid, quotas)
+	})
+}
+
+// DeleteResponses : delete responses and counters by form id
+func (s *SQL) DeleteResponses(ctx context.Context, formid string) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, s.q("DELETE FROM responses WHERE form_id = ?"), formid)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, s.q("DELETE FROM counts WHERE form_id = ?"), formid)
+		return err
+	})
+}
+
+// InsertFiller : insert a row into fillers unless already present
+func (s *SQL) InsertFiller(ctx context.Context, filler *models.FormAnonResponder) error {
+	_, err := s.db.ExecContext(ctx, s.q("INSERT INTO fillers (form_id, filler) VALUES (?, ?) "+
+		"ON CONFLICT DO NOTHING"), filler.FormID, filler.Filler)
+	return err
+}
+
+// DeleteFillers : delete rows of fillers in a transaction
+func (s *SQL) DeleteFillers(ctx context.Context, fillers []*models.FormAnonResponder) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		for _, filler := range fillers {
+			_, err := tx.ExecContext(ctx, s.q("DELETE FROM fillers WHERE form_id = ? AND filler = ?"),
+				filler.FormID, filler.Filler)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// HasFilled : check fillers for form id and filler
+func (s *SQL) HasFilled(ctx context.Context, formid string, filler string) (bool, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, s.q("SELECT COUNT(*) FROM fillers WHERE form_id = ? AND filler = ?"),
+		formid, filler).Scan(&n)
+	return n > 0, err
+}
+
+// InsertRevision : insert a row into revisions
+func (s *SQL) InsertRevision(ctx context.Context, revision *models.Revision) error {
+	form, err := toJSON(&revision.Form)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, s.q("INSERT INTO revisions (form_id, version, replaced, replaced_by, form) "+
+		"VALUES (?, ?, ?, ?, ?)"), revision.FormID, revision.Version, revision.Replaced.UTC(), revision.ReplacedBy, form)
+	return err
+}
+
+// scanRevision : read a row of revisions
+func scanRevision(row rowScanner) (*models.Revision, error) {
+	revision := &models.Revision{}
+	var form string
+	err := row.Scan(&revision.FormID, &revision.Version, &revision.Replaced, &revision.ReplacedBy, &form)
+	if err != nil {
+		return nil, sqlErr(err)
+	}
+	err = json.Unmarshal([]byte(form), &revision.Form)
+	if err != nil {
+		return nil, err
+	}
+	return revision, nil
+}
+
+// FindRevisions : select revisions by form id ordered by version
+func (s *SQL) FindRevisions(ctx context.Context, formid string) ([]*models.Revision, error) {
+	rows, err := s.db.QueryContext(ctx, s.q("SELECT form_id, version, replaced, replaced_by, form "+
+		"FROM revisions WHERE form_id = ? ORDER BY version"), formid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []*models.Revision{}
+	for rows.Next() {
+		revision, err := scanRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+	return revisions, rows.Err()
+}
+
+// FindRevision : select revision by form id and version
+func (s *SQL) FindRevision(ctx context.Context, formid string, version int) (*models.Revision, error) {
+	return scanRevision(s.db.QueryRowContext(ctx, s.q("SELECT form_id, version, replaced, replaced_by, form "+
+		"FROM revisions WHERE form_id = ? AND version = ?"), formid, version))
+}
+
+// DeleteRevisions : delete revisions by form id
+func (s *SQL) DeleteRevisions(ctx context.Context, formid string) error {
+	_, err := s.db.ExecContext(ctx, s.q("DELETE FROM revisions WHERE form_id = ?"), formid)
+	return err
+}
+
+// InsertAudit : insert a row into audit
+func (s *SQL) InsertAudit(ctx context.Context, entry *models.AuditEntry) error {
+	details := "{}"
+	if len(entry.Details) > 0 {
+		var err error
+		details, err = toJSON(entry.Details)
+		if err != nil {
+			return err
+		}
+	}
+	_, err := s.db.ExecContext(ctx, s.q("INSERT INTO audit (form_id, time, actor, action, target, details) "+
+		"VALUES (?, ?, ?, ?, ?, ?)"), entry.FormID, entry.Time.UTC(), entry.Actor, entry.Action, entry.Target, details)
+	return err
+}
+
+// FindAudit : select audit entries by form id, oldest first
+func (s *SQL) FindAudit(ctx context.Context, formid string) ([]*models.AuditEntry, error) {
+	rows, err := s.db.QueryContext(ctx, s.q("SELECT form_id, time, actor, action, target, details "+
+		"FROM audit WHERE form_id = ? ORDER BY time"), formid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []*models.AuditEntry{}
+	for rows.Next() {
+		entry := &models.AuditEntry{}
+		var details string
+		err := rows.Scan(&entry.FormID, &entry.Time, &entry.Actor, &entry.Action, &entry.Target, &details)
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal([]byte(details), &entry.Details)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// FindUser : select profile by roll number
+func (s *SQL) FindUser(ctx context.Context, rno string) (*models.Profile, error) {
+	user := &models.Profile{}
+	err := s.db.QueryRowContext(ctx, s.q("SELECT id, first_name, last_name, roll_number, "+
+		"profile_picture, email, admin FROM users WHERE roll_number = ?"), rno).Scan(
+		&user.ID, &user.FirstName, &user.LastName, &user.RollNumber, &user.ProfilePicture, &user.Email, &user.Admin)
+	if err != nil {
+		return nil, sqlErr(err)
+	}
+	return user, nil
+}
+
+// UpsertUser : insert or update profile by roll number
+func (s *SQL) UpsertUser(ctx context.Context, profile *models.Profile) error {
+	// Administrators are only made with SetAdmin
+	_, err := s.db.ExecContext(ctx, s.q("INSERT INTO users (id, first_name, last_name, roll_number, "+
+		"profile_picture, email) VALUES (?, ?, ?, ?, ?, ?) ON CONFLICT (roll_number) DO UPDATE SET "+
+		"id = excluded.id, first_name = excluded.first_name, last_name = excluded.last_name, "+
+		"profile_picture = excluded.profile_picture, email = excluded.email"),
+		profile.ID, profile.FirstName, profile.LastName, profile.RollNumber, profile.ProfilePicture, profile.Email)
+	return err
+}
+
+// SetAdmin : update whether the user is an administrator
+func (s *SQL) SetAdmin(ctx context.Context, rno string, admin bool) error {
+	res, err := s.db.ExecContext(ctx, s.q("UPDATE users SET admin = ? WHERE roll_number = ?"), admin, rno)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
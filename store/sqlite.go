@@ -0,0 +1,14 @@
+package store
+
+import (
+	"context"
+
+	// SQLite driver
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// NewSQLite : open or create an SQLite database file and apply migrations
+func NewSQLite(ctx context.Context, path string) (*SQL, error) {
+	// SQLite allows a single writer, so all access goes over one connection
+	return openSQL(ctx, "sqlite3", path+"?_busy_timeout=5000", dialect{name: "sqlite", maxConns: 1})
+}
@@ -0,0 +1,272 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pulsejet/go-cerium/models"
+)
+
+// ErrNotFound : returned when no document matches the lookup
+var ErrNotFound = errors.New("not found")
+
+// ErrConflict : returned when a document was changed since it was read
+var ErrConflict = errors.New("conflict")
+
+// ErrDuplicate : returned when a filler has already filled a single-response form
+var ErrDuplicate = errors.New("duplicate")
+
+// Quota : a counter of responses to a form, limited to Max unless Max is zero
+type Quota struct {
+	Key string
+	Max int
+}
+
+// QuotaError : returned when a response would take a counter past its quota
+type QuotaError struct {
+	Key string
+}
+
+func (e *QuotaError) Error() string {
+	return "quota reached for " + e.Key
+}
+
+// quotaKeys : the keys of the counters of quotas
+func quotaKeys(quotas []Quota) []string {
+	keys := make([]string, len(quotas))
+	for i, q := range quotas {
+		keys[i] = q.Key
+	}
+	return keys
+}
+
+// moveQuotas : the quotas of counters that a response counted in keys is
+// added to, and the keys of the counters it is removed from
+func moveQuotas(keys []string, quotas []Quota) ([]Quota, []string) {
+	old := map[string]bool{}
+	for _, key := range keys {
+		old[key] = true
+	}
+	added := []Quota{}
+	for _, q := range quotas {
+		if !old[q.Key] {
+			added = append(added, q)
+		}
+		delete(old, q.Key)
+	}
+	removed := []string{}
+	for _, key := range keys {
+		if old[key] {
+			removed = append(removed, key)
+		}
+	}
+	return added, removed
+}
+
+// FormStore : persistence for forms, which are found with their collaborators
+type FormStore interface {
+	// InsertForm stores a new form and returns its id
+	InsertForm(ctx context.Context, form *models.Form) (string, error)
+
+	// FindForm gets the form with the given id
+	FindForm(ctx context.Context, id string) (*models.Form, error)
+
+	// FindFormsByCreator gets all forms of a creator, newest first
+	FindFormsByCreator(ctx context.Context, creator string) ([]*models.Form, error)
+
+	// SearchForms gets at most limit forms, newest first, whose id or creator
+	// is the query or whose name contains it ignoring case. An empty query
+	// matches all forms
+	SearchForms(ctx context.Context, query string, limit int) ([]*models.Form, error)
+
+	// ReplaceForm overwrites the form with the given id and creator if it is
+	// still at the given version, and bumps the version of the form
+	ReplaceForm(ctx context.Context, id string, creator string, version int, form *models.Form) error
+
+	// DeleteForm removes the form with the given id, its collaborators,
+	// share links and any transfer of it
+	DeleteForm(ctx context.Context, id string) error
+}
+
+// CollaboratorStore : persistence for the users a form is shared with, which
+// are kept apart from the form so that sharing does not change its version
+type CollaboratorStore interface {
+	// SetCollaborator adds a collaborator to a form or changes their role
+	SetCollaborator(ctx context.Context, formid string, collaborator *models.Collaborator) error
+
+	// DeleteCollaborator removes a collaborator from a form, returning
+	// ErrNotFound if they are not one
+	DeleteCollaborator(ctx context.Context, formid string, rno string) error
+
+	// FindSharedForms gets the forms shared with a user, newest first
+	FindSharedForms(ctx context.Context, rno string) ([]*models.Form, error)
+}
+
+// TransferStore : persistence for the pending transfers of forms to new creators
+type TransferStore interface {
+	// SetTransfer stores the transfer, replacing any pending transfer of the form
+	SetTransfer(ctx context.Context, transfer *models.Transfer) error
+
+	// FindTransfer gets the pending transfer of a form
+	FindTransfer(ctx context.Context, formid string) (*models.Transfer, error)
+
+	// FindTransfersTo gets the transfers pending for a user, newest first
+	FindTransfersTo(ctx context.Context, rno string) ([]*models.Transfer, error)
+
+	// DeleteTransfer removes the pending transfer of a form, returning
+	// ErrNotFound if there is none
+	DeleteTransfer(ctx context.Context, formid string) error
+}
+
+// ShareLinkStore : persistence for the links that share the results of forms
+type ShareLinkStore interface {
+	// InsertShareLink stores a new share link and returns its id
+	InsertShareLink(ctx context.Context, link *models.ShareLink) (string, error)
+
+	// FindShareLinks gets all share links of a form, revoked ones included, newest first
+	FindShareLinks(ctx context.Context, formid string) ([]*models.ShareLink, error)
+
+	// FindShareLinkByHash gets the share link with the given token hash
+	FindShareLinkByHash(ctx context.Context, hash string) (*models.ShareLink, error)
+
+	// RevokeShareLink marks a share link of a form revoked at the given time,
+	// returning ErrNotFound if it is missing or already revoked
+	RevokeShareLink(ctx context.Context, formid string, id string, at time.Time) error
+
+	// TouchShareLink notes that a share link was used at the given time
+	TouchShareLink(ctx context.Context, id string, at time.Time) error
+}
+
+// ResponseStore : persistence for responses to forms
+type ResponseStore interface {
+	// InsertResponse stores a new response and returns its id
+	InsertResponse(ctx context.Context, response *models.FormResponse) (string, error)
+
+	// InsertCountedResponse stores a new response and increments the counters
+	// of its quotas as one operation, or returns a *QuotaError and stores
+	// nothing if any counter is already at its quota. The fillers are recorded
+	// in the same operation, returning ErrDuplicate and storing nothing if any
+	// of them has already filled the form
+	InsertCountedResponse(ctx context.Context, response *models.FormResponse, quotas []Quota,
+		fillers []*models.FormAnonResponder) (string, error)
+
+	// PromoteResponse accepts a waitlisted response and increments the counters
+	// of its quotas as one operation, returning a *QuotaError if any counter is
+	// at its quota and ErrConflict if the response is not waitlisted
+	PromoteResponse(ctx context.Context, formid string, id string, quotas []Quota) error
+
+	// ReplaceResponse overwrites the answers and version of a stored response,
+	// keeping the earlier ones as an edit by editedBy, and moves it to the
+	// counters of the given quotas as one operation, returning a *QuotaError
+	// and changing nothing if a counter it is added to is at its quota, or
+	// ErrConflict if the response was changed meanwhile, or ErrNotFound if it
+	// is missing or withdrawn. Waitlisted responses are in no counters and
+	// stay that way
+	ReplaceResponse(ctx context.Context, response *models.FormResponse, quotas []Quota, editedBy string) error
+
+	// WithdrawResponse replaces a response with a tombstone without answers
+	// or edits and decrements the counters it was counted in, returning the
+	// response as it was, or ErrNotFound if it is missing or already withdrawn
+	WithdrawResponse(ctx context.Context, formid string, id string) (*models.FormResponse, error)
+
+	// DeleteResponse removes a response to a form and decrements the counters
+	// it was counted in, returning the removed response
+	DeleteResponse(ctx context.Context, formid string, id string) (*models.FormResponse, error)
+
+	// FindResponse gets a response to a form by id
+	FindResponse(ctx context.Context, formid string, id string) (*models.FormResponse, error)
+
+	// FindOwnResponse gets the latest response to a form with the given owner
+	FindOwnResponse(ctx context.Context, formid string, owner string) (*models.FormResponse, error)
+
+	// FindResponses gets all responses to a form, oldest first
+	FindResponses(ctx context.Context, formid string) ([]*models.FormResponse, error)
+
+	// FindCounts gets the counters of a form by key
+	FindCounts(ctx context.Context, formid string) (map[string]int, error)
+
+	// SetCounts replaces the counters of a form, and records the counters by
+	// response id of responses that were stored before they were counted
+	SetCounts(ctx context.Context, formid string, counts map[string]int, counters map[string][]string) error
+
+	// DeleteResponses removes all responses to a form and resets its counters
+	DeleteResponses(ctx context.Context, formid string) error
+}
+
+// FillerStore : persistence for the form to filler mapping used for single-response
+type FillerStore interface {
+	// InsertFiller records that the filler has filled the form, if not already recorded
+	InsertFiller(ctx context.Context, filler *models.FormAnonResponder) error
+
+	// HasFilled returns true if the filler has already filled the form
+	HasFilled(ctx context.Context, formid string, filler string) (bool, error)
+
+	// DeleteFillers forgets that the fillers have filled their forms
+	DeleteFillers(ctx context.Context, fillers []*models.FormAnonResponder) error
+}
+
+// UserStore : persistence for user profiles
+type UserStore interface {
+	// FindUser gets the profile with the given roll number
+	FindUser(ctx context.Context, rno string) (*models.Profile, error)
+
+	// UpsertUser creates or replaces the profile with the same roll number,
+	// keeping whether the user is an administrator
+	UpsertUser(ctx context.Context, profile *models.Profile) error
+
+	// SetAdmin makes the user with a profile an administrator, or not
+	SetAdmin(ctx context.Context, rno string, admin bool) error
+}
+
+// HistoryStore : persistence for earlier revisions of forms
+type HistoryStore interface {
+	// InsertRevision stores a snapshot of a form
+	InsertRevision(ctx context.Context, revision *models.Revision) error
+
+	// FindRevisions gets all revisions of a form, oldest first
+	FindRevisions(ctx context.Context, formid string) ([]*models.Revision, error)
+
+	// FindRevision gets the revision of a form at the given version
+	FindRevision(ctx context.Context, formid string, version int) (*models.Revision, error)
+
+	// DeleteRevisions removes all revisions of a form
+	DeleteRevisions(ctx context.Context, formid string) error
+}
+
+// AuditStore : persistence for the audit trail of forms
+type AuditStore interface {
+	// InsertAudit stores an audit entry
+	InsertAudit(ctx context.Context, entry *models.AuditEntry) error
+
+	// FindAudit gets the audit entries of a form, oldest first
+	FindAudit(ctx context.Context, formid string) ([]*models.AuditEntry, error)
+}
+
+// Store : all persistence used by the API
+type Store interface {
+	FormStore
+	CollaboratorStore
+	TransferStore
+	ShareLinkStore
+	ResponseStore
+	FillerStore
+	UserStore
+	HistoryStore
+	AuditStore
+}
+
+// Open : connect to the store for the scheme of the connection string
+func Open(ctx context.Context, connection string, database string) (Store, error) {
+	switch {
+	case strings.HasPrefix(connection, "mongodb://"), strings.HasPrefix(connection, "mongodb+srv://"):
+		return NewMongo(ctx, connection, database)
+	case strings.HasPrefix(connection, "postgres://"), strings.HasPrefix(connection, "postgresql://"):
+		return NewPostgres(ctx, connection)
+	case strings.HasPrefix(connection, "sqlite://"):
+		return NewSQLite(ctx, strings.TrimPrefix(connection, "sqlite://"))
+	}
+	return nil, fmt.Errorf("unsupported connection scheme in %q", connection)
+}
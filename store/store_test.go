@@ -0,0 +1,844 @@
+package store_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pulsejet/go-cerium/models"
+	"github.com/pulsejet/go-cerium/store"
+)
+
+// Tests the in-memory store
+func TestMemory(t *testing.T) {
+	testStore(t, store.NewMemory())
+}
+
+// Tests the SQLite store on a fresh database file
+func TestSQLite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cerium")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := store.NewSQLite(context.Background(), filepath.Join(dir, "cerium.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	testStore(t, s)
+}
+
+// Tests the PostgreSQL store against the empty database in POSTGRES_TEST_URL
+func TestPostgres(t *testing.T) {
+	uri := os.Getenv("POSTGRES_TEST_URL")
+	if uri == "" {
+		t.Skip("POSTGRES_TEST_URL not set")
+	}
+	s, err := store.NewPostgres(context.Background(), uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	testStore(t, s)
+}
+
+// testStore : run the common checks against any store implementation
+func testStore(t *testing.T, s store.Store) {
+	t.Run("Forms", func(t *testing.T) { testForms(t, s) })
+	t.Run("Responses", func(t *testing.T) { testResponses(t, s) })
+	t.Run("Fillers", func(t *testing.T) { testFillers(t, s) })
+	t.Run("Collaborators", func(t *testing.T) { testCollaborators(t, s) })
+	t.Run("Transfers", func(t *testing.T) { testTransfers(t, s) })
+	t.Run("ShareLinks", func(t *testing.T) { testShareLinks(t, s) })
+	t.Run("Users", func(t *testing.T) { testUsers(t, s) })
+	t.Run("Search", func(t *testing.T) { testSearch(t, s) })
+	t.Run("Revisions", func(t *testing.T) { testRevisions(t, s) })
+	t.Run("Quotas", func(t *testing.T) { testQuotas(t, s) })
+	t.Run("SetCounts", func(t *testing.T) { testSetCounts(t, s) })
+	t.Run("Waitlist", func(t *testing.T) { testWaitlist(t, s) })
+	t.Run("Replace", func(t *testing.T) { testReplace(t, s) })
+	t.Run("Withdraw", func(t *testing.T) { testWithdraw(t, s) })
+	t.Run("Audit", func(t *testing.T) { testAudit(t, s) })
+	t.Run("Concurrent", func(t *testing.T) { testConcurrent(t, s) })
+}
+
+func testForms(t *testing.T, s store.Store) {
+	ctx := context.Background()
+
+	// Insert two forms with different timestamps
+	older := dummyForm("Older", "creator")
+	older.Timestamp = time.Now().Add(-time.Hour)
+	newer := dummyForm("Newer", "creator")
+	newer.Timestamp = time.Now()
+	newer.OpenOn = models.At(time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC))
+	olderID, err := s.InsertForm(ctx, older)
+	checkError(err, t)
+	newerID, err := s.InsertForm(ctx, newer)
+	checkError(err, t)
+	if olderID == "" || olderID == newerID {
+		t.Fatalf("Bad form ids %q and %q", olderID, newerID)
+	}
+
+	// Find by id
+	form, err := s.FindForm(ctx, olderID)
+	checkError(err, t)
+	if form.ID != olderID || form.Name != "Older" || form.Pages[0].Widgets[0].Props["question"] != "Question" {
+		t.Errorf("Form differs from inserted: %+v", form)
+	}
+
+	// Schedules are kept and may be unset
+	if form.OpenOn.Valid || form.CloseOn.Valid {
+		t.Errorf("Unset schedule loaded as %+v %+v", form.OpenOn, form.CloseOn)
+	}
+	form, err = s.FindForm(ctx, newerID)
+	checkError(err, t)
+	if !form.OpenOn.Equal(newer.OpenOn) {
+		t.Errorf("Schedule differs from inserted: %+v", form.OpenOn)
+	}
+	form, _ = s.FindForm(ctx, olderID)
+
+	// Unknown ids are not found
+	if _, err := s.FindForm(ctx, "000000000000000000000000"); err != store.ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	// List by creator, newest first
+	forms, err := s.FindFormsByCreator(ctx, "creator")
+	checkError(err, t)
+	if len(forms) != 2 || forms[0].ID != newerID || forms[1].ID != olderID {
+		t.Errorf("Unexpected forms by creator: %+v", forms)
+	}
+
+	// Replace only matches the creator
+	form.Name = "Replaced"
+	if err := s.ReplaceForm(ctx, olderID, "intruder", 0, form); err != store.ErrNotFound {
+		t.Errorf("Expected ErrNotFound for wrong creator, got %v", err)
+	}
+	checkError(s.ReplaceForm(ctx, olderID, "creator", 0, form), t)
+	form, err = s.FindForm(ctx, olderID)
+	checkError(err, t)
+	if form.Name != "Replaced" || form.Version != 1 {
+		t.Errorf("Form not replaced: %+v", form)
+	}
+
+	// Replace only matches the latest version
+	if err := s.ReplaceForm(ctx, olderID, "creator", 0, form); err != store.ErrConflict {
+		t.Errorf("Expected ErrConflict for stale version, got %v", err)
+	}
+	checkError(s.ReplaceForm(ctx, olderID, "creator", 1, form), t)
+	if form.Version != 2 {
+		t.Errorf("Version not bumped: %d", form.Version)
+	}
+
+	// Drafts are kept alongside the published form
+	form.Status = models.StatusPublished
+	form.Draft = dummyForm("Draft", "")
+	checkError(s.ReplaceForm(ctx, olderID, "creator", 2, form), t)
+	form, err = s.FindForm(ctx, olderID)
+	checkError(err, t)
+	if form.Status != models.StatusPublished || form.Draft == nil || form.Draft.Pages[0].Title != "Draft" {
+		t.Errorf("Draft not stored: %+v", form)
+	}
+
+	// Delete
+	checkError(s.DeleteForm(ctx, olderID), t)
+	if _, err := s.FindForm(ctx, olderID); err != store.ErrNotFound {
+		t.Errorf("Expected ErrNotFound after delete, got %v", err)
+	}
+}
+
+func testResponses(t *testing.T, s store.Store) {
+	ctx := context.Background()
+
+	for _, formid := range []string{"form1", "form1", "form2"} {
+		response := &models.FormResponse{
+			FormID:    formid,
+			Timestamp: time.Now(),
+			Responses: map[string]interface{}{"q": "a"},
+			Version:   3,
+		}
+		id, err := s.InsertResponse(ctx, response)
+		checkError(err, t)
+		if id == "" || response.ID != id {
+			t.Errorf("Bad response id %q", id)
+		}
+	}
+
+	responses, err := s.FindResponses(ctx, "form1")
+	checkError(err, t)
+	if len(responses) != 2 || responses[0].Responses["q"] != "a" || responses[0].Version != 3 {
+		t.Errorf("Unexpected responses: %+v", responses)
+	}
+
+	checkError(s.DeleteResponses(ctx, "form1"), t)
+	responses, _ = s.FindResponses(ctx, "form1")
+	if len(responses) != 0 {
+		t.Errorf("Responses not deleted")
+	}
+	responses, _ = s.FindResponses(ctx, "form2")
+	if len(responses) != 1 {
+		t.Errorf("Responses of other form deleted")
+	}
+}
+
+func testFillers(t *testing.T, s store.Store) {
+	ctx := context.Background()
+
+	checkError(s.InsertFiller(ctx, &models.FormAnonResponder{FormID: "form1", Filler: "rno"}), t)
+	if filled, _ := s.HasFilled(ctx, "form1", "rno"); !filled {
+		t.Errorf("Filler not recorded")
+	}
+	if filled, _ := s.HasFilled(ctx, "form2", "rno"); filled {
+		t.Errorf("Filler recorded for wrong form")
+	}
+	if filled, _ := s.HasFilled(ctx, "form1", "other"); filled {
+		t.Errorf("Filler recorded for wrong filler")
+	}
+
+	// Recording twice is harmless
+	checkError(s.InsertFiller(ctx, &models.FormAnonResponder{FormID: "form1", Filler: "rno"}), t)
+
+	// Concurrent responses of one filler save one response
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	inserted, duplicates := 0, 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.InsertCountedResponse(ctx, &models.FormResponse{FormID: "single"},
+				[]store.Quota{{Key: "*"}}, []*models.FormAnonResponder{{FormID: "single", Filler: "rno"}})
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err == store.ErrDuplicate {
+				duplicates++
+			} else if err == nil {
+				inserted++
+			} else {
+				t.Errorf("Unexpected error %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	responses, _ := s.FindResponses(ctx, "single")
+	counts, _ := s.FindCounts(ctx, "single")
+	if inserted != 1 || duplicates != 9 || len(responses) != 1 || counts["*"] != 1 {
+		t.Errorf("Expected one response, got %d inserted, %d duplicates, %d stored and counts %v",
+			inserted, duplicates, len(responses), counts)
+	}
+	if filled, _ := s.HasFilled(ctx, "single", "rno"); !filled {
+		t.Errorf("Filler not recorded with response")
+	}
+
+	// Any known filler stops the response, without recording the others
+	_, err := s.InsertCountedResponse(ctx, &models.FormResponse{FormID: "single"}, nil,
+		[]*models.FormAnonResponder{{FormID: "single", Filler: "new"}, {FormID: "single", Filler: "rno"}})
+	if err != store.ErrDuplicate {
+		t.Errorf("Expected ErrDuplicate, got %v", err)
+	}
+	if filled, _ := s.HasFilled(ctx, "single", "new"); filled {
+		t.Errorf("Filler recorded for duplicate response")
+	}
+
+	// Forgotten fillers may fill the form again
+	checkError(s.DeleteFillers(ctx, []*models.FormAnonResponder{{FormID: "single", Filler: "rno"}}), t)
+	if filled, _ := s.HasFilled(ctx, "single", "rno"); filled {
+		t.Errorf("Filler not deleted")
+	}
+	if filled, _ := s.HasFilled(ctx, "form1", "rno"); !filled {
+		t.Errorf("Filler deleted for wrong form")
+	}
+}
+
+func testCollaborators(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	older := dummyForm("Older shared", "owner")
+	older.Timestamp = time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	olderID, err := s.InsertForm(ctx, older)
+	checkError(err, t)
+	newer := dummyForm("Newer shared", "owner")
+	newer.Timestamp = time.Now().UTC().Truncate(time.Second)
+	newerID, err := s.InsertForm(ctx, newer)
+	checkError(err, t)
+
+	checkError(s.SetCollaborator(ctx, olderID, &models.Collaborator{RollNumber: "viewer", Role: models.RoleViewer}), t)
+	checkError(s.SetCollaborator(ctx, olderID, &models.Collaborator{RollNumber: "editor", Role: models.RoleViewer}), t)
+	checkError(s.SetCollaborator(ctx, olderID, &models.Collaborator{RollNumber: "editor", Role: models.RoleEditor}), t)
+	checkError(s.SetCollaborator(ctx, newerID, &models.Collaborator{RollNumber: "editor", Role: models.RoleOwner}), t)
+
+	form, err := s.FindForm(ctx, olderID)
+	checkError(err, t)
+	expected := []models.Collaborator{{RollNumber: "editor", Role: models.RoleEditor},
+		{RollNumber: "viewer", Role: models.RoleViewer}}
+	if !reflect.DeepEqual(form.Collaborators, expected) {
+		t.Errorf("Unexpected collaborators %+v", form.Collaborators)
+	}
+
+	shared, err := s.FindSharedForms(ctx, "editor")
+	checkError(err, t)
+	if len(shared) != 2 || shared[0].ID != newerID || shared[1].ID != olderID ||
+		shared[0].RoleOf("editor") != models.RoleOwner {
+		t.Errorf("Unexpected shared forms %+v", shared)
+	}
+
+	// Saving the form keeps its collaborators
+	form.Collaborators = nil
+	checkError(s.ReplaceForm(ctx, olderID, "owner", form.Version, form), t)
+	form, _ = s.FindForm(ctx, olderID)
+	if len(form.Collaborators) != 2 {
+		t.Errorf("Collaborators lost on replace: %+v", form.Collaborators)
+	}
+
+	checkError(s.DeleteCollaborator(ctx, olderID, "viewer"), t)
+	if err := s.DeleteCollaborator(ctx, olderID, "viewer"); err != store.ErrNotFound {
+		t.Errorf("Expected ErrNotFound removing twice, got %v", err)
+	}
+	checkError(s.DeleteForm(ctx, newerID), t)
+	shared, _ = s.FindSharedForms(ctx, "editor")
+	if len(shared) != 1 || shared[0].ID != olderID || len(shared[0].Collaborators) != 1 {
+		t.Errorf("Unexpected shared forms after removal %+v", shared)
+	}
+}
+
+func testTransfers(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+	id, err := s.InsertForm(ctx, dummyForm("Transfer", "from"))
+	checkError(err, t)
+
+	checkError(s.SetTransfer(ctx, &models.Transfer{FormID: id, Name: "Transfer", From: "from", To: "first",
+		Offered: now}), t)
+	checkError(s.SetTransfer(ctx, &models.Transfer{FormID: "older", From: "from", To: "to",
+		Offered: now.Add(-time.Hour)}), t)
+
+	// A new offer replaces the pending one
+	checkError(s.SetTransfer(ctx, &models.Transfer{FormID: id, Name: "Transfer", From: "from", To: "to",
+		Offered: now, KeepRole: models.RoleViewer}), t)
+	transfer, err := s.FindTransfer(ctx, id)
+	checkError(err, t)
+	if transfer.To != "to" || transfer.Name != "Transfer" || transfer.KeepRole != models.RoleViewer ||
+		!transfer.Offered.Equal(now) {
+		t.Errorf("Unexpected transfer %+v", transfer)
+	}
+	if first, _ := s.FindTransfersTo(ctx, "first"); len(first) != 0 {
+		t.Errorf("Replaced transfer still pending %+v", first)
+	}
+	transfers, err := s.FindTransfersTo(ctx, "to")
+	checkError(err, t)
+	if len(transfers) != 2 || transfers[0].FormID != id || transfers[1].FormID != "older" {
+		t.Errorf("Unexpected transfers %+v", transfers)
+	}
+
+	checkError(s.DeleteTransfer(ctx, "older"), t)
+	if err := s.DeleteTransfer(ctx, "older"); err != store.ErrNotFound {
+		t.Errorf("Expected ErrNotFound deleting twice, got %v", err)
+	}
+	checkError(s.DeleteForm(ctx, id), t)
+	if _, err := s.FindTransfer(ctx, id); err != store.ErrNotFound {
+		t.Errorf("Transfer kept after form deleted: %v", err)
+	}
+}
+
+func testShareLinks(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+	id, err := s.InsertForm(ctx, dummyForm("Shared results", "creator"))
+	checkError(err, t)
+
+	older := &models.ShareLink{FormID: id, Name: "Older", Scopes: []string{models.ScopeSummary},
+		Created: now.Add(-time.Hour), CreatedBy: "creator", TokenHash: "older-hash"}
+	_, err = s.InsertShareLink(ctx, older)
+	checkError(err, t)
+	newer := &models.ShareLink{FormID: id, Name: "Newer", Scopes: []string{models.ScopeRaw, models.ScopeExport},
+		Created: now, CreatedBy: "creator", Expires: models.At(now.Add(time.Hour)), TokenHash: "newer-hash"}
+	_, err = s.InsertShareLink(ctx, newer)
+	checkError(err, t)
+	if older.ID == "" || older.ID == newer.ID {
+		t.Fatalf("Bad share link ids %q and %q", older.ID, newer.ID)
+	}
+
+	// Found by the hash of their token
+	link, err := s.FindShareLinkByHash(ctx, "newer-hash")
+	checkError(err, t)
+	if link.ID != newer.ID || link.Name != "Newer" || !link.Allows(models.ScopeExport) ||
+		link.Allows(models.ScopeSummary) || !link.Expires.Equal(newer.Expires) || link.LastUsed.Valid {
+		t.Errorf("Unexpected share link %+v", link)
+	}
+	if _, err := s.FindShareLinkByHash(ctx, "unknown"); err != store.ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	// Uses and revocations are kept
+	checkError(s.TouchShareLink(ctx, older.ID, now), t)
+	checkError(s.RevokeShareLink(ctx, id, older.ID, now), t)
+	if err := s.RevokeShareLink(ctx, id, older.ID, now); err != store.ErrNotFound {
+		t.Errorf("Expected ErrNotFound revoking twice, got %v", err)
+	}
+	if err := s.RevokeShareLink(ctx, "other", newer.ID, now); err != store.ErrNotFound {
+		t.Errorf("Expected ErrNotFound revoking link of another form, got %v", err)
+	}
+	links, err := s.FindShareLinks(ctx, id)
+	checkError(err, t)
+	if len(links) != 2 || links[0].ID != newer.ID || links[1].ID != older.ID {
+		t.Fatalf("Unexpected share links %+v", links)
+	}
+	if !links[1].LastUsed.Equal(models.At(now)) || !links[1].Revoked.Equal(models.At(now)) || links[0].Revoked.Valid {
+		t.Errorf("Use or revocation not kept %+v", links)
+	}
+
+	checkError(s.DeleteForm(ctx, id), t)
+	if links, _ := s.FindShareLinks(ctx, id); len(links) != 0 {
+		t.Errorf("Share links kept after form deleted: %+v", links)
+	}
+}
+
+func testUsers(t *testing.T, s store.Store) {
+	ctx := context.Background()
+
+	if _, err := s.FindUser(ctx, "rno"); err != store.ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	profile := &models.Profile{ID: 1, FirstName: "Test", RollNumber: "rno"}
+	checkError(s.UpsertUser(ctx, profile), t)
+	profile.FirstName = "Changed"
+	checkError(s.UpsertUser(ctx, profile), t)
+
+	user, err := s.FindUser(ctx, "rno")
+	checkError(err, t)
+	if user.FirstName != "Changed" || user.Admin {
+		t.Errorf("Profile not upserted: %+v", user)
+	}
+
+	// Administrators stay so when their profile is saved again
+	checkError(s.SetAdmin(ctx, "rno", true), t)
+	profile.Admin = false
+	checkError(s.UpsertUser(ctx, profile), t)
+	if user, _ := s.FindUser(ctx, "rno"); !user.Admin {
+		t.Errorf("Administrator lost on upsert: %+v", user)
+	}
+	if err := s.SetAdmin(ctx, "unknown", true); err != store.ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func testSearch(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+	ids := []string{}
+	for i, name := range []string{"Search 100% Match", "search_other", "Searchless"} {
+		form := dummyForm(name, "searcher")
+		form.Timestamp = now.Add(time.Duration(i) * time.Minute)
+		form.Suspended = i == 0
+		id, err := s.InsertForm(ctx, form)
+		checkError(err, t)
+		ids = append(ids, id)
+	}
+
+	searches := map[string][]string{
+		"100%":     {ids[0]},
+		"SEARCH_":  {ids[1]},
+		"searcher": {ids[2], ids[1], ids[0]},
+		ids[1]:     {ids[1]},
+		"absent":   {},
+	}
+	for query, expected := range searches {
+		forms, err := s.SearchForms(ctx, query, 10)
+		checkError(err, t)
+		got := []string{}
+		for _, form := range forms {
+			got = append(got, form.ID)
+		}
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("Search for %q found %v, expected %v", query, got, expected)
+		}
+	}
+
+	forms, err := s.SearchForms(ctx, "", 2)
+	checkError(err, t)
+	if len(forms) != 2 {
+		t.Errorf("Expected 2 forms, got %d", len(forms))
+	}
+	form, _ := s.FindForm(ctx, ids[0])
+	if !form.Suspended {
+		t.Errorf("Suspension not stored")
+	}
+}
+
+func testRevisions(t *testing.T, s store.Store) {
+	ctx := context.Background()
+
+	for _, version := range []int{2, 1} {
+		form := dummyForm("Version "+strconv.Itoa(version), "creator")
+		form.Version = version
+		checkError(s.InsertRevision(ctx, &models.Revision{
+			FormID:     "form1",
+			Version:    version,
+			Replaced:   time.Now(),
+			ReplacedBy: "editor",
+			Form:       *form,
+		}), t)
+	}
+
+	// Versions are unique per form
+	if err := s.InsertRevision(ctx, &models.Revision{FormID: "form1", Version: 1}); err == nil {
+		t.Errorf("Duplicate revision inserted")
+	}
+
+	// Listed oldest first
+	revisions, err := s.FindRevisions(ctx, "form1")
+	checkError(err, t)
+	if len(revisions) != 2 || revisions[0].Version != 1 || revisions[1].Form.Name != "Version 2" {
+		t.Errorf("Unexpected revisions: %+v", revisions)
+	}
+
+	revision, err := s.FindRevision(ctx, "form1", 1)
+	checkError(err, t)
+	if revision.ReplacedBy != "editor" || revision.Form.Pages[0].Widgets[0].Props["question"] != "Question" {
+		t.Errorf("Revision differs from inserted: %+v", revision)
+	}
+	if _, err := s.FindRevision(ctx, "form1", 3); err != store.ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	checkError(s.DeleteRevisions(ctx, "form1"), t)
+	if revisions, _ := s.FindRevisions(ctx, "form1"); len(revisions) != 0 {
+		t.Errorf("Revisions not deleted")
+	}
+}
+
+func testQuotas(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	quotas := []store.Quota{{Key: "*", Max: 0}, {Key: "q:A", Max: 5}}
+
+	// Concurrent responses never take a counter past its quota
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	inserted, full := 0, 0
+	for i := 0; i < 12; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.InsertCountedResponse(ctx, &models.FormResponse{FormID: "quota",
+				Responses: map[string]interface{}{"q": "A"}}, quotas, nil)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if qe, ok := err.(*store.QuotaError); ok && qe.Key == "q:A" {
+				full++
+			} else if err == nil {
+				inserted++
+			} else {
+				t.Errorf("Unexpected error %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if inserted != 5 || full != 7 {
+		t.Errorf("Expected 5 inserted and 7 full, got %d and %d", inserted, full)
+	}
+
+	responses, _ := s.FindResponses(ctx, "quota")
+	counts, err := s.FindCounts(ctx, "quota")
+	checkError(err, t)
+	if len(responses) != 5 || counts["*"] != 5 || counts["q:A"] != 5 {
+		t.Errorf("Unexpected responses %d and counts %v", len(responses), counts)
+	}
+
+	// Other counters are unaffected
+	_, err = s.InsertCountedResponse(ctx, &models.FormResponse{FormID: "quota"}, quotas[:1], nil)
+	checkError(err, t)
+
+	// Deleting responses resets the counters
+	checkError(s.DeleteResponses(ctx, "quota"), t)
+	if counts, _ := s.FindCounts(ctx, "quota"); len(counts) != 0 {
+		t.Errorf("Counters not reset: %v", counts)
+	}
+}
+
+func testSetCounts(t *testing.T, s store.Store) {
+	ctx := context.Background()
+
+	// Responses stored before they were counted have no counters
+	legacy, err := s.InsertResponse(ctx, &models.FormResponse{FormID: "recount",
+		Responses: map[string]interface{}{"q": "A"}})
+	checkError(err, t)
+	counted, err := s.InsertCountedResponse(ctx, &models.FormResponse{FormID: "recount"},
+		[]store.Quota{{Key: "*"}, {Key: "q:B"}}, nil)
+	checkError(err, t)
+
+	// Counters are replaced, and only missing counters of responses are set
+	checkError(s.SetCounts(ctx, "recount", map[string]int{"*": 2, "q:A": 1},
+		map[string][]string{legacy: {"*", "q:A"}, counted: {"*"}}), t)
+	counts, err := s.FindCounts(ctx, "recount")
+	checkError(err, t)
+	if len(counts) != 2 || counts["*"] != 2 || counts["q:A"] != 1 {
+		t.Errorf("Unexpected counts %v", counts)
+	}
+	if response, _ := s.FindResponse(ctx, "recount", counted); len(response.Counters) != 2 {
+		t.Errorf("Counters of counted response replaced: %v", response.Counters)
+	}
+
+	// Removing the legacy response now releases its counters
+	_, err = s.DeleteResponse(ctx, "recount", legacy)
+	checkError(err, t)
+	if counts, _ := s.FindCounts(ctx, "recount"); counts["*"] != 1 || counts["q:A"] != 0 {
+		t.Errorf("Counters not released: %v", counts)
+	}
+}
+
+func testWaitlist(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	quotas := []store.Quota{{Key: "*", Max: 1}}
+
+	accepted := &models.FormResponse{FormID: "waitlist", Timestamp: time.Now(), Status: models.ResponseAccepted}
+	_, err := s.InsertCountedResponse(ctx, accepted, quotas, nil)
+	checkError(err, t)
+	waiting := &models.FormResponse{FormID: "waitlist", Timestamp: time.Now(), Status: models.ResponseWaitlisted}
+	_, err = s.InsertResponse(ctx, waiting)
+	checkError(err, t)
+
+	// No place yet
+	if _, ok := s.PromoteResponse(ctx, "waitlist", waiting.ID, quotas).(*store.QuotaError); !ok {
+		t.Errorf("Expected QuotaError")
+	}
+
+	// Deleting the accepted response frees its place
+	deleted, err := s.DeleteResponse(ctx, "waitlist", accepted.ID)
+	checkError(err, t)
+	if deleted == nil || deleted.ID != accepted.ID || deleted.Status != models.ResponseAccepted {
+		t.Errorf("Unexpected deleted response %+v", deleted)
+	}
+	if _, err := s.DeleteResponse(ctx, "waitlist", accepted.ID); err != store.ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	checkError(s.PromoteResponse(ctx, "waitlist", waiting.ID, quotas), t)
+	if err := s.PromoteResponse(ctx, "waitlist", waiting.ID, quotas); err != store.ErrConflict {
+		t.Errorf("Expected ErrConflict for promoted response, got %v", err)
+	}
+
+	responses, _ := s.FindResponses(ctx, "waitlist")
+	counts, _ := s.FindCounts(ctx, "waitlist")
+	if len(responses) != 1 || responses[0].Status != models.ResponseAccepted || counts["*"] != 1 {
+		t.Errorf("Unexpected responses %+v and counts %v", responses, counts)
+	}
+}
+
+func testReplace(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	booking := func(slot string) (*models.FormResponse, []store.Quota) {
+		return &models.FormResponse{FormID: "slots", Timestamp: time.Now(),
+				Responses: map[string]interface{}{"s": slot}},
+			[]store.Quota{{Key: "*"}, {Key: "s:" + slot, Max: 1}}
+	}
+
+	first, quotas := booking("a")
+	_, err := s.InsertCountedResponse(ctx, first, quotas, nil)
+	checkError(err, t)
+	second, quotas := booking("b")
+	_, err = s.InsertCountedResponse(ctx, second, quotas, nil)
+	checkError(err, t)
+
+	// Full slots are not double booked
+	moved, quotas := booking("b")
+	moved.ID = first.ID
+	if _, ok := s.ReplaceResponse(ctx, moved, quotas, "creator").(*store.QuotaError); !ok {
+		t.Errorf("Expected QuotaError")
+	}
+	found, err := s.FindResponse(ctx, "slots", first.ID)
+	checkError(err, t)
+	if found == nil || found.Responses["s"] != "a" {
+		t.Errorf("Unexpected response %+v", found)
+	}
+
+	// Moving frees the old slot
+	moved, quotas = booking("c")
+	moved.ID = first.ID
+	moved.Version = 2
+	checkError(s.ReplaceResponse(ctx, moved, quotas, "creator"), t)
+	found, _ = s.FindResponse(ctx, "slots", first.ID)
+	counts, _ := s.FindCounts(ctx, "slots")
+	if found.Responses["s"] != "c" || found.Version != 2 ||
+		counts["*"] != 2 || counts["s:a"] != 0 || counts["s:c"] != 1 {
+		t.Errorf("Unexpected response %+v and counts %v", found, counts)
+	}
+	if len(found.Edits) != 1 || found.Edits[0].Responses["s"] != "a" || found.Edits[0].EditedBy != "creator" ||
+		found.Edits[0].Version != 0 || found.Edits[0].Edited.IsZero() {
+		t.Errorf("Unexpected edits %+v", found.Edits)
+	}
+
+	// Concurrent moves to the same slot book it once
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	booked := 0
+	for _, id := range []string{first.ID, second.ID} {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			moved, quotas := booking("d")
+			moved.ID = id
+			err := s.ReplaceResponse(ctx, moved, quotas, "creator")
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err == nil {
+				booked++
+			} else if _, ok := err.(*store.QuotaError); !ok && err != store.ErrConflict {
+				t.Errorf("Unexpected error %v", err)
+			}
+		}(id)
+	}
+	wg.Wait()
+	counts, _ = s.FindCounts(ctx, "slots")
+	if booked != 1 || counts["s:d"] != 1 || counts["s:b"]+counts["s:c"] != 1 || counts["*"] != 2 {
+		t.Errorf("Expected one booking, got %d and counts %v", booked, counts)
+	}
+
+	// Waitlisted responses hold no places
+	waiting, _ := booking("e")
+	waiting.Status = models.ResponseWaitlisted
+	_, err = s.InsertResponse(ctx, waiting)
+	checkError(err, t)
+	moved, quotas = booking("a")
+	moved.ID = waiting.ID
+	checkError(s.ReplaceResponse(ctx, moved, quotas, "creator"), t)
+	if counts, _ := s.FindCounts(ctx, "slots"); counts["s:a"] != 0 || counts["*"] != 2 {
+		t.Errorf("Waitlisted response counted: %v", counts)
+	}
+
+	// Owners find their latest response
+	for i, slot := range []string{"f", "g"} {
+		own, _ := booking(slot)
+		own.Owner = "owner"
+		own.Timestamp = time.Now().Add(time.Duration(i) * time.Minute)
+		_, err = s.InsertResponse(ctx, own)
+		checkError(err, t)
+	}
+	own, err := s.FindOwnResponse(ctx, "slots", "owner")
+	checkError(err, t)
+	if own == nil || own.Responses["s"] != "g" || own.Owner != "owner" {
+		t.Errorf("Unexpected own response %+v", own)
+	}
+	if _, err := s.FindOwnResponse(ctx, "slots", ""); err != store.ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	moved.ID = "missing"
+	if err := s.ReplaceResponse(ctx, moved, quotas, "creator"); err != store.ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if _, err := s.FindResponse(ctx, "other", first.ID); err != store.ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func testWithdraw(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	quotas := []store.Quota{{Key: "*", Max: 1}}
+
+	response := &models.FormResponse{FormID: "withdraw", Timestamp: time.Now(), Status: models.ResponseAccepted,
+		Responses: map[string]interface{}{"q": "A"}}
+	_, err := s.InsertCountedResponse(ctx, response, quotas, nil)
+	checkError(err, t)
+
+	// The tombstone keeps no answers and gives up its place
+	withdrawn, err := s.WithdrawResponse(ctx, "withdraw", response.ID)
+	checkError(err, t)
+	if withdrawn == nil || withdrawn.Responses["q"] != "A" {
+		t.Errorf("Unexpected withdrawn response %+v", withdrawn)
+	}
+	found, err := s.FindResponse(ctx, "withdraw", response.ID)
+	checkError(err, t)
+	counts, _ := s.FindCounts(ctx, "withdraw")
+	if found == nil || found.Status != models.ResponseWithdrawn || len(found.Responses) != 0 || counts["*"] != 0 {
+		t.Errorf("Unexpected tombstone %+v and counts %v", found, counts)
+	}
+
+	if _, err := s.WithdrawResponse(ctx, "withdraw", response.ID); err != store.ErrNotFound {
+		t.Errorf("Expected ErrNotFound for withdrawn response, got %v", err)
+	}
+	if _, err := s.WithdrawResponse(ctx, "other", response.ID); err != store.ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	// Tombstones cannot take a place back
+	found.Responses = map[string]interface{}{"q": "B"}
+	if err := s.ReplaceResponse(ctx, found, quotas, "editor"); err != store.ErrNotFound {
+		t.Errorf("Expected ErrNotFound replacing withdrawn response, got %v", err)
+	}
+	if counts, _ := s.FindCounts(ctx, "withdraw"); counts["*"] != 0 {
+		t.Errorf("Withdrawn response counted again %v", counts)
+	}
+}
+
+func testAudit(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+
+	checkError(s.InsertAudit(ctx, &models.AuditEntry{FormID: "audit", Time: now.Add(time.Minute),
+		Action: "second", Details: map[string]string{"key": "value"}}), t)
+	checkError(s.InsertAudit(ctx, &models.AuditEntry{FormID: "audit", Time: now, Actor: "rno",
+		Action: "first", Target: "response"}), t)
+	checkError(s.InsertAudit(ctx, &models.AuditEntry{FormID: "other", Time: now, Action: "other"}), t)
+
+	entries, err := s.FindAudit(ctx, "audit")
+	checkError(err, t)
+	if len(entries) != 2 || entries[0].Action != "first" || entries[0].Actor != "rno" ||
+		entries[0].Target != "response" || !entries[0].Time.Equal(now) ||
+		entries[1].Action != "second" || entries[1].Details["key"] != "value" {
+		t.Errorf("Unexpected audit entries %+v", entries)
+	}
+}
+
+func testConcurrent(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	id, err := s.InsertForm(ctx, dummyForm("Concurrent", "creator"))
+	checkError(err, t)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.InsertResponse(ctx, &models.FormResponse{FormID: id, Responses: map[string]interface{}{}})
+			s.FindForm(ctx, id)
+		}()
+	}
+	wg.Wait()
+
+	responses, _ := s.FindResponses(ctx, id)
+	if len(responses) != 20 {
+		t.Errorf("Expected 20 responses, got %d", len(responses))
+	}
+}
+
+func dummyForm(name string, creator string) *models.Form {
+	return &models.Form{
+		Name:    name,
+		Creator: creator,
+		Pages: []models.Page{{
+			Title: name,
+			Widgets: []models.Widget{{
+				Type:  "short_answer",
+				UID:   "q",
+				Props: map[string]interface{}{"question": "Question"},
+			}},
+		}},
+	}
+}
+
+func checkError(err error, t *testing.T) {
+	if err != nil {
+		t.Errorf("An error occurred. %v", err)
+	}
+}
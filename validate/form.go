@@ -0,0 +1,112 @@
+package validate
+
+import (
+	"fmt"
+
+	"github.com/pulsejet/go-cerium/models"
+	"github.com/pulsejet/go-cerium/rules"
+	"github.com/pulsejet/go-cerium/widgets"
+)
+
+// Form : check the structure of a form definition, keying problems by JSON pointer
+func Form(form *models.Form) Errors {
+	errs := Errors{}
+
+	if len(form.Pages) == 0 {
+		errs["/pages"] = "must have at least one page"
+	}
+	if form.OpenOn.Valid && form.CloseOn.Valid && !form.OpenOn.Time.Before(form.CloseOn.Time) {
+		errs["/open_on"] = "must be before close_on"
+	}
+	if form.ResponseLimit < 0 {
+		errs["/response_limit"] = "must not be negative"
+	}
+
+	// UIDs must be unique across pages
+	seen := map[string]string{}
+
+	// UIDs of widgets that conditions may refer to
+	earlier := map[string]bool{}
+
+	for pi := range form.Pages {
+		for wi := range form.Pages[pi].Widgets {
+			w := &form.Pages[pi].Widgets[wi]
+			path := fmt.Sprintf("/pages/%d/widgets/%d", pi, wi)
+
+			if w.UID == "" {
+				errs[path+"/uid"] = "must not be empty"
+			} else if first, ok := seen[w.UID]; ok {
+				errs[path+"/uid"] = "duplicate of " + first
+			} else {
+				seen[w.UID] = path + "/uid"
+			}
+
+			t, ok := widgets.Lookup(w.Type)
+			if !ok {
+				errs[path+"/type"] = fmt.Sprintf("unknown widget type %q", w.Type)
+				continue
+			}
+
+			_, p, err := widgets.Decode(w)
+			if err != nil {
+				errs[path+"/props"] = err.Error()
+				continue
+			}
+
+			if !t.Display && p.Base().Question == "" {
+				errs[path+"/props/question"] = "must not be empty"
+			}
+			if t.Check != nil {
+				for prop, msg := range t.Check(p) {
+					errs[path+"/props/"+prop] = msg
+				}
+			}
+		}
+
+		// Widgets become known after their own condition is checked,
+		// so conditions can only refer to earlier questions
+		for wi := range form.Pages[pi].Widgets {
+			w := &form.Pages[pi].Widgets[wi]
+			path := fmt.Sprintf("/pages/%d/widgets/%d/show_if", pi, wi)
+			if msg := condition(w.ShowIf, earlier); msg != "" {
+				errs[path] = msg
+			}
+			earlier[w.UID] = true
+		}
+
+		// Branches may refer to any question up to this page and only jump forward
+		for bi, b := range form.Pages[pi].Branches {
+			path := fmt.Sprintf("/pages/%d/branches/%d", pi, bi)
+			if b.When == "" {
+				errs[path+"/when"] = "must not be empty"
+			} else if msg := condition(b.When, earlier); msg != "" {
+				errs[path+"/when"] = msg
+			}
+			if b.Goto <= pi || b.Goto > len(form.Pages) {
+				errs[path+"/goto"] = fmt.Sprintf("must be a later page or %d to end the form", len(form.Pages))
+			}
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// condition : check that a condition parses and refers only to known questions
+func condition(cond string, known map[string]bool) string {
+	if cond == "" {
+		return ""
+	}
+	e, err := rules.Parse(cond)
+	if err != nil {
+		return "invalid condition: " + err.Error()
+	}
+	for _, uid := range e.Refs() {
+		if !known[uid] {
+			return fmt.Sprintf("refers to %q which is not an earlier question", uid)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,134 @@
+package validate_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pulsejet/go-cerium/models"
+	"github.com/pulsejet/go-cerium/validate"
+)
+
+// Tests that a well formed form has no problems
+func TestValidForm(t *testing.T) {
+	if errs := validate.Form(testForm()); errs != nil {
+		t.Errorf("Unexpected errors %v", errs)
+	}
+}
+
+// Tests that every structural problem is reported with its path
+func TestInvalidForm(t *testing.T) {
+	form := &models.Form{Pages: []models.Page{
+		{Widgets: []models.Widget{
+			{Type: "short_answer", UID: "a", Props: map[string]interface{}{"question": "A", "regex": "("}},
+			{Type: "section", UID: "b"},
+		}},
+		{Widgets: []models.Widget{
+			{Type: "multiple_choice", UID: "a", Props: map[string]interface{}{"question": "C"}},
+			{Type: "hologram", UID: "d", Props: map[string]interface{}{"question": "D"}},
+			{Type: "checkboxes", UID: "e", Props: map[string]interface{}{
+				"question": "E", "options": []interface{}{"x", "x"}, "min": 3.0, "max": 1.0}},
+			{Type: "number", UID: "f", Props: map[string]interface{}{"min": "low"}},
+			{Type: "date", UID: "g", Props: map[string]interface{}{"question": "G", "max": "tomorrow"}},
+		}},
+	}}
+
+	errs := validate.Form(form)
+	for _, path := range []string{
+		"/pages/0/widgets/0/props/regex",
+		"/pages/1/widgets/0/uid",
+		"/pages/1/widgets/0/props/options",
+		"/pages/1/widgets/1/type",
+		"/pages/1/widgets/2/props/options/1",
+		"/pages/1/widgets/2/props/max",
+		"/pages/1/widgets/3/props",
+		"/pages/1/widgets/4/props/max",
+	} {
+		if errs[path] == "" {
+			t.Errorf("Expected error at %s", path)
+		}
+	}
+	if len(errs) != 8 {
+		t.Errorf("Unexpected errors %v", errs)
+	}
+
+	// Forms need pages
+	if errs := validate.Form(&models.Form{}); errs["/pages"] == "" {
+		t.Errorf("Expected error for no pages, got %v", errs)
+	}
+}
+
+// Tests that conditions and branches are checked
+func TestFormRules(t *testing.T) {
+	question := func(uid string, showIf string) models.Widget {
+		return models.Widget{Type: "short_answer", UID: uid, ShowIf: showIf,
+			Props: map[string]interface{}{"question": uid}}
+	}
+	form := &models.Form{Pages: []models.Page{
+		{
+			Widgets: []models.Widget{question("a", ""), question("b", "a == 'x'"), question("c", "d == 1")},
+			Branches: []models.Branch{
+				{When: "b == ", Goto: 1},
+				{When: "a == 'y'", Goto: 0},
+				{When: "a == 'z'", Goto: 2},
+			},
+		},
+		{Widgets: []models.Widget{question("d", "")}},
+	}}
+
+	errs := validate.Form(form)
+	for _, path := range []string{
+		"/pages/0/widgets/2/show_if",
+		"/pages/0/branches/0/when",
+		"/pages/0/branches/1/goto",
+	} {
+		if errs[path] == "" {
+			t.Errorf("Expected error at %s", path)
+		}
+	}
+	if len(errs) != 3 {
+		t.Errorf("Unexpected errors %v", errs)
+	}
+}
+
+// Tests that schedules, limits and capacities are checked
+func TestFormSettings(t *testing.T) {
+	form := testForm()
+	form.OpenOn = models.At(time.Date(2030, 1, 2, 0, 0, 0, 0, time.UTC))
+	form.CloseOn = models.At(time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC))
+	form.ResponseLimit = -1
+	form.Pages[0].Widgets[3].Props["capacity"] = map[string]interface{}{"H1": 10.0, "H3": 5.0}
+
+	errs := validate.Form(form)
+	for _, path := range []string{"/open_on", "/response_limit", "/pages/0/widgets/3/props/capacity/H3"} {
+		if errs[path] == "" {
+			t.Errorf("Expected error at %s", path)
+		}
+	}
+	if len(errs) != 3 {
+		t.Errorf("Unexpected errors %v", errs)
+	}
+}
+
+// Tests that slots need unique ids, ordered times and places
+func TestFormSlots(t *testing.T) {
+	form := testForm()
+	form.Pages[0].Widgets[6].Props["slots"] = []interface{}{
+		map[string]interface{}{"id": "mon", "start": "2030-01-07T10:00:00Z", "end": "2030-01-07T09:00:00Z", "capacity": 1.0},
+		map[string]interface{}{"id": "mon", "start": "monday", "end": "2030-01-07T11:00:00Z", "capacity": 0.0},
+	}
+
+	errs := validate.Form(form)
+	for _, path := range []string{
+		"/pages/0/widgets/6/props/slots/0/end",
+		"/pages/0/widgets/6/props/slots/1/id",
+		"/pages/0/widgets/6/props/slots/1/start",
+		"/pages/0/widgets/6/props/slots/1/capacity",
+	} {
+		if errs[path] == "" {
+			t.Errorf("Expected error at %s", path)
+		}
+	}
+	if len(errs) != 4 {
+		t.Errorf("Unexpected errors %v", errs)
+	}
+}
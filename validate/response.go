@@ -0,0 +1,73 @@
+package validate
+
+import (
+	"github.com/pulsejet/go-cerium/models"
+	"github.com/pulsejet/go-cerium/rules"
+	"github.com/pulsejet/go-cerium/widgets"
+)
+
+// Errors : validation failures keyed by widget UID or JSON pointer
+type Errors map[string]string
+
+// Response : check answers against the visible widgets of the form,
+// dropping answers to hidden widgets and normalizing valid answers in place
+func Response(form *models.Form, answers map[string]interface{}) Errors {
+	errs := Errors{}
+
+	// Index widgets by UID
+	index := map[string]*models.Widget{}
+	for pi := range form.Pages {
+		for wi := range form.Pages[pi].Widgets {
+			w := &form.Pages[pi].Widgets[wi]
+			index[w.UID] = w
+		}
+	}
+
+	// Answers must belong to a widget
+	for uid := range answers {
+		if _, ok := index[uid]; !ok {
+			errs[uid] = "unknown question"
+		}
+	}
+
+	// Answers to hidden questions are ignored and hidden questions are never required
+	visible := rules.Evaluate(form, answers).Widgets
+
+	// Check each widget
+	for uid, w := range index {
+		if !visible[uid] {
+			delete(answers, uid)
+			continue
+		}
+
+		// Answers are never accepted without the checks of their widget
+		t, p, err := widgets.Decode(w)
+		if err != nil {
+			errs[uid] = err.Error()
+			continue
+		}
+
+		v, answered := answers[uid]
+		switch {
+		case t.Display:
+			if answered {
+				errs[uid] = "does not take an answer"
+			}
+		case widgets.IsEmpty(v):
+			if p.Base().Required {
+				errs[uid] = "required"
+			}
+		default:
+			if msg := t.Validate(p, v); msg != "" {
+				errs[uid] = msg
+			} else {
+				answers[uid] = t.Normalize(p, v)
+			}
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
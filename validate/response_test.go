@@ -0,0 +1,96 @@
+package validate_test
+
+import (
+	"testing"
+
+	"github.com/pulsejet/go-cerium/models"
+	"github.com/pulsejet/go-cerium/validate"
+)
+
+func testForm() *models.Form {
+	return &models.Form{Pages: []models.Page{{Widgets: []models.Widget{
+		{Type: "short_answer", UID: "name", Props: map[string]interface{}{
+			"question": "Name", "required": true, "min_length": 2.0, "max_length": 10.0}},
+		{Type: "short_answer", UID: "roll", Props: map[string]interface{}{
+			"question": "Roll", "regex": "^[0-9]{9}$"}},
+		{Type: "number", UID: "age", Props: map[string]interface{}{
+			"question": "Age", "min": 16.0, "max": 99.0}},
+		{Type: "multiple_choice", UID: "hostel", Props: map[string]interface{}{
+			"question": "Hostel", "options": []interface{}{"H1", "H2"}}},
+		{Type: "checkboxes", UID: "clubs", Props: map[string]interface{}{
+			"question": "Clubs", "options": []interface{}{"Music", "Dance", "Drama"}, "max": 2.0}},
+		{Type: "date", UID: "dob", Props: map[string]interface{}{
+			"question": "Birthday", "max": "2010-01-01"}},
+		{Type: "slot", UID: "viva", Props: map[string]interface{}{
+			"question": "Viva", "slots": []interface{}{
+				map[string]interface{}{"id": "mon", "start": "2030-01-07T10:00:00Z", "end": "2030-01-07T10:30:00Z", "capacity": 2.0},
+				map[string]interface{}{"id": "tue", "start": "2030-01-08T10:00:00Z", "end": "2030-01-08T10:30:00Z", "capacity": 1.0},
+			}}},
+	}}}}
+}
+
+// Tests that valid answers pass
+func TestValidResponse(t *testing.T) {
+	errs := validate.Response(testForm(), map[string]interface{}{
+		"name":   "Test",
+		"roll":   "123456789",
+		"age":    20.0,
+		"hostel": "H1",
+		"clubs":  []interface{}{"Music", "Drama"},
+		"dob":    "2000-05-01",
+		"viva":   "tue",
+	})
+	if errs != nil {
+		t.Errorf("Unexpected errors %v", errs)
+	}
+
+	// Optional questions may be skipped
+	errs = validate.Response(testForm(), map[string]interface{}{"name": "Test"})
+	if errs != nil {
+		t.Errorf("Unexpected errors %v", errs)
+	}
+}
+
+// Tests that each kind of invalid answer is reported against its UID
+func TestInvalidResponse(t *testing.T) {
+	errs := validate.Response(testForm(), map[string]interface{}{
+		"name":    "",
+		"roll":    "12ab",
+		"age":     "old",
+		"hostel":  "H9",
+		"clubs":   []interface{}{"Music", "Dance", "Drama"},
+		"dob":     "2015-01-01",
+		"viva":    "wed",
+		"unknown": "value",
+	})
+
+	for _, uid := range []string{"name", "roll", "age", "hostel", "clubs", "dob", "viva", "unknown"} {
+		if errs[uid] == "" {
+			t.Errorf("Expected error for %s, got %v", uid, errs)
+		}
+	}
+	if errs["name"] != "required" {
+		t.Errorf("Expected required error, got %q", errs["name"])
+	}
+}
+
+// Tests that widgets whose props do not decode refuse answers
+func TestBadPropsResponse(t *testing.T) {
+	form := testForm()
+	form.Pages[0].Widgets[0].Props["required"] = "yes"
+	errs := validate.Response(form, map[string]interface{}{"roll": "123456789"})
+	if errs["name"] == "" || len(errs) != 1 {
+		t.Errorf("Unexpected errors %v", errs)
+	}
+}
+
+// Tests length and range limits
+func TestResponseLimits(t *testing.T) {
+	errs := validate.Response(testForm(), map[string]interface{}{
+		"name": "A very long name",
+		"age":  12.0,
+	})
+	if errs["name"] == "" || errs["age"] == "" || len(errs) != 2 {
+		t.Errorf("Unexpected errors %v", errs)
+	}
+}
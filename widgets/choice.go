@@ -0,0 +1,130 @@
+package widgets
+
+import (
+	"fmt"
+)
+
+// ChoiceProps : props of multiple_choice, dropdown and checkboxes widgets
+type ChoiceProps struct {
+	Common
+	Options []string `json:"options"`
+
+	// Limits on the number of options selected in checkboxes
+	Min *float64 `json:"min"`
+	Max *float64 `json:"max"`
+
+	// Most responses that may pick each option, for options that are limited
+	Capacity map[string]int `json:"capacity,omitempty"`
+}
+
+// Capacities : the most responses that may pick each limited option
+func (p *ChoiceProps) Capacities() map[string]int {
+	return p.Capacity
+}
+
+func init() {
+	for _, name := range []string{"multiple_choice", "dropdown"} {
+		Register(&Type{
+			Name:      name,
+			NewProps:  func() Props { return &ChoiceProps{} },
+			Check:     checkChoice,
+			Validate:  validateChoice,
+			Normalize: func(p Props, v interface{}) interface{} { return v },
+			Format:    func(p Props, v interface{}) string { return FormatValue(v) },
+		})
+	}
+
+	Register(&Type{
+		Name:      "checkboxes",
+		NewProps:  func() Props { return &ChoiceProps{} },
+		Check:     checkChoice,
+		Validate:  validateCheckboxes,
+		Normalize: normalizeCheckboxes,
+		Format:    func(p Props, v interface{}) string { return FormatValue(v) },
+	})
+}
+
+func checkChoice(props Props) map[string]string {
+	p := props.(*ChoiceProps)
+	problems := map[string]string{}
+	checkRange(problems, "min", p.Min, "max", p.Max)
+
+	if len(p.Options) == 0 {
+		problems["options"] = "must have at least one option"
+	}
+	seen := map[string]bool{}
+	for i, o := range p.Options {
+		key := fmt.Sprintf("options/%d", i)
+		if o == "" {
+			problems[key] = "must not be empty"
+		} else if seen[o] {
+			problems[key] = "duplicate option"
+		}
+		seen[o] = true
+	}
+	for o, n := range p.Capacity {
+		if !seen[o] {
+			problems["capacity/"+o] = "not one of the options"
+		} else if n < 1 {
+			problems["capacity/"+o] = "must be at least 1"
+		}
+	}
+	return problems
+}
+
+func validateChoice(props Props, v interface{}) string {
+	p := props.(*ChoiceProps)
+	s, ok := v.(string)
+	if !ok || !hasOption(p.Options, s) {
+		return "must be one of the options"
+	}
+	return ""
+}
+
+func validateCheckboxes(props Props, v interface{}) string {
+	p := props.(*ChoiceProps)
+	selected, ok := ToSlice(v)
+	if !ok {
+		return "must be a list of options"
+	}
+
+	seen := map[string]bool{}
+	for _, item := range selected {
+		s, ok := item.(string)
+		if !ok || !hasOption(p.Options, s) {
+			return "must only contain the options"
+		}
+		if seen[s] {
+			return "must not repeat options"
+		}
+		seen[s] = true
+	}
+
+	n := float64(len(selected))
+	if p.Min != nil && n < *p.Min {
+		return fmt.Sprintf("must select at least %v options", *p.Min)
+	}
+	if p.Max != nil && n > *p.Max {
+		return fmt.Sprintf("must select at most %v options", *p.Max)
+	}
+	return ""
+}
+
+// normalizeCheckboxes : store selections in the order of the options
+func normalizeCheckboxes(props Props, v interface{}) interface{} {
+	p := props.(*ChoiceProps)
+	selected, _ := ToSlice(v)
+
+	seen := map[interface{}]bool{}
+	for _, item := range selected {
+		seen[item] = true
+	}
+
+	ordered := []interface{}{}
+	for _, o := range p.Options {
+		if seen[o] {
+			ordered = append(ordered, o)
+		}
+	}
+	return ordered
+}
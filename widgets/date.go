@@ -0,0 +1,59 @@
+package widgets
+
+// DateProps : props of date widgets
+type DateProps struct {
+	Common
+	Min string `json:"min"`
+	Max string `json:"max"`
+}
+
+func init() {
+	Register(&Type{
+		Name:     "date",
+		NewProps: func() Props { return &DateProps{} },
+		Check:    checkDate,
+		Validate: validateDate,
+		Normalize: func(p Props, v interface{}) interface{} {
+			d, _ := ParseDate(v.(string))
+			return d.Format(DateLayouts[0])
+		},
+		Format: func(p Props, v interface{}) string { return FormatValue(v) },
+	})
+}
+
+func checkDate(props Props) map[string]string {
+	p := props.(*DateProps)
+	problems := map[string]string{}
+	min, minOk := ParseDate(p.Min)
+	max, maxOk := ParseDate(p.Max)
+	if p.Min != "" && !minOk {
+		problems["min"] = "must be a date"
+	}
+	if p.Max != "" && !maxOk {
+		problems["max"] = "must be a date"
+	}
+	if minOk && maxOk && min.After(max) {
+		problems["max"] = "must not be before min"
+	}
+	return problems
+}
+
+func validateDate(props Props, v interface{}) string {
+	p := props.(*DateProps)
+	s, ok := v.(string)
+	if !ok {
+		return "must be a date"
+	}
+	d, ok := ParseDate(s)
+	if !ok {
+		return "must be a date"
+	}
+
+	if min, ok := ParseDate(p.Min); ok && d.Before(min) {
+		return "must not be before " + min.Format(DateLayouts[0])
+	}
+	if max, ok := ParseDate(p.Max); ok && d.After(max) {
+		return "must not be after " + max.Format(DateLayouts[0])
+	}
+	return ""
+}
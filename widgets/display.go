@@ -0,0 +1,19 @@
+package widgets
+
+// DisplayProps : props of widgets that only show content
+type DisplayProps struct {
+	Common
+	Text string `json:"text"`
+	URL  string `json:"url"`
+}
+
+func init() {
+	for _, name := range []string{"section", "description", "image"} {
+		Register(&Type{
+			Name:     name,
+			Display:  true,
+			NewProps: func() Props { return &DisplayProps{} },
+			Check:    func(p Props) map[string]string { return nil },
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package widgets
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// NumberProps : props of number widgets
+type NumberProps struct {
+	Common
+	Min *float64 `json:"min"`
+	Max *float64 `json:"max"`
+}
+
+func init() {
+	Register(&Type{
+		Name:     "number",
+		NewProps: func() Props { return &NumberProps{} },
+		Check: func(props Props) map[string]string {
+			p := props.(*NumberProps)
+			problems := map[string]string{}
+			checkRange(problems, "min", p.Min, "max", p.Max)
+			return problems
+		},
+		Validate: validateNumber,
+		Normalize: func(p Props, v interface{}) interface{} {
+			n, _ := ToNumber(v)
+			return n
+		},
+		Format: func(p Props, v interface{}) string {
+			if n, ok := ToNumber(v); ok {
+				return strconv.FormatFloat(n, 'f', -1, 64)
+			}
+			return FormatValue(v)
+		},
+	})
+}
+
+func validateNumber(props Props, v interface{}) string {
+	p := props.(*NumberProps)
+	n, ok := ToNumber(v)
+	if !ok {
+		return "must be a number"
+	}
+
+	if p.Min != nil && n < *p.Min {
+		return fmt.Sprintf("must be at least %v", *p.Min)
+	}
+	if p.Max != nil && n > *p.Max {
+		return fmt.Sprintf("must be at most %v", *p.Max)
+	}
+	return ""
+}
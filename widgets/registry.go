@@ -0,0 +1,141 @@
+package widgets
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/pulsejet/go-cerium/models"
+)
+
+// Props : typed props of a widget, decoded from models.Widget.Props
+type Props interface {
+	// Base : props shared by all widgets
+	Base() *Common
+}
+
+// Capped : props of widgets that limit how many responses may pick an answer
+type Capped interface {
+	Props
+
+	// Capacities gets the most responses that may pick each limited answer
+	Capacities() map[string]int
+}
+
+// Common : props shared by all widgets
+type Common struct {
+	Question string `json:"question"`
+	Required bool   `json:"required"`
+}
+
+// Base : props shared by all widgets
+func (c *Common) Base() *Common {
+	return c
+}
+
+// Type : behaviour of one widget type
+type Type struct {
+	// Name of the type as stored in models.Widget.Type
+	Name string
+
+	// Display is set for widgets that take no answer, like headers and images
+	Display bool
+
+	// NewProps allocates the typed props to decode into
+	NewProps func() Props
+
+	// Check finds problems in the props of a widget, keyed by prop name
+	Check func(p Props) map[string]string
+
+	// Validate checks a non-empty answer, returning a message if it is invalid
+	Validate func(p Props, v interface{}) string
+
+	// Normalize converts a valid answer to the value that is stored
+	Normalize func(p Props, v interface{}) interface{}
+
+	// Format renders a stored answer as text for exports
+	Format func(p Props, v interface{}) string
+}
+
+var (
+	mu       sync.RWMutex
+	registry = map[string]*Type{}
+)
+
+// Register : make a widget type available, replacing any with the same name
+func Register(t *Type) {
+	mu.Lock()
+	defer mu.Unlock()
+	registry[t.Name] = t
+}
+
+// Lookup : get a registered widget type by name
+func Lookup(name string) (*Type, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	t, ok := registry[name]
+	return t, ok
+}
+
+// Get : get the type of a widget, falling back to one that accepts any answer
+func Get(name string) *Type {
+	if t, ok := Lookup(name); ok {
+		return t
+	}
+	return fallback
+}
+
+// Decode : get the type and typed props of a widget
+func Decode(w *models.Widget) (*Type, Props, error) {
+	t := Get(w.Type)
+	p := t.NewProps()
+	if len(w.Props) == 0 {
+		return t, p, nil
+	}
+
+	// Round trip through JSON so props stored by any backend decode alike
+	b, err := json.Marshal(w.Props)
+	if err != nil {
+		return t, t.NewProps(), err
+	}
+	err = json.Unmarshal(b, p)
+	if err != nil {
+		return t, t.NewProps(), fmt.Errorf("bad props for %s: %v", w.Type, err)
+	}
+	return t, p, nil
+}
+
+// Label : question text of a widget for exports
+func Label(w *models.Widget) string {
+	_, p, _ := Decode(w)
+	if q := p.Base().Question; q != "" {
+		return q
+	}
+	return w.UID
+}
+
+// fallback : used for widgets of unregistered types
+var fallback = &Type{
+	Name:      "",
+	NewProps:  func() Props { return &Common{} },
+	Check:     func(p Props) map[string]string { return nil },
+	Validate:  func(p Props, v interface{}) string { return "" },
+	Normalize: func(p Props, v interface{}) interface{} { return v },
+	Format:    func(p Props, v interface{}) string { return FormatValue(v) },
+}
+
+// FormatValue : render any answer as text
+func FormatValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float32, float64:
+		return fmt.Sprintf("%9.f", v)
+	}
+	if a, ok := ToSlice(v); ok {
+		return joinValues(a)
+	}
+	return fmt.Sprintf("%v", v)
+}
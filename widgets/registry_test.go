@@ -0,0 +1,76 @@
+package widgets_test
+
+import (
+	"testing"
+
+	"github.com/pulsejet/go-cerium/models"
+	"github.com/pulsejet/go-cerium/validate"
+	"github.com/pulsejet/go-cerium/widgets"
+)
+
+// RatingProps : props of the test widget type
+type RatingProps struct {
+	widgets.Common
+	Stars int `json:"stars"`
+}
+
+// Tests that a new widget type works end to end once registered
+func TestRegister(t *testing.T) {
+	widgets.Register(&widgets.Type{
+		Name:     "rating",
+		NewProps: func() widgets.Props { return &RatingProps{} },
+		Validate: func(p widgets.Props, v interface{}) string {
+			n, ok := v.(float64)
+			if !ok || n < 1 || int(n) > p.(*RatingProps).Stars {
+				return "bad rating"
+			}
+			return ""
+		},
+		Normalize: func(p widgets.Props, v interface{}) interface{} { return int(v.(float64)) },
+		Format:    func(p widgets.Props, v interface{}) string { return "*" },
+	})
+
+	w := models.Widget{Type: "rating", UID: "r", Props: map[string]interface{}{"question": "Rate", "stars": 5}}
+	form := &models.Form{Pages: []models.Page{{Widgets: []models.Widget{w}}}}
+
+	answers := map[string]interface{}{"r": 4.0}
+	if errs := validate.Response(form, answers); errs != nil {
+		t.Errorf("Unexpected errors %v", errs)
+	}
+	if answers["r"] != 4 {
+		t.Errorf("Answer not normalized: %#v", answers["r"])
+	}
+
+	if errs := validate.Response(form, map[string]interface{}{"r": 6.0}); errs["r"] != "bad rating" {
+		t.Errorf("Expected bad rating, got %v", errs)
+	}
+}
+
+// Tests decoding of typed props and labels
+func TestDecode(t *testing.T) {
+	w := &models.Widget{Type: "checkboxes", UID: "c", Props: map[string]interface{}{
+		"question": "Pick", "required": true, "options": []interface{}{"A", "B"}, "max": int32(1)}}
+
+	typ, p, err := widgets.Decode(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	props := p.(*widgets.ChoiceProps)
+	if typ.Name != "checkboxes" || !props.Required || len(props.Options) != 2 || *props.Max != 1 {
+		t.Errorf("Bad props %+v", props)
+	}
+
+	// Display widgets need no question
+	header := &models.Widget{Type: "section", UID: "s"}
+	if typ, _, _ := widgets.Decode(header); !typ.Display {
+		t.Errorf("Section should be a display widget")
+	}
+	if widgets.Label(header) != "s" {
+		t.Errorf("Label should fall back to UID")
+	}
+
+	// Unknown types accept any answer
+	if typ := widgets.Get("unknown"); typ.Validate(nil, 1) != "" {
+		t.Errorf("Fallback type should accept anything")
+	}
+}
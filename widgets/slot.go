@@ -0,0 +1,127 @@
+package widgets
+
+import (
+	"fmt"
+	"time"
+)
+
+// Slot : a period of time that a limited number of responses may book
+type Slot struct {
+	ID       string `json:"id"`
+	Start    string `json:"start"`
+	End      string `json:"end"`
+	Capacity int    `json:"capacity"`
+}
+
+// Times : the start and end of the slot, which are RFC 3339 timestamps
+func (s *Slot) Times() (time.Time, time.Time, bool) {
+	start, err := time.Parse(time.RFC3339, s.Start)
+	if err != nil {
+		return start, start, false
+	}
+	end, err := time.Parse(time.RFC3339, s.End)
+	if err != nil {
+		return start, end, false
+	}
+	return start, end, true
+}
+
+// Label : the slot as text, like "2020-01-02 10:00 - 10:30"
+func (s *Slot) Label() string {
+	start, end, ok := s.Times()
+	if !ok {
+		return s.ID
+	}
+	if start.Format("2006-01-02") == end.Format("2006-01-02") {
+		return start.Format("2006-01-02 15:04") + " - " + end.Format("15:04")
+	}
+	return start.Format("2006-01-02 15:04") + " - " + end.Format("2006-01-02 15:04")
+}
+
+// SlotProps : props of slot widgets, where each response books one of the slots
+type SlotProps struct {
+	Common
+	Slots []Slot `json:"slots"`
+}
+
+// Slot : get a slot by id
+func (p *SlotProps) Slot(id string) (*Slot, bool) {
+	for i := range p.Slots {
+		if p.Slots[i].ID == id {
+			return &p.Slots[i], true
+		}
+	}
+	return nil, false
+}
+
+// Capacities : the places in each slot
+func (p *SlotProps) Capacities() map[string]int {
+	capacities := map[string]int{}
+	for _, s := range p.Slots {
+		capacities[s.ID] = s.Capacity
+	}
+	return capacities
+}
+
+func init() {
+	Register(&Type{
+		Name:      "slot",
+		NewProps:  func() Props { return &SlotProps{} },
+		Check:     checkSlot,
+		Validate:  validateSlot,
+		Normalize: func(p Props, v interface{}) interface{} { return v },
+		Format: func(p Props, v interface{}) string {
+			if s, ok := p.(*SlotProps).Slot(FormatValue(v)); ok {
+				return s.Label()
+			}
+			return FormatValue(v)
+		},
+	})
+}
+
+func checkSlot(props Props) map[string]string {
+	p := props.(*SlotProps)
+	problems := map[string]string{}
+
+	if len(p.Slots) == 0 {
+		problems["slots"] = "must have at least one slot"
+	}
+	seen := map[string]bool{}
+	for i, s := range p.Slots {
+		key := fmt.Sprintf("slots/%d", i)
+		if s.ID == "" {
+			problems[key+"/id"] = "must not be empty"
+		} else if seen[s.ID] {
+			problems[key+"/id"] = "duplicate slot"
+		}
+		seen[s.ID] = true
+
+		start, startErr := time.Parse(time.RFC3339, s.Start)
+		end, endErr := time.Parse(time.RFC3339, s.End)
+		if startErr != nil {
+			problems[key+"/start"] = "must be a time"
+		}
+		if endErr != nil {
+			problems[key+"/end"] = "must be a time"
+		}
+		if startErr == nil && endErr == nil && !end.After(start) {
+			problems[key+"/end"] = "must be after start"
+		}
+		if s.Capacity < 1 {
+			problems[key+"/capacity"] = "must be at least 1"
+		}
+	}
+	return problems
+}
+
+func validateSlot(props Props, v interface{}) string {
+	p := props.(*SlotProps)
+	s, ok := v.(string)
+	if !ok {
+		return "must be one of the slots"
+	}
+	if _, ok := p.Slot(s); !ok {
+		return "must be one of the slots"
+	}
+	return ""
+}
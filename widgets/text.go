@@ -0,0 +1,64 @@
+package widgets
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// TextProps : props of short_answer and paragraph widgets
+type TextProps struct {
+	Common
+	MinLength *float64 `json:"min_length"`
+	MaxLength *float64 `json:"max_length"`
+	Regex     string   `json:"regex"`
+}
+
+func init() {
+	for _, name := range []string{"short_answer", "paragraph"} {
+		Register(&Type{
+			Name:      name,
+			NewProps:  func() Props { return &TextProps{} },
+			Check:     checkText,
+			Validate:  validateText,
+			Normalize: func(p Props, v interface{}) interface{} { return v },
+			Format:    func(p Props, v interface{}) string { return FormatValue(v) },
+		})
+	}
+}
+
+func checkText(props Props) map[string]string {
+	p := props.(*TextProps)
+	problems := map[string]string{}
+	checkRange(problems, "min_length", p.MinLength, "max_length", p.MaxLength)
+	if p.MinLength != nil && *p.MinLength < 0 {
+		problems["min_length"] = "must not be negative"
+	}
+	if _, err := regexp.Compile(p.Regex); err != nil {
+		problems["regex"] = "invalid regular expression: " + err.Error()
+	}
+	return problems
+}
+
+func validateText(props Props, v interface{}) string {
+	p := props.(*TextProps)
+	s, ok := v.(string)
+	if !ok {
+		return "must be text"
+	}
+
+	n := float64(len([]rune(s)))
+	if p.MinLength != nil && n < *p.MinLength {
+		return fmt.Sprintf("must be at least %v characters", *p.MinLength)
+	}
+	if p.MaxLength != nil && n > *p.MaxLength {
+		return fmt.Sprintf("must be at most %v characters", *p.MaxLength)
+	}
+
+	if p.Regex != "" {
+		re, err := regexp.Compile(p.Regex)
+		if err == nil && !re.MatchString(s) {
+			return "does not match the required format"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,109 @@
+package widgets
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DateLayouts : accepted formats for date answers and date props
+var DateLayouts = []string{"2006-01-02", time.RFC3339}
+
+// IsEmpty : true for missing, blank or empty list answers
+func IsEmpty(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	if s, ok := v.(string); ok {
+		return strings.TrimSpace(s) == ""
+	}
+	if a, ok := ToSlice(v); ok {
+		return len(a) == 0
+	}
+	return false
+}
+
+// ParseDate : parse a date in any of DateLayouts
+func ParseDate(s string) (time.Time, bool) {
+	for _, layout := range DateLayouts {
+		if d, err := time.Parse(layout, s); err == nil {
+			return d, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// ToNumber : convert a number or numeric string
+func ToNumber(v interface{}) (float64, bool) {
+	if n, ok := toFloat(v); ok {
+		return n, true
+	}
+	if s, ok := v.(string); ok {
+		n, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// toFloat : convert any numeric value decoded from JSON or BSON
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// ToSlice : convert any list decoded from JSON or BSON
+func ToSlice(v interface{}) ([]interface{}, bool) {
+	if a, ok := v.([]interface{}); ok {
+		return a, true
+	}
+
+	// Database drivers may decode lists to named slice types
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice {
+		return nil, false
+	}
+	a := make([]interface{}, rv.Len())
+	for i := range a {
+		a[i] = rv.Index(i).Interface()
+	}
+	return a, true
+}
+
+// joinValues : render a list of answers as comma separated text
+func joinValues(a []interface{}) string {
+	s := make([]string, len(a))
+	for i := range a {
+		s[i] = fmt.Sprintf("%v", a[i])
+	}
+	return strings.Join(s, ", ")
+}
+
+// hasOption : true if s is one of the options
+func hasOption(options []string, s string) bool {
+	for _, o := range options {
+		if o == s {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRange : record a problem if both limits are set and min exceeds max
+func checkRange(problems map[string]string, minKey string, min *float64, maxKey string, max *float64) {
+	if min != nil && max != nil && *min > *max {
+		problems[maxKey] = "must not be less than " + minKey
+	}
+}